@@ -1,17 +1,101 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"load-balancer/internal/api"
+	"load-balancer/internal/config"
 	"log"
+	"log/slog"
+	"os"
+	"time"
 )
 
 func main() {
-	server, err := api.NewServerDefaultPort("config.yaml")
+	configPath := flag.String("config", envOrDefault("LB_CONFIG", "config.yaml"), "path to the config file (env LB_CONFIG)")
+	address := flag.String("address", envOrDefault("LB_ADDRESS", ":8080"), "address the proxy listens on (env LB_ADDRESS)")
+	adminAddress := flag.String("admin-address", envOrDefault("LB_ADMIN_ADDRESS", ""),
+		"address for the report and instance management API, host:port or unix:/path/to/socket; overrides the config's admin address (env LB_ADMIN_ADDRESS)")
+	tlsAddress := flag.String("tls-address", envOrDefault("LB_TLS_ADDRESS", ""),
+		"address HTTPS is served on; overrides the config's tls address (env LB_TLS_ADDRESS)")
+	logLevel := flag.String("log-level", envOrDefault("LB_LOG_LEVEL", "info"), "debug, info, warn or error (env LB_LOG_LEVEL)")
+	shutdownTimeout := flag.Duration("shutdown-timeout", durationEnvOrDefault("LB_SHUTDOWN_TIMEOUT", api.DefaultShutdownTimeout),
+		"how long in-flight requests are given to finish on shutdown (env LB_SHUTDOWN_TIMEOUT)")
+	checkConfig := flag.Bool("check-config", false, "validate the config file and exit")
+	flag.Parse()
+
+	var level slog.Level
+
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		log.Fatalf("invalid log level %q", *logLevel)
+	}
+
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+
+	if *checkConfig {
+		if _, err := config.LoadConfig(*configPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("%s is valid\n", *configPath)
+		return
+	}
+
+	server, err := api.NewServerWithOptions(api.Options{
+		ConfigPath:      *configPath,
+		Address:         *address,
+		AdminAddress:    *adminAddress,
+		TlsAddress:      *tlsAddress,
+		ShutdownTimeout: *shutdownTimeout,
+	})
+
+	if err != nil {
+		fatal(err)
+	}
+
+	if server.TlsAddress() != "" {
+		slog.Info("load balancer listening", "address", *address, "tls_address", server.TlsAddress(), "admin_address", server.AdminAddress())
+	} else {
+		slog.Info("load balancer listening", "address", *address, "admin_address", server.AdminAddress())
+	}
+
+	if err = server.Start(); err != nil {
+		fatal(err)
+	}
+
+	slog.Info("load balancer stopped")
+}
+
+// fatal logs err at error level and exits. It is used instead of log.Fatal once slog is set up, since log output goes
+// through slog at info level and would be dropped at -log-level=warn or error.
+func fatal(err error) {
+	slog.Error("load balancer failed", "error", err)
+	os.Exit(1)
+}
+
+// envOrDefault returns the environment variable name, or fallback when it is unset or empty. It is used as the
+// default for a flag, so a flag on the command line still wins over the environment.
+func envOrDefault(name string, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+func durationEnvOrDefault(name string, fallback time.Duration) time.Duration {
+	raw := os.Getenv(name)
+
+	if raw == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(raw)
 
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("invalid %s %q: %v", name, raw, err)
 	}
 
-	log.Println("load balancer listening on :8080")
-	log.Fatal(server.Start())
+	return duration
 }
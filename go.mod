@@ -2,4 +2,6 @@ module load-balancer
 
 go 1.26.0
 
-require gopkg.in/yaml.v3 v3.0.1 // indirect
+require gopkg.in/yaml.v3 v3.0.1
+
+require golang.org/x/crypto v0.57.0
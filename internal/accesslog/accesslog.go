@@ -0,0 +1,96 @@
+// Package accesslog writes one structured entry per proxied request, as JSON, logfmt or the Combined Log Format.
+package accesslog
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"time"
+)
+
+const (
+	FormatJson     = "json"
+	FormatLogfmt   = "logfmt"
+	FormatCombined = "combined"
+)
+
+var ErrInvalidFormat = errors.New("access log format must be json, logfmt or combined")
+
+// Entry is everything logged about one request. Backend and UpstreamLatency are empty when the request was never
+// proxied, for example because no backend was healthy.
+type Entry struct {
+	Time            time.Time
+	ClientIp        string
+	Host            string
+	Method          string
+	Path            string
+	Protocol        string
+	Status          int
+	Bytes           int64
+	Referer         string
+	UserAgent       string
+	Backend         string
+	UpstreamLatency time.Duration
+	Latency         time.Duration
+}
+
+// Logger writes access log entries. It is safe for concurrent use.
+type Logger struct {
+	logger *slog.Logger
+}
+
+// New returns a Logger writing entries to w in the given format, logfmt when it is empty.
+func New(format string, w io.Writer) (*Logger, error) {
+	var handler slog.Handler
+
+	switch format {
+	case FormatJson:
+		handler = slog.NewJSONHandler(w, &slog.HandlerOptions{ReplaceAttr: dropLevelAndMessage})
+	case "", FormatLogfmt:
+		handler = slog.NewTextHandler(w, &slog.HandlerOptions{ReplaceAttr: dropLevelAndMessage})
+	case FormatCombined:
+		handler = newCombinedHandler(w)
+	default:
+		return nil, ErrInvalidFormat
+	}
+
+	return &Logger{slog.New(handler)}, nil
+}
+
+// Log writes entry.
+func (logger *Logger) Log(entry Entry) {
+	attrs := []slog.Attr{
+		slog.String("client_ip", entry.ClientIp),
+		slog.String("host", entry.Host),
+		slog.String("method", entry.Method),
+		slog.String("path", entry.Path),
+		slog.String("protocol", entry.Protocol),
+		slog.Int("status", entry.Status),
+		slog.Int64("bytes", entry.Bytes),
+		slog.String("referer", entry.Referer),
+		slog.String("user_agent", entry.UserAgent),
+		slog.String("backend", entry.Backend),
+		slog.Float64("upstream_latency_ms", milliseconds(entry.UpstreamLatency)),
+		slog.Float64("latency_ms", milliseconds(entry.Latency)),
+	}
+
+	record := slog.NewRecord(entry.Time, slog.LevelInfo, "", 0)
+	record.AddAttrs(attrs...)
+
+	_ = logger.logger.Handler().Handle(context.Background(), record)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// dropLevelAndMessage leaves only the timestamp and the entry's own fields, since every access log line has the same
+// level and no message.
+func dropLevelAndMessage(groups []string, attr slog.Attr) slog.Attr {
+	if len(groups) == 0 && (attr.Key == slog.LevelKey || attr.Key == slog.MessageKey) {
+		return slog.Attr{}
+	}
+
+	return attr
+}
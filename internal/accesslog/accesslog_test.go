@@ -0,0 +1,109 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testEntry = Entry{
+	Time:            time.Date(2026, time.March, 4, 15, 4, 5, 0, time.UTC),
+	ClientIp:        "10.0.0.7",
+	Host:            "api.example.com",
+	Method:          "GET",
+	Path:            "/orders?page=2",
+	Protocol:        "HTTP/1.1",
+	Status:          200,
+	Bytes:           512,
+	Referer:         "https://example.com/",
+	UserAgent:       "curl/8.5.0",
+	Backend:         "http://localhost:8081",
+	UpstreamLatency: 12500 * time.Microsecond,
+	Latency:         13 * time.Millisecond,
+}
+
+func TestNew(t *testing.T) {
+	scenarios := []struct {
+		format        string
+		expectedError error
+	}{
+		{"", nil},
+		{FormatJson, nil},
+		{FormatLogfmt, nil},
+		{FormatCombined, nil},
+		{"xml", ErrInvalidFormat},
+	}
+
+	for _, scenario := range scenarios {
+		if _, err := New(scenario.format, &strings.Builder{}); !errors.Is(err, scenario.expectedError) {
+			t.Errorf("New(%q) error = %v, expected %v", scenario.format, err, scenario.expectedError)
+		}
+	}
+}
+
+func TestLogger_Log(t *testing.T) {
+	scenarios := []struct {
+		format   string
+		expected string
+	}{
+		{FormatLogfmt, `time=2026-03-04T15:04:05.000Z client_ip=10.0.0.7 host=api.example.com method=GET path="/orders?page=2" ` +
+			`protocol=HTTP/1.1 status=200 bytes=512 referer=https://example.com/ user_agent=curl/8.5.0 ` +
+			`backend=http://localhost:8081 upstream_latency_ms=12.5 latency_ms=13` + "\n"},
+		{FormatCombined, `10.0.0.7 - - [04/Mar/2026:15:04:05 +0000] "GET /orders?page=2 HTTP/1.1" 200 512 ` +
+			`"https://example.com/" "curl/8.5.0" "http://localhost:8081" 12.5 13` + "\n"},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.format, func(t *testing.T) {
+			var out strings.Builder
+			logger, _ := New(scenario.format, &out)
+
+			logger.Log(testEntry)
+
+			if out.String() != scenario.expected {
+				t.Errorf("Log() wrote\n%v\nexpected\n%v", out.String(), scenario.expected)
+			}
+		})
+	}
+}
+
+func TestLogger_Log_Json(t *testing.T) {
+	var out strings.Builder
+	logger, _ := New(FormatJson, &out)
+
+	logger.Log(testEntry)
+
+	var fields map[string]any
+
+	if err := json.Unmarshal([]byte(out.String()), &fields); err != nil {
+		t.Fatalf("Log() wrote invalid JSON %v: %v", out.String(), err)
+	}
+
+	expected := map[string]any{
+		"time":                "2026-03-04T15:04:05Z",
+		"client_ip":           "10.0.0.7",
+		"host":                "api.example.com",
+		"method":              "GET",
+		"path":                "/orders?page=2",
+		"protocol":            "HTTP/1.1",
+		"status":              float64(200),
+		"bytes":               float64(512),
+		"referer":             "https://example.com/",
+		"user_agent":          "curl/8.5.0",
+		"backend":             "http://localhost:8081",
+		"upstream_latency_ms": 12.5,
+		"latency_ms":          float64(13),
+	}
+
+	if len(fields) != len(expected) {
+		t.Errorf("Log() wrote fields %v, expected %v", fields, expected)
+	}
+
+	for key, value := range expected {
+		if fields[key] != value {
+			t.Errorf("Field %v = %v, expected %v", key, fields[key], value)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package accesslog
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// combinedTimeLayout is the timestamp layout of the Common and Combined Log Formats.
+const combinedTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// combinedHandler is a slog.Handler that writes records from Logger.Log in the Apache/nginx Combined Log Format, with
+// the backend and the upstream and total latencies in milliseconds appended the way nginx appends extra fields:
+//
+//	client_ip - - [time] "method path protocol" status bytes "referer" "user_agent" "backend" upstream_ms total_ms
+//
+// Parsers of the standard format read the line as usual and ignore the fields after it. A request that was never
+// proxied has "-" for its backend and upstream latency.
+type combinedHandler struct {
+	mutex *sync.Mutex
+	w     io.Writer
+}
+
+func newCombinedHandler(w io.Writer) *combinedHandler {
+	return &combinedHandler{&sync.Mutex{}, w}
+}
+
+func (handler *combinedHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (handler *combinedHandler) Handle(_ context.Context, record slog.Record) error {
+	fields := map[string]slog.Value{}
+
+	record.Attrs(func(attr slog.Attr) bool {
+		fields[attr.Key] = attr.Value
+		return true
+	})
+
+	bytes := "-"
+
+	if fields["bytes"].Int64() > 0 {
+		bytes = strconv.FormatInt(fields["bytes"].Int64(), 10)
+	}
+
+	upstreamLatency := "-"
+
+	if fields["backend"].String() != "" {
+		upstreamLatency = formatMilliseconds(fields["upstream_latency_ms"])
+	}
+
+	var line strings.Builder
+	line.WriteString(orDash(fields["client_ip"].String()))
+	line.WriteString(" - - [")
+	line.WriteString(record.Time.Format(combinedTimeLayout))
+	line.WriteString(`] "`)
+	line.WriteString(escape(fields["method"].String() + " " + fields["path"].String() + " " + fields["protocol"].String()))
+	line.WriteString(`" `)
+	line.WriteString(strconv.FormatInt(fields["status"].Int64(), 10))
+	line.WriteString(" ")
+	line.WriteString(bytes)
+	line.WriteString(` "`)
+	line.WriteString(escape(orDash(fields["referer"].String())))
+	line.WriteString(`" "`)
+	line.WriteString(escape(orDash(fields["user_agent"].String())))
+	line.WriteString(`" "`)
+	line.WriteString(escape(orDash(fields["backend"].String())))
+	line.WriteString(`" `)
+	line.WriteString(upstreamLatency)
+	line.WriteString(" ")
+	line.WriteString(formatMilliseconds(fields["latency_ms"]))
+	line.WriteString("\n")
+
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+
+	_, err := io.WriteString(handler.w, line.String())
+
+	return err
+}
+
+func (handler *combinedHandler) WithAttrs([]slog.Attr) slog.Handler {
+	return handler
+}
+
+func (handler *combinedHandler) WithGroup(string) slog.Handler {
+	return handler
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
+
+func formatMilliseconds(value slog.Value) string {
+	return strconv.FormatFloat(value.Float64(), 'f', -1, 64)
+}
+
+var combinedEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, "\n", `\n`)
+
+// escape keeps client-controlled values such as the user agent from breaking out of their quoted field.
+func escape(value string) string {
+	return combinedEscaper.Replace(value)
+}
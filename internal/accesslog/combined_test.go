@@ -0,0 +1,27 @@
+package accesslog
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCombinedHandler_EmptyAndUnsafeFields(t *testing.T) {
+	var out strings.Builder
+	logger, _ := New(FormatCombined, &out)
+	entry := testEntry
+	entry.Bytes = 0
+	entry.Referer = ""
+	entry.UserAgent = `evil" 200 1 "-`
+	entry.Backend = ""
+	entry.UpstreamLatency = 0
+	entry.Latency = 250 * time.Microsecond
+
+	logger.Log(entry)
+
+	expected := `10.0.0.7 - - [04/Mar/2026:15:04:05 +0000] "GET /orders?page=2 HTTP/1.1" 200 - "-" "evil\" 200 1 \"-" "-" - 0.25` + "\n"
+
+	if out.String() != expected {
+		t.Errorf("Log() wrote\n%v\nexpected\n%v", out.String(), expected)
+	}
+}
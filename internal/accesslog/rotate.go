@@ -0,0 +1,128 @@
+package accesslog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// RotatingFile is an append-only file that is rotated once it grows past a maximum size: path is renamed to path.1,
+// path.1 to path.2 and so on, keeping at most maxBackups old files. It is safe for concurrent use.
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	mutex      sync.Mutex
+	file       *os.File
+	size       int64
+	closed     bool
+}
+
+// NewRotatingFile opens path for appending, creating it if needed. A maxSize of zero never rotates.
+func NewRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	rf := &RotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+
+	return rf, nil
+}
+
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mutex.Lock()
+	defer rf.mutex.Unlock()
+
+	if rf.closed {
+		return 0, os.ErrClosed
+	}
+
+	// A failed rotation leaves no file open; try again rather than losing every later entry.
+	if rf.file == nil {
+		if err := rf.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	// A single write larger than maxSize still goes into a file of its own rather than being split.
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+
+	return n, err
+}
+
+func (rf *RotatingFile) Close() error {
+	rf.mutex.Lock()
+	defer rf.mutex.Unlock()
+
+	rf.closed = true
+
+	if rf.file == nil {
+		return nil
+	}
+
+	err := rf.file.Close()
+	rf.file = nil
+
+	return err
+}
+
+func (rf *RotatingFile) open() error {
+	file, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	rf.file = file
+	rf.size = info.Size()
+
+	return nil
+}
+
+// rotate shifts the backups along, dropping the oldest, and starts a new file. The caller must hold the mutex.
+func (rf *RotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+
+	rf.file = nil
+
+	if rf.maxBackups <= 0 {
+		if err := os.Remove(rf.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		return rf.open()
+	}
+
+	for i := rf.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(rf.backupPath(i), rf.backupPath(i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	if err := os.Rename(rf.path, rf.backupPath(1)); err != nil {
+		return err
+	}
+
+	return rf.open()
+}
+
+func (rf *RotatingFile) backupPath(index int) string {
+	return fmt.Sprintf("%s.%d", rf.path, index)
+}
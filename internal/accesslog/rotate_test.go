@@ -0,0 +1,63 @@
+package accesslog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotatingFile_Write(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	rf, err := NewRotatingFile(path, 10, 2)
+
+	if err != nil {
+		t.Fatalf("NewRotatingFile() returned an unexpected error = %v", err)
+	}
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatalf("Write() returned an unexpected error = %v", err)
+		}
+	}
+
+	_ = rf.Close()
+
+	expected := map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	}
+
+	for file, contents := range expected {
+		actual, _ := os.ReadFile(file)
+
+		if string(actual) != contents {
+			t.Errorf("%v contains %q, expected %q", filepath.Base(file), actual, contents)
+		}
+	}
+
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Expected only 2 backups to be kept")
+	}
+
+	if _, err := rf.Write([]byte("closed\n")); err == nil {
+		t.Errorf("Expected Write() after Close() to fail")
+	}
+}
+
+func TestRotatingFile_AppendsToExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	_ = os.WriteFile(path, []byte("existing\n"), 0o644)
+
+	rf, _ := NewRotatingFile(path, 12, 1)
+	_, _ = rf.Write([]byte("new\n"))
+	_ = rf.Close()
+
+	if backup, _ := os.ReadFile(path + ".1"); string(backup) != "existing\n" {
+		t.Errorf("Expected the existing file to be rotated once it would grow past the limit, got backup %q", backup)
+	}
+
+	if current, _ := os.ReadFile(path); string(current) != "new\n" {
+		t.Errorf("Expected the new entry in a fresh file, got %q", current)
+	}
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"io"
+	"load-balancer/internal/accesslog"
+	"load-balancer/internal/backend"
+	"load-balancer/internal/config"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// buildAccessLog opens the access log described by accessLogConfig, logfmt to stdout when it is nil. The returned
+// closer, when not nil, must be closed once the server stops. A nil logger means access logging is off.
+func buildAccessLog(accessLogConfig *config.AccessLogConfig) (*accesslog.Logger, io.Closer, error) {
+	if accessLogConfig == nil {
+		accessLogConfig = &config.AccessLogConfig{}
+	}
+
+	var w io.Writer
+	var closer io.Closer
+
+	switch accessLogConfig.Output {
+	case "off":
+		return nil, nil, nil
+	case "", "stdout":
+		w = os.Stdout
+	case "stderr":
+		w = os.Stderr
+	default:
+		file, err := accesslog.NewRotatingFile(accessLogConfig.Output, int64(accessLogConfig.MaxSizeMb)<<20, accessLogConfig.MaxBackups)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		w, closer = file, file
+	}
+
+	logger, err := accesslog.New(accessLogConfig.Format, w)
+
+	if err != nil {
+		if closer != nil {
+			_ = closer.Close()
+		}
+
+		return nil, nil, err
+	}
+
+	return logger, closer, nil
+}
+
+// logAccess writes the access log entry for a request that started at start. be is nil when the request was never
+// sent to a backend.
+func (server *Server) logAccess(r *http.Request, rec *responseRecorder, be *backend.Backend, start time.Time, upstreamLatency time.Duration) {
+	if server.accessLog == nil {
+		return
+	}
+
+	clientIp, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		clientIp = r.RemoteAddr
+	}
+
+	entry := accesslog.Entry{
+		Time:            start,
+		ClientIp:        clientIp,
+		Host:            r.Host,
+		Method:          r.Method,
+		Path:            r.URL.RequestURI(),
+		Protocol:        r.Proto,
+		Status:          rec.Status(),
+		Bytes:           rec.Bytes(),
+		Referer:         r.Referer(),
+		UserAgent:       r.UserAgent(),
+		UpstreamLatency: upstreamLatency,
+		Latency:         time.Since(start),
+	}
+
+	if be != nil {
+		entry.Backend = be.Url.String()
+	}
+
+	server.accessLog.Log(entry)
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"load-balancer/internal/accesslog"
+	"load-balancer/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildAccessLog(t *testing.T) {
+	scenarios := []struct {
+		name           string
+		accessLog      *config.AccessLogConfig
+		expectedLogger bool
+		expectedCloser bool
+		expectedError  error
+	}{
+		{"Default", nil, true, false, nil},
+		{"Stderr", &config.AccessLogConfig{Format: "json", Output: "stderr"}, true, false, nil},
+		{"Off", &config.AccessLogConfig{Output: "off"}, false, false, nil},
+		{"File", &config.AccessLogConfig{Format: "combined", Output: "access.log", MaxSizeMb: 1}, true, true, nil},
+		{"Invalid Format", &config.AccessLogConfig{Format: "xml", Output: "access.log"}, false, false, accesslog.ErrInvalidFormat},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			if scenario.accessLog != nil && strings.HasSuffix(scenario.accessLog.Output, ".log") {
+				scenario.accessLog.Output = filepath.Join(t.TempDir(), scenario.accessLog.Output)
+			}
+
+			logger, closer, err := buildAccessLog(scenario.accessLog)
+
+			if !errors.Is(err, scenario.expectedError) {
+				t.Fatalf("buildAccessLog() error = %v, expected %v", err, scenario.expectedError)
+			}
+
+			if (logger != nil) != scenario.expectedLogger || (closer != nil) != scenario.expectedCloser {
+				t.Errorf("buildAccessLog() = %v, %v, expected a logger %v and a closer %v", logger, closer, scenario.expectedLogger, scenario.expectedCloser)
+			}
+
+			if closer != nil {
+				_ = closer.Close()
+			}
+		})
+	}
+}
+
+func TestServer_HandleProxy_AccessLog(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("created"))
+	}))
+	defer upstream.Close()
+
+	server, _ := NewServer(0, writeConfig(t, fmt.Sprintf(`
+apps:
+  - host: app1.example.com
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 1h
+    instances:
+      - url: %v`, upstream.URL)))
+
+	var out strings.Builder
+	server.accessLog, _ = accesslog.New(accesslog.FormatJson, &out)
+
+	scenarios := []struct {
+		name     string
+		target   string
+		expected map[string]any
+	}{
+		{"Proxied", "http://app1.example.com/orders?page=2", map[string]any{
+			"host": "app1.example.com", "method": "POST", "path": "/orders?page=2", "status": float64(201),
+			"bytes": float64(7), "backend": upstream.URL, "client_ip": "192.0.2.1", "user_agent": "test-agent",
+		}},
+		{"Unknown Host", "http://unknown.example.com/", map[string]any{
+			"host": "unknown.example.com", "status": float64(500), "backend": "", "upstream_latency_ms": float64(0),
+		}},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			out.Reset()
+			request := httptest.NewRequest(http.MethodPost, scenario.target, nil)
+			request.Header.Set("User-Agent", "test-agent")
+
+			server.publicHandler().ServeHTTP(httptest.NewRecorder(), request)
+
+			var entry map[string]any
+
+			if err := json.Unmarshal([]byte(out.String()), &entry); err != nil {
+				t.Fatalf("Access log entry %q is not valid JSON: %v", out.String(), err)
+			}
+
+			for key, value := range scenario.expected {
+				if entry[key] != value {
+					t.Errorf("Access log %v = %v, expected %v", key, entry[key], value)
+				}
+			}
+		})
+	}
+}
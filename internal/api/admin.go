@@ -0,0 +1,167 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"load-balancer/internal/backend"
+	"load-balancer/internal/balancer"
+	"load-balancer/internal/config"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// defaultDrainTimeout is how long a draining instance is given to finish its in-flight requests when the drain
+// request doesn't say.
+const defaultDrainTimeout = 30 * time.Second
+
+type AddInstanceRequest struct {
+	Url    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// handleAddInstance puts a new instance into rotation for the app in the path. It gets the same health check, timeout,
+// outlier detection and circuit breaker settings as the app's configured instances.
+func (server *Server) handleAddInstance(w http.ResponseWriter, r *http.Request) {
+	server.reloadMutex.Lock()
+	defer server.reloadMutex.Unlock()
+
+	host := r.PathValue("host")
+	current := server.routes.Load()
+	lb, app, up := current.loadBalancers[host], current.apps[host], current.upstreams[host]
+
+	if lb == nil {
+		http.Error(w, fmt.Sprintf("no load balancer found for %s", host), http.StatusNotFound)
+		return
+	}
+
+	var request AddInstanceRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	be, err := buildInstance(app, up.transport, &config.InstanceConfig{Url: request.Url, Weight: request.Weight}, server.metrics)
+
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid instance: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := lb.AddBackend(be); err != nil {
+		http.Error(w, err.Error(), adminErrorStatus(err))
+		return
+	}
+
+	slog.Info("added instance", "host", host, "instance", be.Url.String())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(&LoadBalancerReportInstance{Url: be.Url.String(), Healthy: be.IsHealthy()})
+}
+
+// handleRemoveInstance takes the instance in the url query parameter out of rotation immediately.
+func (server *Server) handleRemoveInstance(w http.ResponseWriter, r *http.Request) {
+	server.reloadMutex.Lock()
+	defer server.reloadMutex.Unlock()
+
+	host := r.PathValue("host")
+	lb := server.loadBalancer(host)
+
+	if lb == nil {
+		http.Error(w, fmt.Sprintf("no load balancer found for %s", host), http.StatusNotFound)
+		return
+	}
+
+	instanceUrl := r.URL.Query().Get("url")
+
+	if instanceUrl == "" {
+		http.Error(w, "missing url query parameter", http.StatusBadRequest)
+		return
+	}
+
+	if err := lb.RemoveBackend(instanceUrl); err != nil {
+		http.Error(w, err.Error(), adminErrorStatus(err))
+		return
+	}
+
+	slog.Info("removed instance", "host", host, "instance", instanceUrl)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDrainInstance stops new requests going to the instance in the url query parameter and removes it once its
+// in-flight requests finish or the drain times out, after the timeout query parameter or defaultDrainTimeout.
+func (server *Server) handleDrainInstance(w http.ResponseWriter, r *http.Request) {
+	server.reloadMutex.Lock()
+	defer server.reloadMutex.Unlock()
+
+	host := r.PathValue("host")
+	lb := server.loadBalancer(host)
+
+	if lb == nil {
+		http.Error(w, fmt.Sprintf("no load balancer found for %s", host), http.StatusNotFound)
+		return
+	}
+
+	instanceUrl, rawTimeout := r.URL.Query().Get("url"), r.URL.Query().Get("timeout")
+
+	if instanceUrl == "" {
+		http.Error(w, "missing url query parameter", http.StatusBadRequest)
+		return
+	}
+
+	timeout, err := parseOptionalDuration(rawTimeout)
+
+	if err != nil || timeout < 0 {
+		http.Error(w, fmt.Sprintf("invalid timeout %q", rawTimeout), http.StatusBadRequest)
+		return
+	}
+
+	if timeout == 0 {
+		timeout = defaultDrainTimeout
+	}
+
+	if err := lb.DrainBackend(instanceUrl, timeout); err != nil {
+		http.Error(w, err.Error(), adminErrorStatus(err))
+		return
+	}
+
+	slog.Info("draining instance", "host", host, "instance", instanceUrl, "timeout", timeout)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func adminErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, balancer.ErrBackendNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, balancer.ErrDuplicateBackend):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// buildInstance builds a backend for an instance added at runtime, with the same settings as the app's configured
+// instances, and health checked over the app's transport.
+func buildInstance(app *config.ApplicationConfig, transport *http.Transport, instance *config.InstanceConfig, serverMetrics *serverMetrics) (*backend.Backend, error) {
+	timeout, err := time.ParseDuration(app.Timeout)
+
+	if err != nil {
+		return nil, err
+	}
+
+	withInstance := *app
+	withInstance.Instances = []*config.InstanceConfig{instance}
+
+	backends, err := buildBackends(&withInstance, &http.Client{Timeout: timeout, Transport: transport}, nil, serverMetrics)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return backends[0], nil
+}
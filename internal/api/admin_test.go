@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServer_HandleAddInstance(t *testing.T) {
+	scenarios := []struct {
+		name           string
+		host           string
+		body           string
+		expectedStatus int
+	}{
+		{"Added", "app1.example.com", `{"url": "http://localhost:8082", "weight": 2}`, http.StatusCreated},
+		{"Duplicate", "app1.example.com", `{"url": "http://localhost:8080"}`, http.StatusConflict},
+		{"Unknown Host", "unknown.example.com", `{"url": "http://localhost:8082"}`, http.StatusNotFound},
+		{"Invalid Url", "app1.example.com", `{"url": "localhost:8082"}`, http.StatusBadRequest},
+		{"Invalid Weight", "app1.example.com", `{"url": "http://localhost:8082", "weight": -1}`, http.StatusBadRequest},
+		{"Invalid Body", "app1.example.com", `{"url":`, http.StatusBadRequest},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			server, _ := NewServer(0, writeConfig(t, reloadBaseConfig))
+			request := httptest.NewRequest(http.MethodPost, "/api/v1/loadBalancers/"+scenario.host+"/instances", strings.NewReader(scenario.body))
+			request.SetPathValue("host", scenario.host)
+			recorder := httptest.NewRecorder()
+
+			server.handleAddInstance(recorder, request)
+
+			if recorder.Code != scenario.expectedStatus {
+				t.Fatalf("handleAddInstance() status = %v, expected %v: %v", recorder.Code, scenario.expectedStatus, recorder.Body)
+			}
+
+			backends := server.loadBalancer("app1.example.com").GetBackends()
+
+			if scenario.expectedStatus == http.StatusCreated && (len(backends) != 3 || backends[2].Weight() != 2) {
+				t.Errorf("Expected the instance to be added with weight 2")
+			}
+
+			if scenario.expectedStatus != http.StatusCreated && len(backends) != 2 {
+				t.Errorf("Expected no instance to be added, got %v instances", len(backends))
+			}
+		})
+	}
+}
+
+func TestServer_HandleRemoveInstance(t *testing.T) {
+	scenarios := []struct {
+		name           string
+		host           string
+		url            string
+		expectedStatus int
+	}{
+		{"Removed", "app1.example.com", "http://localhost:8080", http.StatusNoContent},
+		{"Unknown Instance", "app1.example.com", "http://localhost:9999", http.StatusNotFound},
+		{"Unknown Host", "unknown.example.com", "http://localhost:8080", http.StatusNotFound},
+		{"Missing Url", "app1.example.com", "", http.StatusBadRequest},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			server, _ := NewServer(0, writeConfig(t, reloadBaseConfig))
+			request := httptest.NewRequest(http.MethodDelete, "/api/v1/loadBalancers/"+scenario.host+"/instances?url="+scenario.url, nil)
+			request.SetPathValue("host", scenario.host)
+			recorder := httptest.NewRecorder()
+
+			server.handleRemoveInstance(recorder, request)
+
+			if recorder.Code != scenario.expectedStatus {
+				t.Fatalf("handleRemoveInstance() status = %v, expected %v: %v", recorder.Code, scenario.expectedStatus, recorder.Body)
+			}
+		})
+	}
+}
+
+func TestServer_HandleDrainInstance(t *testing.T) {
+	scenarios := []struct {
+		name           string
+		query          string
+		expectedStatus int
+	}{
+		{"Draining", "url=http://localhost:8080&timeout=1h", http.StatusAccepted},
+		{"Default Timeout", "url=http://localhost:8080", http.StatusAccepted},
+		{"Invalid Timeout", "url=http://localhost:8080&timeout=soon", http.StatusBadRequest},
+		{"Unknown Instance", "url=http://localhost:9999", http.StatusNotFound},
+		{"Missing Url", "timeout=1h", http.StatusBadRequest},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			server, _ := NewServer(0, writeConfig(t, reloadBaseConfig))
+			server.loadBalancer("app1.example.com").GetBackends()[0].AddConnection()
+			request := httptest.NewRequest(http.MethodPost, "/api/v1/loadBalancers/app1.example.com/instances/drain?"+scenario.query, nil)
+			request.SetPathValue("host", "app1.example.com")
+			recorder := httptest.NewRecorder()
+
+			server.handleDrainInstance(recorder, request)
+
+			if recorder.Code != scenario.expectedStatus {
+				t.Fatalf("handleDrainInstance() status = %v, expected %v: %v", recorder.Code, scenario.expectedStatus, recorder.Body)
+			}
+
+			if scenario.expectedStatus != http.StatusAccepted {
+				return
+			}
+
+			var report LoadBalancerReport
+			reportRecorder := httptest.NewRecorder()
+			server.handleReport(reportRecorder, httptest.NewRequest(http.MethodGet, "/api/v1/loadBalancers/report", nil))
+			_ = json.NewDecoder(reportRecorder.Body).Decode(&report)
+
+			for _, app := range report.Apps {
+				for _, instance := range app.Instances {
+					if instance.Draining != (instance.Url == "http://localhost:8080") {
+						t.Errorf("Report has %v draining = %v", instance.Url, instance.Draining)
+					}
+				}
+			}
+		})
+	}
+}
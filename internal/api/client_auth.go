@@ -0,0 +1,110 @@
+package api
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"load-balancer/internal/config"
+	"net/http"
+	"strings"
+)
+
+const (
+	DefaultSubjectHeader     = "X-Client-Cert-Subject"
+	DefaultFingerprintHeader = "X-Client-Cert-Fingerprint"
+)
+
+var (
+	ErrClientCertificateRequired = errors.New("a client certificate is required")
+	ErrMisdirectedRequest        = errors.New("the TLS server name doesn't match the host")
+)
+
+// clientAuth is an app's client certificate requirement, built from its client_auth block.
+type clientAuth struct {
+	clientAuthType    tls.ClientAuthType
+	clientCas         *x509.CertPool
+	subjectHeader     string
+	fingerprintHeader string
+}
+
+func buildClientAuth(clientAuthConfig *config.ClientAuthConfig) (*clientAuth, error) {
+	clientCas, err := loadCertPool(clientAuthConfig.CaFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	auth := &clientAuth{
+		clientAuthType:    tls.RequireAndVerifyClientCert,
+		clientCas:         clientCas,
+		subjectHeader:     cmp.Or(clientAuthConfig.SubjectHeader, DefaultSubjectHeader),
+		fingerprintHeader: cmp.Or(clientAuthConfig.FingerprintHeader, DefaultFingerprintHeader),
+	}
+
+	if clientAuthConfig.Mode == config.ClientAuthOptional {
+		auth.clientAuthType = tls.VerifyClientCertIfGiven
+	}
+
+	return auth, nil
+}
+
+// authorize checks that r arrived over a connection whose handshake asked for this app's client certificate, and
+// forwards the verified certificate to backends in the configured headers. Headers of the same names sent by the
+// client are always dropped, so backends can trust them. It returns the status to reject r with when it fails.
+func (auth *clientAuth) authorize(r *http.Request, host string) (int, error) {
+	r.Header.Del(auth.subjectHeader)
+	r.Header.Del(auth.fingerprintHeader)
+
+	if r.TLS == nil {
+		return http.StatusForbidden, ErrClientCertificateRequired
+	}
+
+	// The handshake picked the client certificate requirement by server name, so a request for this host on a
+	// connection made for another one would get around it.
+	if normalizeServerName(r.TLS.ServerName) != normalizeServerName(host) {
+		return http.StatusMisdirectedRequest, ErrMisdirectedRequest
+	}
+
+	if len(r.TLS.VerifiedChains) == 0 {
+		if auth.clientAuthType == tls.RequireAndVerifyClientCert {
+			return http.StatusForbidden, ErrClientCertificateRequired
+		}
+
+		return 0, nil
+	}
+
+	leaf := r.TLS.VerifiedChains[0][0]
+	fingerprint := sha256.Sum256(leaf.Raw)
+	r.Header.Set(auth.subjectHeader, leaf.Subject.String())
+	r.Header.Set(auth.fingerprintHeader, hex.EncodeToString(fingerprint[:]))
+
+	return 0, nil
+}
+
+// getConfigForClient asks for a client certificate during handshakes for hosts of apps with client_auth. Other
+// handshakes use base unchanged.
+func (server *Server) getConfigForClient(base *tls.Config) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		auth := server.routes.Load().clientAuths[normalizeServerName(hello.ServerName)]
+
+		if auth == nil {
+			return nil, nil
+		}
+
+		withClientAuth := base.Clone()
+		withClientAuth.GetConfigForClient = nil
+		withClientAuth.ClientAuth = auth.clientAuthType
+		withClientAuth.ClientCAs = auth.clientCas
+		// A session resumed from a handshake for another host would skip the certificate check.
+		withClientAuth.SessionTicketsDisabled = true
+
+		return withClientAuth, nil
+	}
+}
+
+func normalizeServerName(serverName string) string {
+	return strings.ToLower(strings.TrimSuffix(serverName, "."))
+}
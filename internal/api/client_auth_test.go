@@ -0,0 +1,176 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"load-balancer/internal/config"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestClientAuth_Authorize(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t, "client.example.com")
+	clientCertificate, _ := tls.LoadX509KeyPair(certFile, keyFile)
+	leaf := clientCertificate.Leaf
+
+	scenarios := []struct {
+		name            string
+		mode            string
+		state           *tls.ConnectionState
+		expectedStatus  int
+		expectedError   error
+		expectedSubject string
+	}{
+		{"Plain Http", config.ClientAuthRequire, nil, http.StatusForbidden, ErrClientCertificateRequired, ""},
+		{"Other Server Name", config.ClientAuthRequire, &tls.ConnectionState{ServerName: "public.example.com"}, http.StatusMisdirectedRequest, ErrMisdirectedRequest, ""},
+		{"Required Without Certificate", config.ClientAuthRequire, &tls.ConnectionState{ServerName: "partner.example.com"}, http.StatusForbidden, ErrClientCertificateRequired, ""},
+		{"Optional Without Certificate", config.ClientAuthOptional, &tls.ConnectionState{ServerName: "partner.example.com"}, 0, nil, ""},
+		{"Verified Certificate", config.ClientAuthRequire, &tls.ConnectionState{
+			ServerName:     "Partner.example.com.",
+			VerifiedChains: [][]*x509.Certificate{{leaf}},
+		}, 0, nil, "CN=client.example.com"},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			auth, err := buildClientAuth(&config.ClientAuthConfig{CaFile: certFile, Mode: scenario.mode})
+
+			if err != nil {
+				t.Fatalf("buildClientAuth() returned an unexpected error = %v", err)
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "https://partner.example.com/", nil)
+			r.TLS = scenario.state
+			r.Header.Set(DefaultSubjectHeader, "CN=spoofed")
+
+			status, err := auth.authorize(r, "partner.example.com")
+
+			if status != scenario.expectedStatus || !errors.Is(err, scenario.expectedError) {
+				t.Fatalf("authorize() = %v, %v, expected %v, %v", status, err, scenario.expectedStatus, scenario.expectedError)
+			}
+
+			if subject := r.Header.Get(DefaultSubjectHeader); subject != scenario.expectedSubject {
+				t.Errorf("Expected subject header %q, got %q", scenario.expectedSubject, subject)
+			}
+
+			if fingerprint := r.Header.Get(DefaultFingerprintHeader); (fingerprint != "") != (scenario.expectedSubject != "") {
+				t.Errorf("Unexpected fingerprint header %q", fingerprint)
+			}
+		})
+	}
+}
+
+func TestServer_ServeTls_ClientAuth(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Header.Get("X-Partner"))
+	}))
+	defer upstream.Close()
+
+	clientCertFile, clientKeyFile := writeTestCertificate(t, "client.example.com")
+	clientCertificate, _ := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+	roots := x509.NewCertPool()
+	var apps string
+
+	for _, host := range []string{"partner.example.com", "public.example.com"} {
+		certFile, keyFile := writeTestCertificate(t, host)
+		pemBytes, _ := os.ReadFile(certFile)
+		roots.AppendCertsFromPEM(pemBytes)
+		apps += fmt.Sprintf(`
+  - host: %v
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 1h
+    tls:
+      cert_file: %v
+      key_file: %v
+    instances:
+      - url: %v`, host, certFile, keyFile, upstream.URL)
+
+		if host == "partner.example.com" {
+			apps += fmt.Sprintf(`
+    client_auth:
+      ca_file: %v
+      subject_header: X-Partner`, clientCertFile)
+		}
+	}
+
+	server, err := NewServer(0, writeConfig(t, "apps:"+apps))
+
+	if err != nil {
+		t.Fatalf("NewServer() returned an unexpected error = %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+
+	httpServer := serveTls(listener, server.publicHandler(), server.tlsConfig())
+	defer httpServer.Close()
+
+	scenarios := []struct {
+		name           string
+		serverName     string
+		host           string
+		withClientCert bool
+		expectedError  bool
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"Client Certificate", "partner.example.com", "partner.example.com", true, false, http.StatusOK, "CN=client.example.com"},
+		{"No Client Certificate", "partner.example.com", "partner.example.com", false, true, 0, ""},
+		{"Host Without Client Auth", "public.example.com", "public.example.com", false, false, http.StatusOK, ""},
+		{"Server Name Of Another Host", "public.example.com", "partner.example.com", false, false, http.StatusMisdirectedRequest, ""},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			tlsConfig := &tls.Config{ServerName: scenario.serverName, RootCAs: roots}
+
+			if scenario.withClientCert {
+				tlsConfig.Certificates = []tls.Certificate{clientCertificate}
+			}
+
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig, ForceAttemptHTTP2: true}}
+			r, _ := http.NewRequest(http.MethodGet, "https://"+listener.Addr().String()+"/", nil)
+			r.Host = scenario.host
+
+			resp, err := client.Do(r)
+
+			if scenario.expectedError {
+				if err == nil {
+					_ = resp.Body.Close()
+					t.Fatalf("Expected the handshake to fail without a client certificate")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.ProtoMajor != 2 {
+				t.Errorf("Expected HTTP/2, got %v", resp.Proto)
+			}
+
+			if resp.StatusCode != scenario.expectedStatus {
+				t.Fatalf("Expected status %v, got %v", scenario.expectedStatus, resp.StatusCode)
+			}
+
+			if scenario.expectedStatus == http.StatusOK && string(body) != scenario.expectedBody {
+				t.Errorf("Expected the subject %q to be forwarded, got %q", scenario.expectedBody, body)
+			}
+		})
+	}
+}
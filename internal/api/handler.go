@@ -1,12 +1,17 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"load-balancer/internal/backend"
+	"load-balancer/internal/balancer"
+	"log/slog"
 	"net"
 	"net/http"
-	"net/http/httputil"
+	"slices"
+	"time"
 )
 
 type LoadBalancerReport struct {
@@ -19,39 +24,185 @@ type LoadBalancerReportApp struct {
 }
 
 type LoadBalancerReportInstance struct {
-	Url     string `json:"url"`
-	Healthy bool   `json:"healthy"`
+	Url      string `json:"url"`
+	Healthy  bool   `json:"healthy"`
+	Draining bool   `json:"draining"`
 }
 
 func (server *Server) handleProxy(w http.ResponseWriter, r *http.Request) {
-	fmt.Printf("received request: %s %s %s\n", r.Method, r.Host, r.URL)
+	start := time.Now()
+	rec := newResponseRecorder(w)
 
-	host, _, splitErr := net.SplitHostPort(r.Host)
+	var be *backend.Backend
+	var upstreamLatency time.Duration
 
-	if splitErr != nil {
-		host = r.Host
-	}
+	defer func() { server.logAccess(r, rec, be, start, upstreamLatency) }()
 
-	lb := server.loadBalancers[host]
+	host := hostWithoutPort(r.Host)
+	current := server.routes.Load()
+	lb, policy, up, rt := current.loadBalancers[host], current.retryPolicies[host], current.upstreams[host], current.timeouts[host]
 
 	if lb == nil {
-		http.Error(w, "No load balancer found", http.StatusInternalServerError)
-		log.Printf("no load balancer found for %s", host)
+		server.metrics.proxyError("", proxyErrorUnknownHost)
+		http.Error(rec, "No load balancer found", http.StatusInternalServerError)
+		slog.Warn("no load balancer found", "host", host)
 		return
 	}
 
-	be, err := lb.GetNextBackend()
+	if auth := current.clientAuths[normalizeServerName(host)]; auth != nil {
+		if status, authErr := auth.authorize(r, host); authErr != nil {
+			server.metrics.proxyError(host, proxyErrorClientAuth)
+			http.Error(rec, authErr.Error(), status)
+			return
+		}
+	}
+
+	timeout := rt.forPath(r.URL.Path)
+
+	if timeout > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+
+	be, attempt, err := acquireBackend(lb, r, nil)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		log.Printf("GetNextBackend: %v", err)
+		server.metrics.proxyError(host, proxyErrorNoBackend)
+		http.Error(rec, err.Error(), http.StatusInternalServerError)
+		slog.Warn("no backend available", "host", host, "error", err)
 		return
 	}
 
+	if r.TLS != nil {
+		r.Header.Set("X-Forwarded-Proto", "https")
+	} else {
+		r.Header.Set("X-Forwarded-Proto", "http")
+	}
+
+	rewind, retryable := func() {}, policy.retryable(r)
+
+	if retryable {
+		if rewind, retryable, err = bufferBody(r, policy.maxBodyBytes); err != nil {
+			http.Error(rec, "error reading request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var tried []*backend.Backend
+
+	for {
+		var transportErr error
+		rt.setDeadlineHeader(r)
+		upstreamLatency, transportErr = server.proxyTo(rec, r, host, lb, up, be, attempt)
+
+		if transportErr == nil {
+			return
+		}
+
+		slog.Warn("proxy error", "host", host, "backend", be.Url.String(), "error", transportErr)
+		tried = append(tried, be)
+
+		if !retryable || !policy.allowsRetry(len(tried)-1, start) || r.Context().Err() != nil {
+			break
+		}
+
+		next, nextAttempt, nextErr := acquireBackend(lb, r, tried)
+
+		if nextErr != nil {
+			break
+		}
+
+		server.metrics.retry(host)
+		be, attempt = next, nextAttempt
+		rewind()
+	}
+
+	if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+		http.Error(rec, fmt.Sprintf("%s did not respond within %v", host, timeout), http.StatusGatewayTimeout)
+		return
+	}
+
+	rec.WriteHeader(http.StatusBadGateway)
+}
+
+// hostWithoutPort strips the port, if there is one, from a Host header.
+func hostWithoutPort(hostport string) string {
+	host, _, err := net.SplitHostPort(hostport)
+
+	if err != nil {
+		return hostport
+	}
+
+	return host
+}
+
+// acquireBackend picks a backend for r that isn't in exclude and reserves it for the request. A backend whose circuit
+// breaker turns the request away, for example because another request took its last half-open probe first, is passed
+// over for the next pick.
+func acquireBackend(lb *balancer.LoadBalancer, r *http.Request, exclude []*backend.Backend) (*backend.Backend, backend.Attempt, error) {
+	passedOver := slices.Clone(exclude)
+
+	for {
+		be, err := lb.GetNextBackendExcluding(r, passedOver)
+
+		if err != nil {
+			return nil, backend.Attempt{}, err
+		}
+
+		if attempt, ok := be.TryAcquire(); ok {
+			return be, attempt, nil
+		}
+
+		passedOver = append(passedOver, be)
+	}
+}
+
+// proxyTo sends r to be through its proxy in up and writes the response to rec, recording the result against acquired,
+// the attempt reserved for it. If the transport fails before a response arrives, nothing is written and the error is
+// returned, so the request can be retried on another backend.
+func (server *Server) proxyTo(rec *responseRecorder, r *http.Request, host string, lb *balancer.LoadBalancer, up *upstream, be *backend.Backend, acquired backend.Attempt) (time.Duration, error) {
 	be.AddConnection()
 	defer be.ReleaseConnection()
 
-	httputil.NewSingleHostReverseProxy(be.Url).ServeHTTP(w, r)
+	attempt := &proxyAttempt{rec: rec, r: r, lb: lb, be: be}
+
+	start := time.Now()
+	up.proxy(be).ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), proxyAttemptKey{}, attempt)))
+	latency := time.Since(start)
+
+	// A failed dial or a reset returns sooner than any real response would, so only latency of responses that arrived
+	// counts towards least_latency; otherwise a dead backend would look like the fastest one.
+	if attempt.err == nil {
+		be.ObserveLatency(latency)
+	}
+
+	status := rec.Status()
+
+	if attempt.err != nil {
+		status = http.StatusBadGateway
+		server.metrics.proxyError(host, classifyProxyError(attempt.err))
+	}
+
+	// The client hanging up says nothing about the backend, so it mustn't count as a 5xx or towards ejecting it.
+	if errors.Is(attempt.err, context.Canceled) {
+		acquired.RecordAbandoned()
+		return latency, attempt.err
+	}
+
+	if errors.Is(attempt.err, context.DeadlineExceeded) {
+		status = http.StatusGatewayTimeout
+	}
+
+	server.metrics.observeRequest(host, be, status, latency)
+
+	if status >= http.StatusInternalServerError {
+		acquired.RecordFailure()
+	} else {
+		acquired.RecordSuccess()
+	}
+
+	return latency, attempt.err
 }
 
 func (server *Server) handleReport(w http.ResponseWriter, r *http.Request) {
@@ -60,21 +211,28 @@ func (server *Server) handleReport(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		http.Error(w, fmt.Sprintf("error encoding JSON: %v", err), http.StatusInternalServerError)
-		log.Printf("Error encoding JSON: %v", err)
+		slog.Error("error encoding the report", "error", err)
 		return
 	}
 }
 
 func buildLoadBalancerReport(server *Server) LoadBalancerReport {
 	var report LoadBalancerReport
-	report.Apps = make([]*LoadBalancerReportApp, len(server.loadBalancers))
+	loadBalancers := server.routes.Load().loadBalancers
+	report.Apps = make([]*LoadBalancerReportApp, len(loadBalancers))
 	index := 0
 
-	for host, lb := range server.loadBalancers {
-		report.Apps[index] = &LoadBalancerReportApp{host, make([]*LoadBalancerReportInstance, len(lb.GetBackends()))}
+	for host, lb := range loadBalancers {
+		report.Apps[index] = &LoadBalancerReportApp{host, make([]*LoadBalancerReportInstance, 0, len(lb.GetBackends()))}
+
+		for _, instance := range lb.GetBackends() {
+			report.Apps[index].Instances = append(report.Apps[index].Instances,
+				&LoadBalancerReportInstance{instance.Url.String(), instance.IsHealthy(), false})
+		}
 
-		for i, instance := range lb.GetBackends() {
-			report.Apps[index].Instances[i] = &LoadBalancerReportInstance{instance.Url.String(), instance.IsHealthy()}
+		for _, instance := range lb.GetDrainingBackends() {
+			report.Apps[index].Instances = append(report.Apps[index].Instances,
+				&LoadBalancerReportInstance{instance.Url.String(), instance.IsHealthy(), true})
 		}
 
 		index++
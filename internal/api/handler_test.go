@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"load-balancer/internal/backend"
+	"load-balancer/internal/balancer"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServer_HandleProxy_FailedAttemptLatency(t *testing.T) {
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	server, err := NewServer(0, writeConfig(t, fmt.Sprintf(`
+apps:
+  - host: app.example.com
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 1h
+    strategy: least_latency
+    instances:
+      - url: %v`, unreachable.URL)))
+
+	if err != nil {
+		t.Fatalf("NewServer() returned an unexpected error = %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	server.publicHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://app.example.com/", nil))
+
+	if recorder.Code != http.StatusBadGateway {
+		t.Fatalf("Expected status %v, got %v", http.StatusBadGateway, recorder.Code)
+	}
+
+	be := server.loadBalancer("app.example.com").GetBackends()[0]
+
+	if latency := be.Latency(); latency != 0 {
+		t.Errorf("Expected a failed attempt not to count towards latency, got %v", latency)
+	}
+}
+
+func TestServer_HandleProxy_ClientCanceled(t *testing.T) {
+	received := make(chan struct{})
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		<-r.Context().Done()
+	}))
+	defer upstream.Close()
+
+	server, err := NewServer(0, writeConfig(t, fmt.Sprintf(`
+apps:
+  - host: app.example.com
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 1h
+    outlier_detection:
+      consecutive_failures: 1
+    circuit_breaker:
+      min_requests: 1
+    instances:
+      - url: %v`, upstream.URL)))
+
+	if err != nil {
+		t.Fatalf("NewServer() returned an unexpected error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		<-received
+		cancel()
+	}()
+
+	r := httptest.NewRequestWithContext(ctx, http.MethodGet, "http://app.example.com/", nil)
+	server.publicHandler().ServeHTTP(httptest.NewRecorder(), r)
+
+	be := server.loadBalancer("app.example.com").GetBackends()[0]
+
+	if !be.IsHealthy() {
+		t.Errorf("Expected the backend to stay in rotation after the client canceled")
+	}
+
+	if count := server.metrics.requests.Value(requestLabels{backendLabels{"app.example.com", be.Url.String()}, "5xx"}); count != 0 {
+		t.Errorf("Expected a canceled request not to count as a 5xx, got %v", count)
+	}
+
+	if count := server.metrics.proxyErrors.Value(proxyErrorLabels{"app.example.com", proxyErrorCanceled}); count != 1 {
+		t.Errorf("Expected 1 client_canceled proxy error, got %v", count)
+	}
+}
+
+func TestAcquireBackend_PassesOverTurnedAway(t *testing.T) {
+	open, _ := backend.NewFromString("http://localhost:8080", "/health", nil)
+	open.SetCircuitBreaker(backend.CircuitBreaker{MinRequests: 1, CoolOff: time.Hour})
+	attempt, _ := open.TryAcquire()
+	attempt.RecordFailure()
+
+	closed, _ := backend.NewFromString("http://localhost:8081", "/health", nil)
+
+	// The strategy picks the open backend as if it had looked healthy a moment ago.
+	lb := balancer.New([]*backend.Backend{open, closed}, firstBackend{}, time.Hour)
+	be, _, err := acquireBackend(lb, httptest.NewRequest(http.MethodGet, "/", nil), nil)
+
+	if err != nil || be != closed {
+		t.Errorf("acquireBackend() = %v, %v, expected %v", be, err, closed)
+	}
+
+	if _, _, err = acquireBackend(lb, httptest.NewRequest(http.MethodGet, "/", nil), []*backend.Backend{closed}); !errors.Is(err, balancer.NoHealthyBackends) {
+		t.Errorf("acquireBackend() error = %v, expected %v", err, balancer.NoHealthyBackends)
+	}
+}
+
+// firstBackend is a strategy that picks the first backend whatever its health.
+type firstBackend struct{}
+
+func (firstBackend) NextBackend(backends []*backend.Backend, _ *http.Request) (*backend.Backend, error) {
+	if len(backends) == 0 {
+		return nil, balancer.NoHealthyBackends
+	}
+
+	return backends[0], nil
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"crypto/tls"
+	"errors"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// unixAddressPrefix marks an address as the path of a unix socket.
+const unixAddressPrefix = "unix:"
+
+// listen opens a TCP listener on address, or a unix socket when address is unix:/path/to/socket. A socket file left
+// behind by a previous run is removed first.
+func listen(address string) (net.Listener, error) {
+	socketPath, isUnix := strings.CutPrefix(address, unixAddressPrefix)
+
+	if !isUnix {
+		return net.Listen("tcp", address)
+	}
+
+	if info, err := os.Stat(socketPath); err == nil && info.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(socketPath)
+	}
+
+	return net.Listen("unix", socketPath)
+}
+
+func serve(listener net.Listener, handler http.Handler) *http.Server {
+	httpServer := &http.Server{Handler: handler, ErrorLog: serverErrorLog()}
+	go func() { logServeError(httpServer.Serve(listener)) }()
+
+	return httpServer
+}
+
+// serveTls serves HTTPS, and HTTP/2 to clients that negotiate it, with the certificates tlsConfig picks.
+func serveTls(listener net.Listener, handler http.Handler, tlsConfig *tls.Config) *http.Server {
+	httpServer := &http.Server{Handler: handler, TLSConfig: tlsConfig, ErrorLog: serverErrorLog()}
+	go func() { logServeError(httpServer.ServeTLS(listener, "", "")) }()
+
+	return httpServer
+}
+
+// serverErrorLog sends the errors net/http logs itself, such as failed TLS handshakes, through slog as warnings, so
+// they are kept at -log-level=warn.
+func serverErrorLog() *log.Logger {
+	return slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn)
+}
+
+func logServeError(err error) {
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("server error", "error", err)
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListen_UnixSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "admin.sock")
+
+	// A socket left behind by a previous run must not stop the listener from starting.
+	stale, err := net.Listen("unix", socketPath)
+
+	if err != nil {
+		t.Fatalf("Error creating stale socket: %v", err)
+	}
+
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = stale.Close()
+
+	listener, err := listen(unixAddressPrefix + socketPath)
+
+	if err != nil {
+		t.Fatalf("listen() returned an unexpected error = %v", err)
+	}
+
+	httpServer := serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "admin")
+	}))
+	defer httpServer.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+		},
+	}}
+
+	resp, err := client.Get("http://admin/")
+
+	if err != nil {
+		t.Fatalf("Request over the unix socket failed: %v", err)
+	}
+
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if string(body) != "admin" {
+		t.Errorf("Expected body %q, got %q", "admin", body)
+	}
+}
+
+func TestListen_RefusesToRemoveRegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "not-a-socket")
+	_ = os.WriteFile(path, []byte("keep me"), 0o600)
+
+	if _, err := listen(unixAddressPrefix + path); err == nil {
+		t.Fatalf("Expected listen() to fail when a regular file is in the way")
+	}
+
+	if contents, _ := os.ReadFile(path); string(contents) != "keep me" {
+		t.Errorf("Expected the file to be left alone")
+	}
+}
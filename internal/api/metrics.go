@@ -0,0 +1,222 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"load-balancer/internal/backend"
+	"load-balancer/internal/metrics"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Kinds of proxy error, the kind label of lb_proxy_errors_total.
+const (
+	proxyErrorUnknownHost = "unknown_host"
+	proxyErrorNoBackend   = "no_backend"
+	proxyErrorClientAuth  = "client_auth"
+	proxyErrorConnect     = "connect"
+	proxyErrorTimeout     = "timeout"
+	proxyErrorCanceled    = "client_canceled"
+	proxyErrorUpstream    = "upstream"
+)
+
+// serverMetrics are the metrics the server records, served at /metrics on the admin listener.
+type serverMetrics struct {
+	registry            *metrics.Registry
+	requests            *metrics.CounterVec[requestLabels]
+	requestDuration     *metrics.HistogramVec[backendLabels]
+	healthChecks        *metrics.CounterVec[healthCheckLabels]
+	healthCheckDuration *metrics.HistogramVec[backendLabels]
+	proxyErrors         *metrics.CounterVec[proxyErrorLabels]
+	retries             *metrics.CounterVec[appLabels]
+}
+
+// appLabels label the series of an app.
+type appLabels struct {
+	app string
+}
+
+func (labels appLabels) Labels() []metrics.Label {
+	return []metrics.Label{{Name: "app", Value: labels.app}}
+}
+
+// backendLabels label the series of one of an app's backends.
+type backendLabels struct {
+	app     string
+	backend string
+}
+
+func (labels backendLabels) Labels() []metrics.Label {
+	return []metrics.Label{{Name: "app", Value: labels.app}, {Name: "backend", Value: labels.backend}}
+}
+
+// requestLabels label lb_requests_total with the status class of the responses.
+type requestLabels struct {
+	backendLabels
+	code string
+}
+
+func (labels requestLabels) Labels() []metrics.Label {
+	return append(labels.backendLabels.Labels(), metrics.Label{Name: "code", Value: labels.code})
+}
+
+// healthCheckLabels label lb_health_checks_total with the result of the checks.
+type healthCheckLabels struct {
+	backendLabels
+	result string
+}
+
+func (labels healthCheckLabels) Labels() []metrics.Label {
+	return append(labels.backendLabels.Labels(), metrics.Label{Name: "result", Value: labels.result})
+}
+
+// proxyErrorLabels label lb_proxy_errors_total with the kind of error.
+type proxyErrorLabels struct {
+	app  string
+	kind string
+}
+
+func (labels proxyErrorLabels) Labels() []metrics.Label {
+	return []metrics.Label{{Name: "app", Value: labels.app}, {Name: "kind", Value: labels.kind}}
+}
+
+func newServerMetrics(server *Server) *serverMetrics {
+	registry := metrics.NewRegistry()
+
+	serverMetrics := &serverMetrics{
+		registry: registry,
+		requests: metrics.NewCounterVec[requestLabels](registry, "lb_requests_total",
+			"Requests proxied to a backend, by status class."),
+		requestDuration: metrics.NewHistogramVec[backendLabels](registry, "lb_request_duration_seconds",
+			"Time from sending a request to a backend until its response was fully written.", nil),
+		healthChecks: metrics.NewCounterVec[healthCheckLabels](registry, "lb_health_checks_total",
+			"Active health checks, by result."),
+		healthCheckDuration: metrics.NewHistogramVec[backendLabels](registry, "lb_health_check_duration_seconds",
+			"Time taken by active health checks.", nil),
+		proxyErrors: metrics.NewCounterVec[proxyErrorLabels](registry, "lb_proxy_errors_total",
+			"Requests that couldn't be proxied, by kind of error."),
+		retries: metrics.NewCounterVec[appLabels](registry, "lb_retries_total",
+			"Requests retried on another backend after a transport error."),
+	}
+
+	metrics.NewGaugeFunc(registry, "lb_backend_active_connections", "Requests in flight to a backend.",
+		func(emit func(backendLabels, float64)) {
+			server.eachBackend(func(app string, be *backend.Backend) {
+				emit(backendLabels{app, be.Url.String()}, float64(be.ActiveConnections()))
+			})
+		})
+
+	metrics.NewGaugeFunc(registry, "lb_backend_healthy", "Whether a backend passed its last active health check (1) or not (0).",
+		func(emit func(backendLabels, float64)) {
+			server.eachBackend(func(app string, be *backend.Backend) {
+				emit(backendLabels{app, be.Url.String()}, boolToFloat(be.PassedHealthCheck()))
+			})
+		})
+
+	metrics.NewGaugeFunc(registry, "lb_backend_ejected", "Whether outlier detection has ejected a backend (1) or not (0).",
+		func(emit func(backendLabels, float64)) {
+			server.eachBackend(func(app string, be *backend.Backend) {
+				emit(backendLabels{app, be.Url.String()}, boolToFloat(be.IsEjected()))
+			})
+		})
+
+	metrics.NewGaugeFunc(registry, "lb_backend_circuit_state", "State of a backend's circuit breaker: 0 closed, 1 open, 2 half-open.",
+		func(emit func(backendLabels, float64)) {
+			server.eachBackend(func(app string, be *backend.Backend) {
+				emit(backendLabels{app, be.Url.String()}, float64(be.CircuitState()))
+			})
+		})
+
+	return serverMetrics
+}
+
+func (sm *serverMetrics) observeRequest(app string, be *backend.Backend, status int, duration time.Duration) {
+	labels := backendLabels{app, be.Url.String()}
+
+	sm.requests.Inc(requestLabels{labels, strconv.Itoa(status/100) + "xx"})
+	sm.requestDuration.Observe(duration.Seconds(), labels)
+}
+
+// forgetBackend stops exporting the series of be, which has left app's load balancer, so instances that come and go
+// don't pile up in every scrape.
+func (sm *serverMetrics) forgetBackend(app string, be *backend.Backend) {
+	forgotten := backendLabels{app, be.Url.String()}
+
+	sm.requests.Delete(func(labels requestLabels) bool { return labels.backendLabels == forgotten })
+	sm.requestDuration.Delete(func(labels backendLabels) bool { return labels == forgotten })
+	sm.healthChecks.Delete(func(labels healthCheckLabels) bool { return labels.backendLabels == forgotten })
+	sm.healthCheckDuration.Delete(func(labels backendLabels) bool { return labels == forgotten })
+}
+
+// forgetApp stops exporting every series of an app that has been removed from the config.
+func (sm *serverMetrics) forgetApp(app string) {
+	sm.requests.Delete(func(labels requestLabels) bool { return labels.app == app })
+	sm.requestDuration.Delete(func(labels backendLabels) bool { return labels.app == app })
+	sm.healthChecks.Delete(func(labels healthCheckLabels) bool { return labels.app == app })
+	sm.healthCheckDuration.Delete(func(labels backendLabels) bool { return labels.app == app })
+	sm.proxyErrors.Delete(func(labels proxyErrorLabels) bool { return labels.app == app })
+	sm.retries.Delete(func(labels appLabels) bool { return labels.app == app })
+}
+
+func (sm *serverMetrics) proxyError(app string, kind string) {
+	sm.proxyErrors.Inc(proxyErrorLabels{app, kind})
+}
+
+func (sm *serverMetrics) retry(app string) {
+	sm.retries.Inc(appLabels{app})
+}
+
+// healthCheckObserver records the health checks of be, one of app's backends.
+func (sm *serverMetrics) healthCheckObserver(app string, be *backend.Backend) backend.HealthCheckObserver {
+	labels := backendLabels{app, be.Url.String()}
+
+	return func(passed bool, duration time.Duration) {
+		result := "failure"
+
+		if passed {
+			result = "success"
+		}
+
+		sm.healthChecks.Inc(healthCheckLabels{labels, result})
+		sm.healthCheckDuration.Observe(duration.Seconds(), labels)
+	}
+}
+
+// classifyProxyError sorts an error from the reverse proxy's transport into one of the proxy error kinds.
+func classifyProxyError(err error) string {
+	var netErr net.Error
+	var opErr *net.OpError
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return proxyErrorCanceled
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return proxyErrorTimeout
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return proxyErrorConnect
+	default:
+		return proxyErrorUpstream
+	}
+}
+
+// eachBackend calls fn for every backend of every app, including draining ones.
+func (server *Server) eachBackend(fn func(app string, be *backend.Backend)) {
+	for host, lb := range server.routes.Load().loadBalancers {
+		for _, be := range lb.GetBackends() {
+			fn(host, be)
+		}
+
+		for _, be := range lb.GetDrainingBackends() {
+			fn(host, be)
+		}
+	}
+}
+
+func boolToFloat(value bool) float64 {
+	if value {
+		return 1
+	}
+
+	return 0
+}
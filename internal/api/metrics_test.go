@@ -0,0 +1,212 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestClassifyProxyError(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"Client Canceled", context.Canceled, proxyErrorCanceled},
+		{"Deadline", context.DeadlineExceeded, proxyErrorTimeout},
+		{"Net Timeout", &net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}, proxyErrorTimeout},
+		{"Connection Refused", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, proxyErrorConnect},
+		{"Connection Reset", &net.OpError{Op: "read", Err: syscall.ECONNRESET}, proxyErrorUpstream},
+		{"Other", errors.New("malformed response"), proxyErrorUpstream},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			if actual := classifyProxyError(scenario.err); actual != scenario.expected {
+				t.Errorf("classifyProxyError(%v) = %v, expected %v", scenario.err, actual, scenario.expected)
+			}
+		})
+	}
+}
+
+func TestServer_Metrics(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer upstream.Close()
+
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	server, err := NewServer(0, writeConfig(t, fmt.Sprintf(`
+apps:
+  - host: app1.example.com
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 1h
+    instances:
+      - url: %v
+  - host: app2.example.com
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 1h
+    instances:
+      - url: %v`, upstream.URL, unreachable.URL)))
+
+	if err != nil {
+		t.Fatalf("NewServer() returned an unexpected error = %v", err)
+	}
+
+	for _, target := range []string{"http://app1.example.com/", "http://app1.example.com/missing", "http://app2.example.com/", "http://unknown.example.com/"} {
+		server.publicHandler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	server.routes.Load().loadBalancers["app1.example.com"].GetBackends()[0].CheckHealth()
+
+	recorder := httptest.NewRecorder()
+	server.adminHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	expected := []string{
+		fmt.Sprintf(`lb_requests_total{app="app1.example.com",backend="%v",code="2xx"} 1`, upstream.URL),
+		fmt.Sprintf(`lb_requests_total{app="app1.example.com",backend="%v",code="4xx"} 1`, upstream.URL),
+		fmt.Sprintf(`lb_requests_total{app="app2.example.com",backend="%v",code="5xx"} 1`, unreachable.URL),
+		fmt.Sprintf(`lb_request_duration_seconds_count{app="app1.example.com",backend="%v"} 2`, upstream.URL),
+		fmt.Sprintf(`lb_health_checks_total{app="app1.example.com",backend="%v",result="success"} 1`, upstream.URL),
+		fmt.Sprintf(`lb_health_check_duration_seconds_count{app="app1.example.com",backend="%v"} 1`, upstream.URL),
+		`lb_proxy_errors_total{app="",kind="unknown_host"} 1`,
+		`lb_proxy_errors_total{app="app2.example.com",kind="connect"} 1`,
+		fmt.Sprintf(`lb_backend_active_connections{app="app1.example.com",backend="%v"} 0`, upstream.URL),
+		fmt.Sprintf(`lb_backend_healthy{app="app1.example.com",backend="%v"} 1`, upstream.URL),
+		fmt.Sprintf(`lb_backend_ejected{app="app1.example.com",backend="%v"} 0`, upstream.URL),
+		fmt.Sprintf(`lb_backend_circuit_state{app="app1.example.com",backend="%v"} 0`, upstream.URL),
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(recorder.Body.String(), line+"\n") {
+			t.Errorf("Expected /metrics to contain %v, got:\n%v", line, recorder.Body.String())
+		}
+	}
+}
+
+func TestServer_Metrics_BackendState(t *testing.T) {
+	server, err := NewServer(0, writeConfig(t, `
+apps:
+  - host: app1.example.com
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 1h
+    outlier_detection:
+      consecutive_failures: 1
+    circuit_breaker:
+      min_requests: 1
+      cool_off: 1ms
+    instances:
+      - url: http://localhost:8080`))
+
+	if err != nil {
+		t.Fatalf("NewServer() returned an unexpected error = %v", err)
+	}
+
+	be := server.loadBalancer("app1.example.com").GetBackends()[0]
+	attempt, _ := be.TryAcquire()
+	attempt.RecordFailure()
+	time.Sleep(5 * time.Millisecond)
+
+	var body string
+
+	// The cool-off has passed, but scraping mustn't move the circuit to half-open.
+	for range 2 {
+		recorder := httptest.NewRecorder()
+		server.adminHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		body = recorder.Body.String()
+	}
+
+	expected := []string{
+		`lb_backend_healthy{app="app1.example.com",backend="http://localhost:8080"} 1`,
+		`lb_backend_ejected{app="app1.example.com",backend="http://localhost:8080"} 1`,
+		`lb_backend_circuit_state{app="app1.example.com",backend="http://localhost:8080"} 1`,
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected /metrics to contain %v, got:\n%v", line, body)
+		}
+	}
+}
+
+func TestServer_Metrics_ForgetsRemovedBackends(t *testing.T) {
+	var upstreams []*httptest.Server
+
+	for range 3 {
+		upstream := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+		defer upstream.Close()
+		upstreams = append(upstreams, upstream)
+	}
+
+	app1 := `
+  - host: app1.example.com
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 1h
+    strategy: %v
+    instances:
+      - url: %v
+      - url: %v`
+	app2 := `
+  - host: app2.example.com
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 1h
+    instances:
+      - url: %v`
+
+	pathToConfig := writeConfig(t, "apps:"+fmt.Sprintf(app1, "round_robin", upstreams[0].URL, upstreams[1].URL)+fmt.Sprintf(app2, upstreams[2].URL))
+	server, err := NewServer(0, pathToConfig)
+
+	if err != nil {
+		t.Fatalf("NewServer() returned an unexpected error = %v", err)
+	}
+
+	for _, target := range []string{"http://app1.example.com/", "http://app1.example.com/", "http://app2.example.com/"} {
+		server.publicHandler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	scrape := func() string {
+		recorder := httptest.NewRecorder()
+		server.adminHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		return recorder.Body.String()
+	}
+
+	// Removed through the admin API.
+	_ = server.loadBalancer("app1.example.com").RemoveBackend(upstreams[1].URL)
+
+	if body := scrape(); strings.Contains(body, upstreams[1].URL) || !strings.Contains(body, upstreams[0].URL) {
+		t.Errorf("Expected only the removed backend's series to be dropped, got:\n%v", body)
+	}
+
+	// app1 is rebuilt without its first instance and app2 is removed.
+	rewriteConfig(t, pathToConfig, "apps:"+fmt.Sprintf(app1, "least_connections", upstreams[1].URL, upstreams[2].URL))
+
+	if err := server.reload(context.Background()); err != nil {
+		t.Fatalf("reload() returned an unexpected error = %v", err)
+	}
+
+	body := scrape()
+
+	for _, dropped := range []string{upstreams[0].URL, `app="app2.example.com"`} {
+		if strings.Contains(body, dropped) {
+			t.Errorf("Expected the series of %v to be dropped, got:\n%v", dropped, body)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package api
+
+import (
+	"context"
+	"load-balancer/internal/backend"
+	"load-balancer/internal/balancer"
+	"load-balancer/internal/config"
+	"log/slog"
+	"maps"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"syscall"
+	"time"
+)
+
+// configPollInterval is how often the config file is checked for changes.
+const configPollInterval = 2 * time.Second
+
+// watchConfig reloads the config on SIGHUP and whenever the modification time of the file, or of an app's upstream TLS
+// files, changes, until ctx is done.
+func (server *Server) watchConfig(ctx context.Context) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	lastModified := modTime(server.pathToConfig)
+	upstreamTlsModified := server.upstreamTlsModTimes()
+
+	for {
+		select {
+		case <-hangups:
+			lastModified = modTime(server.pathToConfig)
+			server.reloadAndLog(ctx, "SIGHUP")
+			upstreamTlsModified = server.upstreamTlsModTimes()
+		case <-ticker.C:
+			if modified := modTime(server.pathToConfig); !modified.Equal(lastModified) {
+				lastModified = modified
+				server.reloadAndLog(ctx, "file change")
+				upstreamTlsModified = server.upstreamTlsModTimes()
+			}
+
+			if err := server.certificates.Reload(); err != nil {
+				slog.Error("certificate reload failed, keeping the previous certificates", "error", err)
+			}
+
+			// A rotated upstream CA bundle or client certificate is picked up by rebuilding the app's transport.
+			if modified := server.upstreamTlsModTimes(); !maps.EqualFunc(modified, upstreamTlsModified, time.Time.Equal) {
+				upstreamTlsModified = modified
+				server.reloadAndLog(ctx, "upstream TLS file change")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (server *Server) reloadAndLog(ctx context.Context, reason string) {
+	if err := server.reload(ctx); err != nil {
+		slog.Error("config reload failed, keeping the running config", "reason", reason, "error", err)
+		return
+	}
+
+	slog.Info("config reloaded", "reason", reason)
+}
+
+// reload rebuilds the routes from the config file and swaps them in. Load balancers that were replaced or removed
+// have their health checks stopped once nothing new can be routed to them; requests already in flight finish
+// normally. A replaced load balancer keeps the instances added, removed and drained through the admin API, and takes
+// over the drains still in progress. An invalid config leaves the running routes untouched.
+func (server *Server) reload(ctx context.Context) error {
+	server.reloadMutex.Lock()
+	defer server.reloadMutex.Unlock()
+
+	lbConfig, err := config.LoadConfig(server.pathToConfig)
+
+	if err != nil {
+		return err
+	}
+
+	previous := server.routes.Load()
+	next, err := buildRoutes(lbConfig, previous, server.metrics)
+
+	if err != nil {
+		return err
+	}
+
+	if err = server.certificates.Set(certificateFiles(lbConfig)); err != nil {
+		return err
+	}
+
+	if server.acme != nil {
+		server.acme.SetHosts(acmeHosts(lbConfig))
+	}
+
+	for host, lb := range next.loadBalancers {
+		if previous.loadBalancers[host] == lb {
+			continue
+		}
+
+		if previous.loadBalancers[host] != nil {
+			lb.TakeOverDraining(previous.loadBalancers[host])
+		}
+
+		lb.StartHealthChecks(ctx)
+	}
+
+	server.routes.Store(next)
+
+	for host, lb := range previous.loadBalancers {
+		if next.loadBalancers[host] == lb {
+			continue
+		}
+
+		lb.StopHealthChecks()
+
+		if next.loadBalancers[host] == nil {
+			server.metrics.forgetApp(host)
+			continue
+		}
+
+		for _, be := range retiredBackends(lb, next.loadBalancers[host]) {
+			server.metrics.forgetBackend(host, be)
+		}
+	}
+
+	for host, up := range previous.upstreams {
+		if next.upstreams[host] != up {
+			up.transport.CloseIdleConnections()
+		} else if next.loadBalancers[host] != previous.loadBalancers[host] {
+			up.prune(next.loadBalancers[host])
+		}
+	}
+
+	return nil
+}
+
+// reusableBackends returns the backends of the app's current load balancer keyed by URL, provided nothing that
+// shapes a backend (health checks, timeouts, transport, upstream TLS, outlier detection, circuit breaker) has changed.
+// Changes to anything else, such as the strategy, retries or request timeouts, don't affect backends, so they can
+// still be carried over.
+func (previous *routes) reusableBackends(app *config.ApplicationConfig) map[string]*backend.Backend {
+	if previous == nil || previous.apps[app.Host] == nil || !backendSettingsEqual(previous.apps[app.Host], app) {
+		return nil
+	}
+
+	reusable := map[string]*backend.Backend{}
+
+	for _, be := range previous.loadBalancers[app.Host].GetBackends() {
+		reusable[be.Url.String()] = be
+	}
+
+	return reusable
+}
+
+// withRuntimeChanges returns the app with the instance changes made through the admin API since the app's current
+// load balancer was built applied to it, so rebuilding the load balancer doesn't undo them. Instances the old config
+// listed that have since been removed or are draining stay out, and instances added at runtime stay in unless the new
+// config lists them itself. Instances the new config drops are dropped as usual.
+func (previous *routes) withRuntimeChanges(app *config.ApplicationConfig) *config.ApplicationConfig {
+	if previous == nil || previous.apps[app.Host] == nil {
+		return app
+	}
+
+	lb := previous.loadBalancers[app.Host]
+	configured := map[string]bool{}
+
+	for _, instance := range previous.apps[app.Host].Instances {
+		configured[instance.Url] = true
+	}
+
+	inRotation := map[string]*backend.Backend{}
+
+	for _, be := range lb.GetBackends() {
+		inRotation[be.Url.String()] = be
+	}
+
+	draining := map[string]bool{}
+
+	for _, be := range lb.GetDrainingBackends() {
+		draining[be.Url.String()] = true
+	}
+
+	var instances []*config.InstanceConfig
+	listed := map[string]bool{}
+
+	for _, instance := range app.Instances {
+		listed[instance.Url] = true
+
+		if draining[instance.Url] || configured[instance.Url] && inRotation[instance.Url] == nil {
+			continue
+		}
+
+		instances = append(instances, instance)
+	}
+
+	for _, be := range lb.GetBackends() {
+		if rawUrl := be.Url.String(); !configured[rawUrl] && !listed[rawUrl] {
+			instances = append(instances, &config.InstanceConfig{Url: rawUrl, Weight: be.Weight()})
+		}
+	}
+
+	withChanges := *app
+	withChanges.Instances = instances
+
+	return &withChanges
+}
+
+// retiredBackends returns the backends of previous whose URL isn't served by next, the load balancer replacing it.
+// A backend rebuilt under the same URL isn't retired, since it carries on the same series of requests.
+func retiredBackends(previous *balancer.LoadBalancer, next *balancer.LoadBalancer) []*backend.Backend {
+	served := map[string]bool{}
+
+	for _, be := range slices.Concat(next.GetBackends(), next.GetDrainingBackends()) {
+		served[be.Url.String()] = true
+	}
+
+	var retired []*backend.Backend
+
+	for _, be := range slices.Concat(previous.GetBackends(), previous.GetDrainingBackends()) {
+		if !served[be.Url.String()] {
+			retired = append(retired, be)
+		}
+	}
+
+	return retired
+}
+
+// reusableUpstream returns the app's current upstream, provided its transport and upstream TLS settings haven't
+// changed, and neither have the upstream TLS files on disk, so connections to its instances survive a reload.
+func (previous *routes) reusableUpstream(app *config.ApplicationConfig) *upstream {
+	if previous == nil || previous.apps[app.Host] == nil {
+		return nil
+	}
+
+	current, up := previous.apps[app.Host], previous.upstreams[app.Host]
+
+	if !reflect.DeepEqual(current.UpstreamTls, app.UpstreamTls) || !reflect.DeepEqual(current.Transport, app.Transport) {
+		return nil
+	}
+
+	if !up.tlsModified.Equal(upstreamTlsModTime(app.UpstreamTls)) {
+		return nil
+	}
+
+	return up
+}
+
+// upstreamTlsModTimes is the upstream TLS files' modification time of every app that has any, keyed by host.
+func (server *Server) upstreamTlsModTimes() map[string]time.Time {
+	modified := map[string]time.Time{}
+
+	for host, app := range server.routes.Load().apps {
+		if app.UpstreamTls != nil {
+			modified[host] = upstreamTlsModTime(app.UpstreamTls)
+		}
+	}
+
+	return modified
+}
+
+// backendSettingsEqual reports whether a and b build their backends the same way. It compares only the settings a
+// backend is built from, so a new setting that doesn't shape backends can't cost them their state on reload.
+func backendSettingsEqual(a *config.ApplicationConfig, b *config.ApplicationConfig) bool {
+	return a.HealthUri == b.HealthUri &&
+		a.Timeout == b.Timeout &&
+		a.HealthCheckCooldown == b.HealthCheckCooldown &&
+		reflect.DeepEqual(a.HealthCheck, b.HealthCheck) &&
+		reflect.DeepEqual(a.OutlierDetection, b.OutlierDetection) &&
+		reflect.DeepEqual(a.CircuitBreaker, b.CircuitBreaker) &&
+		reflect.DeepEqual(a.Transport, b.Transport) &&
+		reflect.DeepEqual(a.UpstreamTls, b.UpstreamTls)
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
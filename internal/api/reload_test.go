@@ -0,0 +1,384 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const reloadBaseConfig = `
+apps:
+  - host: app1.example.com
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 1h
+    instances:
+      - url: http://localhost:8080
+      - url: http://localhost:8081
+  - host: app2.example.com
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 1h
+    instances:
+      - url: http://localhost:9090`
+
+func TestServer_Reload(t *testing.T) {
+	pathToConfig := writeConfig(t, reloadBaseConfig)
+	server, err := NewServer(0, pathToConfig)
+
+	if err != nil {
+		t.Fatalf("NewServer() returned an unexpected error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	before := server.routes.Load()
+	kept := before.loadBalancers["app1.example.com"].GetBackends()[0]
+	kept.AddConnection()
+
+	// app1 drops an instance, changes strategy and adds one; app2 is removed; app3 is new.
+	rewriteConfig(t, pathToConfig, `
+apps:
+  - host: app1.example.com
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 1h
+    strategy: least_connections
+    instances:
+      - url: http://localhost:8080
+      - url: http://localhost:8082
+  - host: app3.example.com
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 1h
+    instances:
+      - url: http://localhost:7070`)
+
+	if err := server.reload(ctx); err != nil {
+		t.Fatalf("reload() returned an unexpected error = %v", err)
+	}
+
+	after := server.routes.Load()
+
+	if server.loadBalancer("app2.example.com") != nil {
+		t.Errorf("Expected app2 to be removed")
+	}
+
+	if server.loadBalancer("app3.example.com") == nil {
+		t.Errorf("Expected app3 to be added")
+	}
+
+	app1 := after.loadBalancers["app1.example.com"]
+
+	if app1 == before.loadBalancers["app1.example.com"] {
+		t.Fatalf("Expected app1 to get a new load balancer for its new strategy")
+	}
+
+	if len(app1.GetBackends()) != 2 || app1.GetBackends()[0] != kept || app1.GetBackends()[1].Url.String() != "http://localhost:8082" {
+		t.Errorf("Expected app1 to keep the 8080 backend and add 8082, got %v", app1.GetBackends())
+	}
+
+	if kept.ActiveConnections() != 1 {
+		t.Errorf("Expected the kept backend to keep its connection count, got %v", kept.ActiveConnections())
+	}
+}
+
+func TestServer_Reload_UnchangedAppKeepsLoadBalancer(t *testing.T) {
+	pathToConfig := writeConfig(t, reloadBaseConfig)
+	server, _ := NewServer(0, pathToConfig)
+	before := server.routes.Load()
+
+	rewriteConfig(t, pathToConfig, reloadBaseConfig+`
+  - host: app3.example.com
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 1h
+    instances:
+      - url: http://localhost:7070`)
+
+	if err := server.reload(context.Background()); err != nil {
+		t.Fatalf("reload() returned an unexpected error = %v", err)
+	}
+
+	for _, host := range []string{"app1.example.com", "app2.example.com"} {
+		if server.loadBalancer(host) != before.loadBalancers[host] {
+			t.Errorf("Expected %v to keep its load balancer", host)
+		}
+	}
+}
+
+func TestServer_Reload_ChangedHealthCheckRebuildsBackends(t *testing.T) {
+	pathToConfig := writeConfig(t, reloadBaseConfig)
+	server, _ := NewServer(0, pathToConfig)
+	before := server.loadBalancer("app2.example.com").GetBackends()[0]
+
+	rewriteConfig(t, pathToConfig, `
+apps:
+  - host: app2.example.com
+    health_uri: /ready
+    timeout: 5s
+    health_check_cooldown: 1h
+    instances:
+      - url: http://localhost:9090`)
+
+	if err := server.reload(context.Background()); err != nil {
+		t.Fatalf("reload() returned an unexpected error = %v", err)
+	}
+
+	if server.loadBalancer("app2.example.com").GetBackends()[0] == before {
+		t.Errorf("Expected a new backend once its health check changed")
+	}
+}
+
+func TestServer_Reload_FrontendChangeKeepsBackends(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t, "app2.example.com")
+	tlsSettings := fmt.Sprintf(`
+    tls:
+      cert_file: %v
+      key_file: %v`, certFile, keyFile)
+
+	// Each scenario appends settings to app2, the last app of the base config, before and after the reload.
+	scenarios := []struct {
+		name   string
+		before string
+		after  string
+	}{
+		{"Retry", "", `
+    retry:
+      max_retries: 2
+      budget: 2s`},
+		{"Request Timeout", "", `
+    request_timeout:
+      timeout: 30s
+      routes:
+        - path_prefix: /slow
+          timeout: 2m`},
+		{"Client Auth", tlsSettings, tlsSettings + fmt.Sprintf(`
+    client_auth:
+      ca_file: %v
+      mode: optional`, certFile)},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			pathToConfig := writeConfig(t, reloadBaseConfig+scenario.before)
+			server, err := NewServer(0, pathToConfig)
+
+			if err != nil {
+				t.Fatalf("NewServer() returned an unexpected error = %v", err)
+			}
+
+			before := server.loadBalancer("app2.example.com").GetBackends()
+			before[0].AddConnection()
+
+			rewriteConfig(t, pathToConfig, reloadBaseConfig+scenario.after)
+
+			if err := server.reload(context.Background()); err != nil {
+				t.Fatalf("reload() returned an unexpected error = %v", err)
+			}
+
+			if after := server.loadBalancer("app2.example.com").GetBackends(); !slices.Equal(after, before) {
+				t.Fatalf("Expected app2 to keep its backends %v, got %v", before, after)
+			}
+
+			if before[0].ActiveConnections() != 1 {
+				t.Errorf("Expected the request in flight to still be counted, got %v", before[0].ActiveConnections())
+			}
+		})
+	}
+}
+
+func TestServer_Reload_RetryChangeKeepsBackendState(t *testing.T) {
+	const appConfig = `
+apps:
+  - host: app1.example.com
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 1h
+    outlier_detection:
+      consecutive_failures: 1
+      base_ejection_time: 1h
+    instances:
+      - url: http://localhost:8080
+      - url: http://localhost:8081`
+	pathToConfig := writeConfig(t, appConfig)
+	server, _ := NewServer(0, pathToConfig)
+	backends := server.loadBalancer("app1.example.com").GetBackends()
+
+	// 8080 is ejected with a request in flight and 8081 failed its health check.
+	backends[0].AddConnection()
+	attempt, _ := backends[0].TryAcquire()
+	attempt.RecordFailure()
+	backends[1].SetHealth(false)
+
+	rewriteConfig(t, pathToConfig, appConfig+`
+    retry:
+      max_retries: 3`)
+
+	if err := server.reload(context.Background()); err != nil {
+		t.Fatalf("reload() returned an unexpected error = %v", err)
+	}
+
+	after := server.loadBalancer("app1.example.com").GetBackends()
+
+	if !slices.Equal(after, backends) {
+		t.Fatalf("Expected app1 to keep its backends %v, got %v", backends, after)
+	}
+
+	if !after[0].IsEjected() || after[0].ActiveConnections() != 1 {
+		t.Errorf("Expected 8080 to stay ejected with its request in flight")
+	}
+
+	if after[1].IsHealthy() {
+		t.Errorf("Expected 8081 to stay unhealthy until its health check passes")
+	}
+}
+
+func TestServer_Reload_KeepsAdminChanges(t *testing.T) {
+	pathToConfig := writeConfig(t, `
+apps:
+  - host: app1.example.com
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 1h
+    instances:
+      - url: http://localhost:8080
+      - url: http://localhost:8081
+      - url: http://localhost:8082`)
+	server, _ := NewServer(0, pathToConfig)
+	before := server.loadBalancer("app1.example.com")
+
+	// 8080 stays, 8081 is removed, 8082 is draining with a request in flight and 8090 is added.
+	draining := before.GetBackends()[2]
+	draining.AddConnection()
+
+	requests := []struct {
+		handler http.HandlerFunc
+		request *http.Request
+	}{
+		{server.handleRemoveInstance, httptest.NewRequest(http.MethodDelete, "/api/v1/loadBalancers/app1.example.com/instances?url=http://localhost:8081", nil)},
+		{server.handleDrainInstance, httptest.NewRequest(http.MethodPost, "/api/v1/loadBalancers/app1.example.com/instances/drain?url=http://localhost:8082&timeout=1h", nil)},
+		{server.handleAddInstance, httptest.NewRequest(http.MethodPost, "/api/v1/loadBalancers/app1.example.com/instances", strings.NewReader(`{"url": "http://localhost:8090", "weight": 2}`))},
+	}
+
+	for _, admin := range requests {
+		admin.request.SetPathValue("host", "app1.example.com")
+		recorder := httptest.NewRecorder()
+		admin.handler(recorder, admin.request)
+
+		if recorder.Code >= http.StatusBadRequest {
+			t.Fatalf("%v %v status = %v: %v", admin.request.Method, admin.request.URL, recorder.Code, recorder.Body)
+		}
+	}
+
+	// A strategy change rebuilds the load balancer from the config.
+	rewriteConfig(t, pathToConfig, `
+apps:
+  - host: app1.example.com
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 1h
+    strategy: least_connections
+    instances:
+      - url: http://localhost:8080
+      - url: http://localhost:8081
+      - url: http://localhost:8082`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := server.reload(ctx); err != nil {
+		t.Fatalf("reload() returned an unexpected error = %v", err)
+	}
+
+	after := server.loadBalancer("app1.example.com")
+
+	if after == before {
+		t.Fatalf("Expected app1 to get a new load balancer for its new strategy")
+	}
+
+	var urls []string
+
+	for _, be := range after.GetBackends() {
+		urls = append(urls, be.Url.String())
+	}
+
+	if !slices.Equal(urls, []string{"http://localhost:8080", "http://localhost:8090"}) {
+		t.Errorf("Expected 8080 and the added 8090 in rotation, got %v", urls)
+	}
+
+	if added := after.GetBackends()[len(after.GetBackends())-1]; added.Weight() != 2 {
+		t.Errorf("Expected the added instance to keep weight 2, got %v", added.Weight())
+	}
+
+	if len(after.GetDrainingBackends()) != 1 || after.GetDrainingBackends()[0] != draining {
+		t.Fatalf("Expected the new load balancer to take over draining 8082, got %v", after.GetDrainingBackends())
+	}
+
+	if len(before.GetDrainingBackends()) != 0 {
+		t.Errorf("Expected the old load balancer to hand over its drain")
+	}
+
+	draining.ReleaseConnection()
+	time.Sleep(300 * time.Millisecond)
+
+	if len(after.GetDrainingBackends()) != 0 {
+		t.Errorf("Expected the drain to finish on the new load balancer")
+	}
+}
+
+func TestServer_Reload_InvalidConfigKeepsRunningRoutes(t *testing.T) {
+	scenarios := []struct {
+		name   string
+		config string
+	}{
+		{"Invalid YAML", "apps: [unclosed"},
+		{"Invalid Timeout", `
+apps:
+  - host: app1.example.com
+    health_uri: /health
+    timeout: soon
+    health_check_cooldown: 1h
+    instances:
+      - url: http://localhost:8080`},
+		{"Invalid Instance", `
+apps:
+  - host: app1.example.com
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 1h
+    instances:
+      - url: localhost:8080`},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			pathToConfig := writeConfig(t, reloadBaseConfig)
+			server, _ := NewServer(0, pathToConfig)
+			before := server.routes.Load()
+
+			rewriteConfig(t, pathToConfig, scenario.config)
+
+			if err := server.reload(context.Background()); err == nil {
+				t.Fatalf("reload() should have returned an error")
+			}
+
+			if server.routes.Load() != before {
+				t.Errorf("Expected the running routes to be kept")
+			}
+		})
+	}
+}
+
+func rewriteConfig(t *testing.T, pathToConfig string, contents string) {
+	if err := os.WriteFile(pathToConfig, []byte(contents), 0o600); err != nil {
+		t.Fatalf("Error rewriting config: %v", err)
+	}
+}
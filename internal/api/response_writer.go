@@ -0,0 +1,55 @@
+package api
+
+import "net/http"
+
+// responseRecorder wraps the client's ResponseWriter to remember the status code and number of body bytes sent back,
+// so the proxy can tell whether the backend failed the request and log the response. Unwrap lets
+// http.ResponseController reach the underlying writer for flushing streamed responses and hijacking upgraded
+// connections.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w}
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	// Informational responses such as 103 Early Hints are followed by the real one, except for protocol upgrades.
+	if rec.status == 0 && (status >= http.StatusOK || status == http.StatusSwitchingProtocols) {
+		rec.status = status
+	}
+
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+
+	return n, err
+}
+
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// Status is the status code written so far, or 200 if nothing has been written.
+func (rec *responseRecorder) Status() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+
+	return rec.status
+}
+
+// Bytes is the number of body bytes written so far.
+func (rec *responseRecorder) Bytes() int64 {
+	return rec.bytes
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseRecorder_Status(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		write    func(w http.ResponseWriter)
+		expected int
+	}{
+		{"Nothing Written", func(w http.ResponseWriter) {}, http.StatusOK},
+		{"Implicit OK", func(w http.ResponseWriter) { _, _ = w.Write([]byte("hello")) }, http.StatusOK},
+		{"Explicit Status", func(w http.ResponseWriter) { w.WriteHeader(http.StatusBadGateway) }, http.StatusBadGateway},
+		{"Only First Status Counts", func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.WriteHeader(http.StatusOK)
+		}, http.StatusServiceUnavailable},
+		{"Informational Status Skipped", func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusEarlyHints)
+			w.WriteHeader(http.StatusInternalServerError)
+		}, http.StatusInternalServerError},
+		{"Protocol Upgrade", func(w http.ResponseWriter) { w.WriteHeader(http.StatusSwitchingProtocols) }, http.StatusSwitchingProtocols},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			rec := newResponseRecorder(httptest.NewRecorder())
+
+			scenario.write(rec)
+
+			if rec.Status() != scenario.expected {
+				t.Errorf("Status() = %v, expected %v", rec.Status(), scenario.expected)
+			}
+		})
+	}
+}
+
+func TestResponseRecorder_Bytes(t *testing.T) {
+	rec := newResponseRecorder(httptest.NewRecorder())
+
+	_, _ = rec.Write([]byte("hello, "))
+	_, _ = rec.Write([]byte("world"))
+
+	if rec.Bytes() != 12 {
+		t.Errorf("Bytes() = %v, expected 12", rec.Bytes())
+	}
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"load-balancer/internal/config"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultMaxRetries   = 1
+	defaultMaxBodyBytes = 64 << 10
+)
+
+// idempotencyKeyHeader marks a request as safe to send more than once, whatever its method.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// retryPolicy decides whether a request whose transport failed before any response arrived may be sent to another
+// backend.
+type retryPolicy struct {
+	maxRetries   int
+	budget       time.Duration
+	maxBodyBytes int64
+	methods      map[string]bool
+}
+
+func buildRetryPolicy(retry *config.RetryConfig) (*retryPolicy, error) {
+	policy := &retryPolicy{
+		maxRetries:   defaultMaxRetries,
+		maxBodyBytes: defaultMaxBodyBytes,
+		methods:      map[string]bool{http.MethodGet: true, http.MethodHead: true, http.MethodOptions: true},
+	}
+
+	if retry == nil {
+		return policy, nil
+	}
+
+	budget, err := parseOptionalDuration(retry.Budget)
+
+	if err != nil {
+		return nil, err
+	}
+
+	policy.maxRetries = retry.MaxRetries
+	policy.budget = budget
+
+	if retry.MaxBodyBytes > 0 {
+		policy.maxBodyBytes = retry.MaxBodyBytes
+	}
+
+	for _, method := range retry.Methods {
+		policy.methods[method] = true
+	}
+
+	return policy, nil
+}
+
+// retryable reports whether r is safe to send again: its method is idempotent or listed in the policy, or the client
+// sent an Idempotency-Key.
+func (policy *retryPolicy) retryable(r *http.Request) bool {
+	return policy.maxRetries > 0 && (policy.methods[r.Method] || r.Header.Get(idempotencyKeyHeader) != "")
+}
+
+// allowsRetry reports whether another attempt may be made after retries retries of a request that started at start.
+func (policy *retryPolicy) allowsRetry(retries int, start time.Time) bool {
+	return retries < policy.maxRetries && (policy.budget <= 0 || time.Since(start) < policy.budget)
+}
+
+// bufferBody reads r's body into memory so it can be replayed, returning a function that rewinds it for the next
+// attempt. When the body is larger than limit it is left to stream and ok is false; the request can't be retried.
+func bufferBody(r *http.Request, limit int64) (rewind func(), ok bool, err error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return func() {}, true, nil
+	}
+
+	if r.ContentLength > limit {
+		return nil, false, nil
+	}
+
+	original := r.Body
+	buffered, err := io.ReadAll(io.LimitReader(original, limit+1))
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	if int64(len(buffered)) > limit {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buffered), original), original}
+
+		return nil, false, nil
+	}
+
+	_ = original.Close()
+
+	rewind = func() {
+		r.Body = io.NopCloser(bytes.NewReader(buffered))
+	}
+
+	rewind()
+
+	return rewind, true, nil
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"load-balancer/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_Retryable(t *testing.T) {
+	scenarios := []struct {
+		name           string
+		retry          *config.RetryConfig
+		method         string
+		idempotencyKey string
+		expected       bool
+	}{
+		{"GET is retried by default", nil, http.MethodGet, "", true},
+		{"HEAD is retried by default", nil, http.MethodHead, "", true},
+		{"POST is not retried by default", nil, http.MethodPost, "", false},
+		{"POST with an Idempotency-Key is retried", nil, http.MethodPost, "abc", true},
+		{"configured methods are retried", &config.RetryConfig{MaxRetries: 1, Methods: []string{http.MethodPut}}, http.MethodPut, "", true},
+		{"configured methods add to the defaults", &config.RetryConfig{MaxRetries: 1, Methods: []string{http.MethodPut}}, http.MethodGet, "", true},
+		{"max_retries 0 disables retries", &config.RetryConfig{MaxRetries: 0}, http.MethodGet, "abc", false},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			policy, err := buildRetryPolicy(scenario.retry)
+
+			if err != nil {
+				t.Fatalf("buildRetryPolicy() returned an unexpected error = %v", err)
+			}
+
+			r := httptest.NewRequest(scenario.method, "/", nil)
+
+			if scenario.idempotencyKey != "" {
+				r.Header.Set(idempotencyKeyHeader, scenario.idempotencyKey)
+			}
+
+			if actual := policy.retryable(r); actual != scenario.expected {
+				t.Errorf("retryable() = %v, expected %v", actual, scenario.expected)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_AllowsRetry(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		policy   *retryPolicy
+		retries  int
+		elapsed  time.Duration
+		expected bool
+	}{
+		{"first retry", &retryPolicy{maxRetries: 2}, 0, 0, true},
+		{"retries exhausted", &retryPolicy{maxRetries: 2}, 2, 0, false},
+		{"within budget", &retryPolicy{maxRetries: 2, budget: time.Minute}, 1, time.Second, true},
+		{"budget spent", &retryPolicy{maxRetries: 2, budget: time.Second}, 1, time.Minute, false},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			if actual := scenario.policy.allowsRetry(scenario.retries, time.Now().Add(-scenario.elapsed)); actual != scenario.expected {
+				t.Errorf("allowsRetry() = %v, expected %v", actual, scenario.expected)
+			}
+		})
+	}
+}
+
+func TestBufferBody(t *testing.T) {
+	scenarios := []struct {
+		name       string
+		body       string
+		limit      int64
+		expectedOk bool
+	}{
+		{"empty body", "", 4, true},
+		{"body within the limit", "abcd", 4, true},
+		{"body over the limit", "abcdef", 4, false},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(scenario.body))
+			r.ContentLength = -1
+
+			rewind, ok, err := bufferBody(r, scenario.limit)
+
+			if err != nil {
+				t.Fatalf("bufferBody() returned an unexpected error = %v", err)
+			}
+
+			if ok != scenario.expectedOk {
+				t.Fatalf("bufferBody() ok = %v, expected %v", ok, scenario.expectedOk)
+			}
+
+			read, _ := io.ReadAll(r.Body)
+
+			if string(read) != scenario.body {
+				t.Errorf("Expected body %q, got %q", scenario.body, read)
+			}
+
+			if !ok {
+				return
+			}
+
+			rewind()
+			read, _ = io.ReadAll(r.Body)
+
+			if string(read) != scenario.body {
+				t.Errorf("Expected rewound body %q, got %q", scenario.body, read)
+			}
+		})
+	}
+}
+
+func TestServer_HandleProxy_Retries(t *testing.T) {
+	var mutex sync.Mutex
+	var received []string
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		mutex.Lock()
+		received = append(received, string(body))
+		mutex.Unlock()
+	}))
+	defer upstream.Close()
+
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	// Round robin starts at the unreachable instance, so every request's first attempt fails.
+	scenarios := []struct {
+		name           string
+		method         string
+		body           string
+		idempotencyKey string
+		expectedStatus int
+	}{
+		{"GET is retried", http.MethodGet, "", "", http.StatusOK},
+		{"POST is not retried", http.MethodPost, "payload", "", http.StatusBadGateway},
+		{"POST with an Idempotency-Key is replayed", http.MethodPost, "payload", "abc", http.StatusOK},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			server, err := NewServer(0, writeConfig(t, fmt.Sprintf(`
+apps:
+  - host: app.example.com
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 1h
+    strategy: round_robin
+    instances:
+      - url: %v
+      - url: %v`, unreachable.URL, upstream.URL)))
+
+			if err != nil {
+				t.Fatalf("NewServer() returned an unexpected error = %v", err)
+			}
+
+			received = nil
+			r := httptest.NewRequest(scenario.method, "http://app.example.com/", strings.NewReader(scenario.body))
+
+			if scenario.idempotencyKey != "" {
+				r.Header.Set(idempotencyKeyHeader, scenario.idempotencyKey)
+			}
+
+			recorder := httptest.NewRecorder()
+			server.publicHandler().ServeHTTP(recorder, r)
+
+			if recorder.Code != scenario.expectedStatus {
+				t.Fatalf("Expected status %v, got %v", scenario.expectedStatus, recorder.Code)
+			}
+
+			if scenario.expectedStatus == http.StatusOK && (len(received) != 1 || received[0] != scenario.body) {
+				t.Errorf("Expected the live instance to receive %q once, got %q", scenario.body, received)
+			}
+		})
+	}
+}
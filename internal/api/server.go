@@ -4,19 +4,77 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"load-balancer/internal/accesslog"
 	"load-balancer/internal/backend"
 	"load-balancer/internal/balancer"
+	"load-balancer/internal/certificate"
 	"load-balancer/internal/config"
-	"log"
+	"net"
 	"net/http"
 	"os/signal"
+	"reflect"
+	"regexp"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
+var ErrInvalidInitialState = errors.New("initial state must be healthy or unhealthy")
+
+// DefaultShutdownTimeout is how long in-flight requests are given to finish when the server is stopped.
+const DefaultShutdownTimeout = 5 * time.Second
+
+// DefaultAdminAddress keeps the admin API off the network unless it is configured otherwise.
+const DefaultAdminAddress = "127.0.0.1:9000"
+
 type Server struct {
+	routes          atomic.Pointer[routes]
+	address         string
+	adminAddress    string
+	tlsAddress      string
+	redirectHttp    bool
+	certificates    *certificate.Store
+	acme            *certificate.AcmeManager
+	challenges      *certificate.Http01Solver
+	shutdownTimeout time.Duration
+	pathToConfig    string
+	// reloadMutex serializes reloads with instance changes made through the admin API, so a reload never rebuilds a
+	// load balancer from a change that is only half applied.
+	reloadMutex     sync.Mutex
+	metrics         *serverMetrics
+	accessLog       *accesslog.Logger
+	accessLogCloser io.Closer
+}
+
+// Options configures a Server. Only ConfigPath is required.
+type Options struct {
+	// ConfigPath is the path of the YAML config file.
+	ConfigPath string
+	// Address is the address the proxy listens on, ":8080" by default.
+	Address string
+	// AdminAddress is the address the report and instance management API is served on, either host:port or
+	// unix:/path/to/socket. It overrides the config's admin address, and defaults to DefaultAdminAddress.
+	AdminAddress string
+	// TlsAddress is the address HTTPS is served on. It overrides the config's TLS address, and defaults to
+	// DefaultTlsAddress when the config sets up TLS; HTTPS is off otherwise.
+	TlsAddress string
+	// ShutdownTimeout is how long in-flight requests are given to finish on shutdown, DefaultShutdownTimeout by
+	// default.
+	ShutdownTimeout time.Duration
+}
+
+// routes is everything the proxy needs to route a request. It is built from one version of the config and swapped
+// as a whole when the config is reloaded, so a request never sees half of an update.
+type routes struct {
 	loadBalancers map[string]*balancer.LoadBalancer
-	port          int
+	apps          map[string]*config.ApplicationConfig
+	retryPolicies map[string]*retryPolicy
+	upstreams     map[string]*upstream
+	timeouts      map[string]*requestTimeout
+	// clientAuths is keyed by lowercase host, to be looked up by TLS server name.
+	clientAuths map[string]*clientAuth
 }
 
 func NewServerDefaultPort(pathToConfig string) (*Server, error) {
@@ -24,113 +82,516 @@ func NewServerDefaultPort(pathToConfig string) (*Server, error) {
 }
 
 func NewServer(port int, pathToConfig string) (*Server, error) {
-	lbs, err := buildLoadBalancers(pathToConfig)
+	if port == 0 {
+		port = 8080
+	}
+
+	return NewServerWithOptions(Options{ConfigPath: pathToConfig, Address: fmt.Sprintf(":%d", port)})
+}
+
+func NewServerWithOptions(options Options) (*Server, error) {
+	lbConfig, err := config.LoadConfig(options.ConfigPath)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if port == 0 {
-		port = 8080
+	if options.Address == "" {
+		options.Address = ":8080"
+	}
+
+	if options.AdminAddress == "" && lbConfig.Admin != nil {
+		options.AdminAddress = lbConfig.Admin.Address
+	}
+
+	if options.AdminAddress == "" {
+		options.AdminAddress = DefaultAdminAddress
+	}
+
+	if options.ShutdownTimeout <= 0 {
+		options.ShutdownTimeout = DefaultShutdownTimeout
+	}
+
+	server := &Server{
+		address:         options.Address,
+		adminAddress:    options.AdminAddress,
+		tlsAddress:      resolveTlsAddress(options.TlsAddress, lbConfig),
+		redirectHttp:    lbConfig.Tls != nil && lbConfig.Tls.RedirectHttp,
+		certificates:    certificate.NewStore(),
+		shutdownTimeout: options.ShutdownTimeout,
+		pathToConfig:    options.ConfigPath,
+	}
+
+	if err = server.certificates.Set(certificateFiles(lbConfig)); err != nil {
+		return nil, err
 	}
 
-	return &Server{lbs, port}, nil
+	if lbConfig.Acme != nil {
+		if err = server.buildAcme(lbConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	server.metrics = newServerMetrics(server)
+	server.accessLog, server.accessLogCloser, err = buildAccessLog(lbConfig.AccessLog)
+
+	if err != nil {
+		return nil, err
+	}
+
+	initialRoutes, err := buildRoutes(lbConfig, nil, server.metrics)
+
+	if err != nil {
+		return nil, err
+	}
+
+	server.routes.Store(initialRoutes)
+
+	return server, nil
 }
 
+// Start serves the proxy, over HTTPS as well when TLS is configured, and the admin API until the process is
+// interrupted, then shuts them all down gracefully.
 func (server *Server) Start() error {
-	http.HandleFunc("/", server.handleProxy)
-	http.HandleFunc("/api/v1/loadBalancers/report", server.handleReport)
+	addresses := []string{server.address, server.adminAddress}
+
+	if server.tlsAddress != "" {
+		addresses = append(addresses, server.tlsAddress)
+	}
+
+	var listeners []net.Listener
+
+	for _, address := range addresses {
+		listener, err := listen(address)
+
+		if err != nil {
+			for _, opened := range listeners {
+				_ = opened.Close()
+			}
+
+			return err
+		}
+
+		listeners = append(listeners, listener)
+	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
 	server.startHealthChecks(ctx)
-	httpServer := server.listenAndServe()
+	go server.watchConfig(ctx)
+
+	if server.acme != nil {
+		go server.acme.Run(ctx)
+	}
+
+	httpServers := []*http.Server{
+		serve(listeners[0], server.httpHandler()),
+		serve(listeners[1], server.adminHandler()),
+	}
+
+	if server.tlsAddress != "" {
+		httpServers = append(httpServers, serveTls(listeners[2], server.publicHandler(), server.tlsConfig()))
+	}
 
 	<-ctx.Done()
 
-	shutDownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	shutDownCtx, cancel := context.WithTimeout(context.Background(), server.shutdownTimeout)
 	defer cancel()
 
-	return httpServer.Shutdown(shutDownCtx)
+	var shutdownErrors []error
+
+	for _, httpServer := range httpServers {
+		shutdownErrors = append(shutdownErrors, httpServer.Shutdown(shutDownCtx))
+	}
+
+	if server.accessLogCloser != nil {
+		shutdownErrors = append(shutdownErrors, server.accessLogCloser.Close())
+	}
+
+	return errors.Join(shutdownErrors...)
 }
 
-func (server *Server) listenAndServe() *http.Server {
-	httpServer := &http.Server{Addr: fmt.Sprintf(":%d", server.port), Handler: nil}
+// AdminAddress is the address the admin API is served on, after the config and defaults have been applied.
+func (server *Server) AdminAddress() string {
+	return server.adminAddress
+}
 
-	go func() {
-		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Printf("server error: %v", err)
-		}
-	}()
+// TlsAddress is the address HTTPS is served on, or empty when TLS isn't configured.
+func (server *Server) TlsAddress() string {
+	return server.tlsAddress
+}
 
-	return httpServer
+// publicHandler sends every request to the proxy, so the apps behind it own every path.
+func (server *Server) publicHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", server.handleProxy)
+
+	return mux
+}
+
+// adminHandler serves the report and instance management API.
+func (server *Server) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/loadBalancers/report", server.handleReport)
+	mux.Handle("GET /metrics", server.metrics.registry.Handler())
+	mux.HandleFunc("POST /api/v1/loadBalancers/{host}/instances", server.handleAddInstance)
+	mux.HandleFunc("DELETE /api/v1/loadBalancers/{host}/instances", server.handleRemoveInstance)
+	mux.HandleFunc("POST /api/v1/loadBalancers/{host}/instances/drain", server.handleDrainInstance)
+
+	return mux
 }
 
 func (server *Server) startHealthChecks(ctx context.Context) {
-	for _, lb := range server.loadBalancers {
+	for _, lb := range server.routes.Load().loadBalancers {
 		lb.StartHealthChecks(ctx)
 	}
 }
 
-func buildLoadBalancers(pathToConfig string) (map[string]*balancer.LoadBalancer, error) {
-	lbConfig, loadConfigError := config.LoadConfig(pathToConfig)
-	lbs := map[string]*balancer.LoadBalancer{}
+func (server *Server) loadBalancer(host string) *balancer.LoadBalancer {
+	return server.routes.Load().loadBalancers[host]
+}
 
-	if loadConfigError != nil {
-		return nil, loadConfigError
+// buildRoutes builds a load balancer for every app in lbConfig. When previous is set, apps whose config hasn't
+// changed keep their load balancer, and unchanged instances of changed apps keep their backend, so their health
+// state and connection counts survive a reload.
+func buildRoutes(lbConfig *config.Config, previous *routes, serverMetrics *serverMetrics) (*routes, error) {
+	built := &routes{
+		loadBalancers: map[string]*balancer.LoadBalancer{},
+		apps:          map[string]*config.ApplicationConfig{},
+		retryPolicies: map[string]*retryPolicy{},
+		upstreams:     map[string]*upstream{},
+		timeouts:      map[string]*requestTimeout{},
+		clientAuths:   map[string]*clientAuth{},
 	}
 
 	for _, app := range lbConfig.Apps {
-		duration, parseTimeoutError := time.ParseDuration(app.Timeout)
-		healthCheckCooldown, parseCooldownError := time.ParseDuration(app.HealthCheckCooldown)
+		built.apps[app.Host] = app
+
+		policy, err := buildRetryPolicy(app.Retry)
 
-		if parseTimeoutError != nil {
-			return nil, parseTimeoutError
+		if err != nil {
+			return nil, err
 		}
 
-		if parseCooldownError != nil {
-			return nil, parseCooldownError
+		built.retryPolicies[app.Host] = policy
+
+		if built.timeouts[app.Host], err = buildRequestTimeout(app.RequestTimeout); err != nil {
+			return nil, err
 		}
 
-		httpClient := &http.Client{Timeout: duration}
+		if app.ClientAuth != nil {
+			auth, authErr := buildClientAuth(app.ClientAuth)
 
-		backends, err := buildBackends(app, httpClient)
+			if authErr != nil {
+				return nil, authErr
+			}
+
+			built.clientAuths[normalizeServerName(app.Host)] = auth
+		}
+
+		up := previous.reusableUpstream(app)
+		reusedUpstream := up != nil
+		var reusable map[string]*backend.Backend
+
+		if !reusedUpstream {
+			if up, err = buildUpstream(app); err != nil {
+				return nil, err
+			}
+		} else {
+			// Backends health check over the upstream's transport, so they are only kept along with it.
+			reusable = previous.reusableBackends(app)
+		}
+
+		built.upstreams[app.Host] = up
+
+		if previous != nil && previous.upstreams[app.Host] == up && reflect.DeepEqual(previous.apps[app.Host], app) {
+			built.loadBalancers[app.Host] = previous.loadBalancers[app.Host]
+			continue
+		}
+
+		lb, err := buildLoadBalancer(previous.withRuntimeChanges(app), up, reusable, serverMetrics)
 
 		if err != nil {
 			return nil, err
 		}
 
-		lbs[app.Host] = balancer.New(backends, determineStrategy(app.Strategy), healthCheckCooldown)
+		// A reused upstream keeps serving the previous load balancer until the reload hands it over with prune.
+		if !reusedUpstream {
+			up.owner.Store(lb)
+		}
+
+		built.loadBalancers[app.Host] = lb
+	}
+
+	return built, nil
+}
+
+// buildLoadBalancer builds the app's load balancer. Its health checks go over the upstream's transport, the same one
+// its requests are proxied over, and backends that leave it have their proxy and metrics dropped.
+func buildLoadBalancer(app *config.ApplicationConfig, up *upstream, reusable map[string]*backend.Backend, serverMetrics *serverMetrics) (*balancer.LoadBalancer, error) {
+	duration, parseTimeoutError := time.ParseDuration(app.Timeout)
+	healthCheckCooldown, parseCooldownError := time.ParseDuration(app.HealthCheckCooldown)
+
+	if parseTimeoutError != nil {
+		return nil, parseTimeoutError
+	}
+
+	if parseCooldownError != nil {
+		return nil, parseCooldownError
+	}
+
+	httpClient := &http.Client{Timeout: duration, Transport: up.transport}
+
+	backends, err := buildBackends(app, httpClient, reusable, serverMetrics)
+
+	if err != nil {
+		return nil, err
+	}
+
+	strategy, strategyErr := determineStrategy(app)
+
+	if strategyErr != nil {
+		return nil, strategyErr
+	}
+
+	lb := balancer.New(backends, strategy, healthCheckCooldown)
+	lb.SetRemovalObserver(func(be *backend.Backend) {
+		up.forget(be)
+		serverMetrics.forgetBackend(app.Host, be)
+	})
+
+	if app.StickySession != nil && app.StickySession.Enabled {
+		affinity, affinityErr := buildSessionAffinity(app.StickySession)
+
+		if affinityErr != nil {
+			return nil, affinityErr
+		}
+
+		lb.SetSessionAffinity(affinity)
 	}
 
-	return lbs, nil
+	return lb, nil
 }
 
-func buildBackends(app *config.ApplicationConfig, httpClient *http.Client) ([]*backend.Backend, error) {
+// buildBackends builds a backend for each of the app's instances, taking it from reusable (keyed by URL) instead
+// when one is there with the same weight. New backends report their health checks to serverMetrics.
+func buildBackends(app *config.ApplicationConfig, httpClient *http.Client, reusable map[string]*backend.Backend, serverMetrics *serverMetrics) ([]*backend.Backend, error) {
 
 	var backends []*backend.Backend
+	var outlierDetection *backend.OutlierDetection
+	var circuitBreaker *backend.CircuitBreaker
+
+	healthCheck, err := buildHealthCheck(app)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if app.OutlierDetection != nil {
+		outlierDetection, err = buildOutlierDetection(app.OutlierDetection)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if app.CircuitBreaker != nil {
+		circuitBreaker, err = buildCircuitBreaker(app.CircuitBreaker)
+
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	for _, instance := range app.Instances {
-		be, newBackendErr := backend.NewFromString(instance.Url, app.HealthUri, httpClient)
+		if be := reusable[instance.Url]; be != nil && (be.Weight() == instance.Weight || instance.Weight == 0 && be.Weight() == 1) {
+			backends = append(backends, be)
+			continue
+		}
+
+		be, newBackendErr := backend.NewWithHealthCheck(instance.Url, healthCheck, httpClient)
 
 		if newBackendErr != nil {
 			return nil, newBackendErr
 		}
 
+		if instance.Weight != 0 {
+			if weightErr := be.SetWeight(instance.Weight); weightErr != nil {
+				return nil, weightErr
+			}
+		}
+
+		if outlierDetection != nil {
+			be.SetOutlierDetection(*outlierDetection)
+		}
+
+		if circuitBreaker != nil {
+			be.SetCircuitBreaker(*circuitBreaker)
+		}
+
+		be.SetHealthCheckObserver(serverMetrics.healthCheckObserver(app.Host, be))
+
 		backends = append(backends, be)
 	}
 
 	return backends, nil
 }
 
-func determineStrategy(strategy string) balancer.Strategy {
-	switch strategy {
+func buildHealthCheck(app *config.ApplicationConfig) (backend.HealthCheck, error) {
+	healthCheck := backend.HealthCheck{Uri: app.HealthUri}
+
+	if app.HealthCheck == nil {
+		return healthCheck, nil
+	}
+
+	timeout, err := parseOptionalDuration(app.HealthCheck.Timeout)
+
+	if err != nil {
+		return healthCheck, err
+	}
+
+	jitter, err := parseOptionalDuration(app.HealthCheck.Jitter)
+
+	if err != nil {
+		return healthCheck, err
+	}
+
+	switch app.HealthCheck.InitialState {
+	case "", "healthy":
+	case "unhealthy":
+		healthCheck.StartUnhealthy = true
+	default:
+		return healthCheck, fmt.Errorf("%w: %q", ErrInvalidInitialState, app.HealthCheck.InitialState)
+	}
+
+	for _, rawStatus := range app.HealthCheck.ExpectedStatus {
+		statusRange, statusErr := backend.ParseStatusRange(rawStatus)
+
+		if statusErr != nil {
+			return healthCheck, fmt.Errorf("%w: %q", statusErr, rawStatus)
+		}
+
+		healthCheck.ExpectedStatuses = append(healthCheck.ExpectedStatuses, statusRange)
+	}
+
+	if app.HealthCheck.BodyRegex != "" {
+		healthCheck.BodyRegex, err = regexp.Compile(app.HealthCheck.BodyRegex)
+
+		if err != nil {
+			return healthCheck, err
+		}
+	}
+
+	healthCheck.Type = app.HealthCheck.Type
+	healthCheck.GrpcService = app.HealthCheck.GrpcService
+	healthCheck.Method = app.HealthCheck.Method
+	healthCheck.Headers = app.HealthCheck.Headers
+	healthCheck.Timeout = timeout
+	healthCheck.BodyContains = app.HealthCheck.BodyContains
+	healthCheck.HealthyThreshold = app.HealthCheck.HealthyThreshold
+	healthCheck.UnhealthyThreshold = app.HealthCheck.UnhealthyThreshold
+	healthCheck.Jitter = jitter
+
+	return healthCheck, nil
+}
+
+func buildOutlierDetection(outlierDetection *config.OutlierDetectionConfig) (*backend.OutlierDetection, error) {
+	baseEjectionTime, err := parseOptionalDuration(outlierDetection.BaseEjectionTime)
+
+	if err != nil {
+		return nil, err
+	}
+
+	maxEjectionTime, err := parseOptionalDuration(outlierDetection.MaxEjectionTime)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &backend.OutlierDetection{
+		ConsecutiveFailures: outlierDetection.ConsecutiveFailures,
+		BaseEjectionTime:    baseEjectionTime,
+		MaxEjectionTime:     maxEjectionTime,
+	}, nil
+}
+
+func buildCircuitBreaker(circuitBreaker *config.CircuitBreakerConfig) (*backend.CircuitBreaker, error) {
+	window, err := parseOptionalDuration(circuitBreaker.Window)
+
+	if err != nil {
+		return nil, err
+	}
+
+	coolOff, err := parseOptionalDuration(circuitBreaker.CoolOff)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &backend.CircuitBreaker{
+		ErrorRate:        circuitBreaker.ErrorRate,
+		MinRequests:      circuitBreaker.MinRequests,
+		Window:           window,
+		CoolOff:          coolOff,
+		HalfOpenRequests: circuitBreaker.HalfOpenRequests,
+	}, nil
+}
+
+func buildSessionAffinity(stickySession *config.StickySessionConfig) (*balancer.SessionAffinity, error) {
+	maxAge, err := parseOptionalDuration(stickySession.MaxAge)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return balancer.NewSessionAffinity(stickySession.CookieName, []byte(stickySession.Secret), maxAge), nil
+}
+
+// parseOptionalDuration parses a duration that may be left out of the config, returning zero when it is.
+func parseOptionalDuration(raw string) (time.Duration, error) {
+	if raw == "" {
+		return 0, nil
+	}
+
+	return time.ParseDuration(raw)
+}
+
+func determineStrategy(app *config.ApplicationConfig) (balancer.Strategy, error) {
+	switch app.Strategy {
 	case balancer.RoundRobinStrategy:
-		return balancer.NewRoundRobin()
+		return balancer.NewRoundRobin(), nil
+	case balancer.WeightedRoundRobinStrategy:
+		return balancer.NewWeightedRoundRobin(), nil
 	case balancer.LeastConnectionsStrategy:
-		return balancer.NewLeastConnections()
+		return balancer.NewLeastConnections(), nil
+	case balancer.PowerOfTwoChoicesStrategy:
+		return balancer.NewPowerOfTwoChoices(), nil
+	case balancer.LeastLatencyStrategy:
+		return balancer.NewLeastLatency(), nil
+	case balancer.ConsistentHashStrategy:
+		return buildConsistentHash(app.ConsistentHash)
 	default:
-		return balancer.NewRoundRobin()
+		return balancer.NewRoundRobin(), nil
 	}
 }
+
+func buildConsistentHash(hashConfig *config.ConsistentHashConfig) (balancer.Strategy, error) {
+	if hashConfig == nil {
+		hashConfig = &config.ConsistentHashConfig{}
+	}
+
+	key := balancer.HashKey{Source: hashConfig.Key, Name: hashConfig.Name, Segment: hashConfig.Segment}
+
+	if key.Source == "" {
+		key.Source = balancer.HashKeyClientIp
+	}
+
+	strategy, err := balancer.NewConsistentHash(key, hashConfig.VirtualNodes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return strategy, nil
+}
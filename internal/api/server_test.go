@@ -1,27 +1,207 @@
 package api
 
 import (
+	"errors"
+	"load-balancer/internal/backend"
 	"load-balancer/internal/balancer"
+	"load-balancer/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
 func TestDetermineStrategy(t *testing.T) {
 	scenarios := []struct {
-		input    string
-		expected balancer.Strategy
+		input         string
+		hashConfig    *config.ConsistentHashConfig
+		expected      balancer.Strategy
+		expectedError error
 	}{
-		{"", &balancer.RoundRobin{}},
-		{"round_robin", &balancer.RoundRobin{}},
-		{"least_connections", &balancer.LeastConnections{}},
-		{"invalid input", &balancer.RoundRobin{}},
+		{"", nil, &balancer.RoundRobin{}, nil},
+		{"round_robin", nil, &balancer.RoundRobin{}, nil},
+		{"weighted_round_robin", nil, &balancer.WeightedRoundRobin{}, nil},
+		{"least_connections", nil, &balancer.LeastConnections{}, nil},
+		{"p2c", nil, &balancer.PowerOfTwoChoices{}, nil},
+		{"least_latency", nil, &balancer.LeastLatency{}, nil},
+		{"consistent_hash", nil, &balancer.ConsistentHash{}, nil},
+		{"consistent_hash", &config.ConsistentHashConfig{Key: "header", Name: "X-User-Id"}, &balancer.ConsistentHash{}, nil},
+		{"consistent_hash", &config.ConsistentHashConfig{Key: "header"}, nil, balancer.ErrMissingHashKeyName},
+		{"consistent_hash", &config.ConsistentHashConfig{Key: "query"}, nil, balancer.ErrInvalidHashKey},
+		{"invalid input", nil, &balancer.RoundRobin{}, nil},
 	}
 
 	for _, scenario := range scenarios {
-		strategy := determineStrategy(scenario.input)
+		strategy, err := determineStrategy(&config.ApplicationConfig{Strategy: scenario.input, ConsistentHash: scenario.hashConfig})
 
-		if reflect.TypeOf(strategy) != reflect.TypeOf(scenario.expected) {
+		if !errors.Is(err, scenario.expectedError) {
+			t.Errorf("determineStrategy(%v) expected error %v, got %v", scenario.input, scenario.expectedError, err)
+		}
+
+		if scenario.expectedError != nil && strategy != nil {
+			t.Errorf("determineStrategy(%v) expected no strategy alongside an error, got %T", scenario.input, strategy)
+		}
+
+		if scenario.expectedError == nil && reflect.TypeOf(strategy) != reflect.TypeOf(scenario.expected) {
 			t.Errorf("determineStrategy(%v) expected %T, got %T", scenario.input, scenario.expected, strategy)
 		}
 	}
 }
+
+func TestNewServer_HealthCheckTypes(t *testing.T) {
+	scenarios := []struct {
+		name          string
+		app           string
+		expectedError error
+	}{
+		{"HTTP", "health_uri: /health", nil},
+		{"HTTP Without Health Uri", "health_check: {type: http}", backend.ErrMissingHealthUri},
+		{"TCP Without Health Uri", "health_check: {type: tcp}", nil},
+		{"gRPC Without Health Uri", "health_check: {type: grpc, grpc_service: payments}", nil},
+		{"Unknown Type", "health_check: {type: icmp}", backend.ErrInvalidHealthCheckType},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			pathToConfig := writeConfig(t, `
+apps:
+  - host: app.example.com
+    timeout: 5s
+    health_check_cooldown: 10s
+    `+scenario.app+`
+    instances:
+      - url: http://localhost:8080`)
+
+			_, err := NewServer(0, pathToConfig)
+
+			if !errors.Is(err, scenario.expectedError) {
+				t.Errorf("NewServer() error = %v, expected %v", err, scenario.expectedError)
+			}
+		})
+	}
+}
+
+func TestBuildHealthCheck(t *testing.T) {
+	scenarios := []struct {
+		name          string
+		healthCheck   *config.HealthCheckConfig
+		expectedError bool
+	}{
+		{"No Health Check Block", nil, false},
+		{"Full Definition", &config.HealthCheckConfig{Method: "HEAD", ExpectedStatus: []string{"200", "500-503"}, Timeout: "2s", BodyRegex: "ok|up"}, false},
+		{"Invalid Status", &config.HealthCheckConfig{ExpectedStatus: []string{"2xx"}}, true},
+		{"Invalid Timeout", &config.HealthCheckConfig{Timeout: "soon"}, true},
+		{"Invalid Regex", &config.HealthCheckConfig{BodyRegex: "(unclosed"}, true},
+		{"Start Unhealthy With Jitter", &config.HealthCheckConfig{InitialState: "unhealthy", Jitter: "5s"}, false},
+		{"Invalid Initial State", &config.HealthCheckConfig{InitialState: "maybe"}, true},
+		{"Invalid Jitter", &config.HealthCheckConfig{Jitter: "a bit"}, true},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			healthCheck, err := buildHealthCheck(&config.ApplicationConfig{HealthUri: "/health", HealthCheck: scenario.healthCheck})
+
+			if scenario.expectedError != (err != nil) {
+				t.Fatalf("buildHealthCheck() error = %v, expected error = %v", err, scenario.expectedError)
+			}
+
+			if err == nil && healthCheck.Uri != "/health" {
+				t.Errorf("buildHealthCheck() Uri = %v, expected /health", healthCheck.Uri)
+			}
+		})
+	}
+}
+
+func TestNewServerWithOptions_AdminAddress(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		admin    string
+		option   string
+		expected string
+	}{
+		{"Default", "", "", DefaultAdminAddress},
+		{"From Config", "admin: {address: '127.0.0.1:9100'}", "", "127.0.0.1:9100"},
+		{"Option Overrides Config", "admin: {address: '127.0.0.1:9100'}", "unix:/run/lb.sock", "unix:/run/lb.sock"},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			pathToConfig := writeConfig(t, scenario.admin+reloadBaseConfig)
+			server, err := NewServerWithOptions(Options{ConfigPath: pathToConfig, AdminAddress: scenario.option})
+
+			if err != nil {
+				t.Fatalf("NewServerWithOptions() returned an unexpected error = %v", err)
+			}
+
+			if server.AdminAddress() != scenario.expected {
+				t.Errorf("AdminAddress() = %v, expected %v", server.AdminAddress(), scenario.expected)
+			}
+		})
+	}
+}
+
+func TestServer_AdminRoutesOnlyOnAdminHandler(t *testing.T) {
+	server, _ := NewServer(0, writeConfig(t, reloadBaseConfig))
+
+	publicRecorder := httptest.NewRecorder()
+	server.publicHandler().ServeHTTP(publicRecorder, httptest.NewRequest(http.MethodGet, "http://unknown.example.com/api/v1/loadBalancers/report", nil))
+
+	if publicRecorder.Code != http.StatusInternalServerError {
+		t.Errorf("Expected the public handler to proxy the report path, got status %v", publicRecorder.Code)
+	}
+
+	adminRecorder := httptest.NewRecorder()
+	server.adminHandler().ServeHTTP(adminRecorder, httptest.NewRequest(http.MethodGet, "/api/v1/loadBalancers/report", nil))
+
+	if adminRecorder.Code != http.StatusOK {
+		t.Errorf("Expected the admin handler to serve the report, got status %v", adminRecorder.Code)
+	}
+}
+
+func TestServer_InstanceChangesOnlyOnAdminHandler(t *testing.T) {
+	scenarios := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{"Add", http.MethodPost, "/api/v1/loadBalancers/app1.example.com/instances", `{"url": "http://localhost:8082"}`},
+		{"Remove", http.MethodDelete, "/api/v1/loadBalancers/app1.example.com/instances?url=http://localhost:8080", ""},
+		{"Drain", http.MethodPost, "/api/v1/loadBalancers/app1.example.com/instances/drain?url=http://localhost:8080", ""},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			server, _ := NewServer(0, writeConfig(t, reloadBaseConfig))
+			lb := server.loadBalancer("app1.example.com")
+
+			r := httptest.NewRequest(scenario.method, "http://app1.example.com"+scenario.path, strings.NewReader(scenario.body))
+			server.publicHandler().ServeHTTP(httptest.NewRecorder(), r)
+
+			if len(lb.GetBackends()) != 2 || len(lb.GetDrainingBackends()) != 0 {
+				t.Fatalf("Expected the public handler to leave the instances alone, got %v active and %v draining",
+					len(lb.GetBackends()), len(lb.GetDrainingBackends()))
+			}
+
+			recorder := httptest.NewRecorder()
+			server.adminHandler().ServeHTTP(recorder, httptest.NewRequest(scenario.method, scenario.path, strings.NewReader(scenario.body)))
+
+			if recorder.Code >= http.StatusBadRequest {
+				t.Errorf("Expected the admin handler to make the change, got status %v: %v", recorder.Code, recorder.Body)
+			}
+		})
+	}
+}
+
+func writeConfig(t testing.TB, contents string) string {
+	pathToConfig := filepath.Join(t.TempDir(), "config.yaml")
+
+	if err := os.WriteFile(pathToConfig, []byte(contents), 0o600); err != nil {
+		t.Fatalf("Error writing config: %v", err)
+	}
+
+	return pathToConfig
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"cmp"
+	"load-balancer/internal/config"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// requestTimeout limits how long an app's proxied requests may take, built from its request_timeout block.
+type requestTimeout struct {
+	timeout time.Duration
+	// routes is sorted longest prefix first, so the first match is the most specific.
+	routes         []routeTimeout
+	deadlineHeader string
+}
+
+type routeTimeout struct {
+	pathPrefix string
+	timeout    time.Duration
+}
+
+func buildRequestTimeout(requestTimeoutConfig *config.RequestTimeoutConfig) (*requestTimeout, error) {
+	if requestTimeoutConfig == nil {
+		return nil, nil
+	}
+
+	timeout, err := parseOptionalDuration(requestTimeoutConfig.Timeout)
+
+	if err != nil {
+		return nil, err
+	}
+
+	built := &requestTimeout{timeout: timeout, deadlineHeader: requestTimeoutConfig.DeadlineHeader}
+
+	for _, route := range requestTimeoutConfig.Routes {
+		routeTimeoutValue, routeErr := time.ParseDuration(route.Timeout)
+
+		if routeErr != nil {
+			return nil, routeErr
+		}
+
+		built.routes = append(built.routes, routeTimeout{pathPrefix: route.PathPrefix, timeout: routeTimeoutValue})
+	}
+
+	slices.SortFunc(built.routes, func(a, b routeTimeout) int {
+		return cmp.Compare(len(b.pathPrefix), len(a.pathPrefix))
+	})
+
+	return built, nil
+}
+
+// forPath returns the timeout of requests for path, or 0 when they have none.
+func (rt *requestTimeout) forPath(path string) time.Duration {
+	if rt == nil {
+		return 0
+	}
+
+	for _, route := range rt.routes {
+		if strings.HasPrefix(path, route.pathPrefix) {
+			return route.timeout
+		}
+	}
+
+	return rt.timeout
+}
+
+// setDeadlineHeader tells the backend how many milliseconds are left until r's deadline, when the app asks for it. It
+// is set again before every attempt, so a retried request carries what is left after the failed ones. A value sent
+// by the client is never passed on.
+func (rt *requestTimeout) setDeadlineHeader(r *http.Request) {
+	if rt == nil || rt.deadlineHeader == "" {
+		return
+	}
+
+	deadline, ok := r.Context().Deadline()
+
+	if !ok {
+		r.Header.Del(rt.deadlineHeader)
+		return
+	}
+
+	r.Header.Set(rt.deadlineHeader, strconv.FormatInt(max(time.Until(deadline).Milliseconds(), 0), 10))
+}
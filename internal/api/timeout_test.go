@@ -0,0 +1,130 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"load-balancer/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestTimeout_ForPath(t *testing.T) {
+	rt, err := buildRequestTimeout(&config.RequestTimeoutConfig{
+		Timeout: "30s",
+		Routes: []*config.RouteTimeoutConfig{
+			{PathPrefix: "/reports", Timeout: "5m"},
+			{PathPrefix: "/reports/live", Timeout: "0s"},
+			{PathPrefix: "/health", Timeout: "1s"},
+		},
+	})
+
+	if err != nil {
+		t.Fatalf("buildRequestTimeout() returned an unexpected error = %v", err)
+	}
+
+	scenarios := []struct {
+		name     string
+		rt       *requestTimeout
+		path     string
+		expected time.Duration
+	}{
+		{"App Timeout", rt, "/users/1", 30 * time.Second},
+		{"Route Timeout", rt, "/reports/monthly", 5 * time.Minute},
+		{"Longest Prefix Wins", rt, "/reports/live/feed", 0},
+		{"Shorter Route", rt, "/health", time.Second},
+		{"No Request Timeout", nil, "/users/1", 0},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			if actual := scenario.rt.forPath(scenario.path); actual != scenario.expected {
+				t.Errorf("forPath(%q) = %v, expected %v", scenario.path, actual, scenario.expected)
+			}
+		})
+	}
+}
+
+func TestServer_HandleProxy_RequestTimeout(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delay, _ := time.ParseDuration(r.URL.Query().Get("delay"))
+
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+
+		_, _ = io.WriteString(w, r.Header.Get("X-Request-Deadline"))
+	}))
+	defer upstream.Close()
+
+	server, err := NewServer(0, writeConfig(t, fmt.Sprintf(`
+apps:
+  - host: app.example.com
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 1h
+    request_timeout:
+      timeout: 200ms
+      deadline_header: X-Request-Deadline
+      routes:
+        - path_prefix: /stream
+          timeout: 0s
+    instances:
+      - url: %v`, upstream.URL)))
+
+	if err != nil {
+		t.Fatalf("NewServer() returned an unexpected error = %v", err)
+	}
+
+	scenarios := []struct {
+		name             string
+		target           string
+		expectedStatus   int
+		expectedDeadline bool
+	}{
+		{"Within Timeout", "/api?delay=0s", http.StatusOK, true},
+		{"Exceeds Timeout", "/api?delay=2s", http.StatusGatewayTimeout, false},
+		{"Route Without Timeout", "/stream?delay=400ms", http.StatusOK, false},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://app.example.com"+scenario.target, nil)
+			r.Header.Set("X-Request-Deadline", "999999")
+			recorder := httptest.NewRecorder()
+
+			server.publicHandler().ServeHTTP(recorder, r)
+
+			if recorder.Code != scenario.expectedStatus {
+				t.Fatalf("Expected status %v, got %v", scenario.expectedStatus, recorder.Code)
+			}
+
+			body := recorder.Body.String()
+
+			if scenario.expectedStatus == http.StatusGatewayTimeout {
+				if !strings.Contains(body, "app.example.com did not respond within 200ms") {
+					t.Errorf("Expected the body to explain the timeout, got %q", body)
+				}
+
+				return
+			}
+
+			if !scenario.expectedDeadline {
+				if body != "" {
+					t.Errorf("Expected no deadline to be sent, got %q", body)
+				}
+
+				return
+			}
+
+			if remaining, parseErr := strconv.Atoi(body); parseErr != nil || remaining <= 0 || remaining > 200 {
+				t.Errorf("Expected the milliseconds left of 200ms, got %q", body)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"crypto/tls"
+	"load-balancer/internal/certificate"
+	"load-balancer/internal/config"
+	"net"
+	"net/http"
+)
+
+// DefaultTlsAddress is where HTTPS is served when TLS is configured without an address.
+const DefaultTlsAddress = ":8443"
+
+// resolveTlsAddress returns the address HTTPS is served on: the option, then the config's, then DefaultTlsAddress.
+// It is empty, and HTTPS off, when neither the options nor the config mention TLS.
+func resolveTlsAddress(option string, lbConfig *config.Config) string {
+	if option != "" {
+		return option
+	}
+
+	if lbConfig.Tls != nil && lbConfig.Tls.Address != "" {
+		return lbConfig.Tls.Address
+	}
+
+	if lbConfig.Tls != nil || lbConfig.Acme != nil || len(certificateFiles(lbConfig)) > 0 {
+		return DefaultTlsAddress
+	}
+
+	return ""
+}
+
+// certificateFiles returns the certificate and key files of every app that has them, keyed by host.
+func certificateFiles(lbConfig *config.Config) map[string]certificate.Files {
+	files := map[string]certificate.Files{}
+
+	for _, app := range lbConfig.Apps {
+		if app.Tls != nil {
+			files[app.Host] = certificate.Files{CertFile: app.Tls.CertFile, KeyFile: app.Tls.KeyFile}
+		}
+	}
+
+	return files
+}
+
+// acmeHosts returns the hosts of every app without certificate files of its own.
+func acmeHosts(lbConfig *config.Config) []string {
+	var hosts []string
+
+	for _, app := range lbConfig.Apps {
+		if app.Tls == nil {
+			hosts = append(hosts, app.Host)
+		}
+	}
+
+	return hosts
+}
+
+// buildAcme sets up issuing certificates for acmeHosts, answering http-01 challenges on the plain HTTP listener.
+func (server *Server) buildAcme(lbConfig *config.Config) error {
+	renewBefore, err := parseOptionalDuration(lbConfig.Acme.RenewBefore)
+
+	if err != nil {
+		return err
+	}
+
+	server.challenges = certificate.NewHttp01Solver()
+	server.acme, err = certificate.NewAcmeManager(certificate.Acme{
+		DirectoryUrl: lbConfig.Acme.DirectoryUrl,
+		Email:        lbConfig.Acme.Email,
+		CacheDir:     lbConfig.Acme.CacheDir,
+		RenewBefore:  renewBefore,
+		Solvers:      []certificate.Solver{server.challenges},
+	}, server.certificates)
+
+	if err != nil {
+		return err
+	}
+
+	server.acme.SetHosts(acmeHosts(lbConfig))
+
+	return nil
+}
+
+func (server *Server) tlsConfig() *tls.Config {
+	tlsConfig := &tls.Config{
+		GetCertificate: server.certificates.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+		// Spelled out, since the configs with client auth are cloned from this one, not from the http.Server's.
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	tlsConfig.GetConfigForClient = server.getConfigForClient(tlsConfig)
+
+	return tlsConfig
+}
+
+// httpHandler serves the plain HTTP listener. With redirect_http, requests for a host that has a certificate are
+// redirected to HTTPS, and only the rest are proxied. ACME http-01 challenges are answered before either.
+func (server *Server) httpHandler() http.Handler {
+	handler := server.publicHandler()
+
+	if server.redirectHttp {
+		handler = server.redirectToHttps(handler)
+	}
+
+	if server.challenges != nil {
+		handler = server.challenges.Handler(handler)
+	}
+
+	return handler
+}
+
+func (server *Server) redirectToHttps(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := hostWithoutPort(r.Host)
+
+		if !server.certificates.Has(host) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		http.Redirect(w, r, "https://"+server.httpsHost(host)+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// httpsHost is host with the port of the HTTPS listener, which is left out when it is the default port.
+func (server *Server) httpsHost(host string) string {
+	_, port, err := net.SplitHostPort(server.tlsAddress)
+
+	if err != nil || port == "443" {
+		return host
+	}
+
+	return net.JoinHostPort(host, port)
+}
@@ -0,0 +1,268 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"golang.org/x/crypto/acme"
+	"io"
+	"load-balancer/internal/config"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResolveTlsAddress(t *testing.T) {
+	withCertificate := &config.Config{Apps: []*config.ApplicationConfig{{Host: "app.example.com", Tls: &config.AppTlsConfig{}}}}
+
+	scenarios := []struct {
+		name     string
+		option   string
+		config   *config.Config
+		expected string
+	}{
+		{"No Tls", "", &config.Config{}, ""},
+		{"Option", ":9443", &config.Config{}, ":9443"},
+		{"Config Address", "", &config.Config{Tls: &config.TlsConfig{Address: ":10443"}}, ":10443"},
+		{"Option Over Config", ":9443", &config.Config{Tls: &config.TlsConfig{Address: ":10443"}}, ":9443"},
+		{"Tls Block Without Address", "", &config.Config{Tls: &config.TlsConfig{RedirectHttp: true}}, DefaultTlsAddress},
+		{"App Certificate", "", withCertificate, DefaultTlsAddress},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			if actual := resolveTlsAddress(scenario.option, scenario.config); actual != scenario.expected {
+				t.Errorf("resolveTlsAddress() = %q, expected %q", actual, scenario.expected)
+			}
+		})
+	}
+}
+
+func TestServer_HttpHandler_RedirectsToHttps(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t, "secure.example.com")
+	server, err := NewServerWithOptions(Options{ConfigPath: writeConfig(t, fmt.Sprintf(`
+tls:
+  address: ":8443"
+  redirect_http: true
+apps:
+  - host: secure.example.com
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 1h
+    tls:
+      cert_file: %v
+      key_file: %v
+    instances:
+      - url: http://127.0.0.1:1`, certFile, keyFile))})
+
+	if err != nil {
+		t.Fatalf("NewServerWithOptions() returned an unexpected error = %v", err)
+	}
+
+	scenarios := []struct {
+		name             string
+		target           string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{"Host With Certificate", "http://secure.example.com/path?query=1", http.StatusPermanentRedirect, "https://secure.example.com:8443/path?query=1"},
+		{"Host With Port", "http://secure.example.com:8080/", http.StatusPermanentRedirect, "https://secure.example.com:8443/"},
+		{"Host Without Certificate", "http://plain.example.com/", http.StatusInternalServerError, ""},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			server.httpHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, scenario.target, nil))
+
+			if recorder.Code != scenario.expectedStatus {
+				t.Fatalf("Expected status %v, got %v", scenario.expectedStatus, recorder.Code)
+			}
+
+			if location := recorder.Header().Get("Location"); location != scenario.expectedLocation {
+				t.Errorf("Expected Location %q, got %q", scenario.expectedLocation, location)
+			}
+		})
+	}
+}
+
+func TestServer_ServeTls_PicksCertificateBySni(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Header.Get("X-Forwarded-Proto"))
+	}))
+	defer upstream.Close()
+
+	roots := x509.NewCertPool()
+	var apps string
+
+	for _, host := range []string{"app1.example.com", "app2.example.com"} {
+		certFile, keyFile := writeTestCertificate(t, host)
+		pemBytes, _ := os.ReadFile(certFile)
+		roots.AppendCertsFromPEM(pemBytes)
+		apps += fmt.Sprintf(`
+  - host: %v
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 1h
+    tls:
+      cert_file: %v
+      key_file: %v
+    instances:
+      - url: %v`, host, certFile, keyFile, upstream.URL)
+	}
+
+	server, err := NewServer(0, writeConfig(t, "apps:"+apps))
+
+	if err != nil {
+		t.Fatalf("NewServer() returned an unexpected error = %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+
+	httpServer := serveTls(listener, server.publicHandler(), server.tlsConfig())
+	defer httpServer.Close()
+
+	scenarios := []struct {
+		name          string
+		serverName    string
+		expectedError bool
+	}{
+		{"First App", "app1.example.com", false},
+		{"Second App", "app2.example.com", false},
+		{"Unknown Server Name", "app3.example.com", true},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			client := &http.Client{Transport: &http.Transport{
+				TLSClientConfig:   &tls.Config{ServerName: scenario.serverName, RootCAs: roots},
+				ForceAttemptHTTP2: true,
+			}}
+			r, _ := http.NewRequest(http.MethodGet, "https://"+listener.Addr().String()+"/", nil)
+			r.Host = scenario.serverName
+
+			resp, err := client.Do(r)
+
+			if scenario.expectedError {
+				if err == nil {
+					_ = resp.Body.Close()
+					t.Fatalf("Expected the handshake to fail for %v", scenario.serverName)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.ProtoMajor != 2 {
+				t.Errorf("Expected HTTP/2, got %v", resp.Proto)
+			}
+
+			if string(body) != "https" {
+				t.Errorf("Expected X-Forwarded-Proto %q, got %q", "https", body)
+			}
+		})
+	}
+}
+
+func TestServer_Acme_AnswersChallengesBeforeRedirecting(t *testing.T) {
+	server, err := NewServerWithOptions(Options{ConfigPath: writeConfig(t, fmt.Sprintf(`
+tls:
+  redirect_http: true
+acme:
+  cache_dir: %v
+  accept_terms: true
+apps:
+  - host: app.example.com
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 1h
+    instances:
+      - url: http://127.0.0.1:1`, t.TempDir()))})
+
+	if err != nil {
+		t.Fatalf("NewServerWithOptions() returned an unexpected error = %v", err)
+	}
+
+	if server.TlsAddress() != DefaultTlsAddress {
+		t.Errorf("Expected ACME to turn HTTPS on at %v, got %q", DefaultTlsAddress, server.TlsAddress())
+	}
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	client := &acme.Client{Key: key}
+	challenge := &acme.Challenge{Type: "http-01", Token: "token"}
+
+	if err = server.challenges.Present(context.Background(), client, "app.example.com", challenge); err != nil {
+		t.Fatalf("Present() returned an unexpected error = %v", err)
+	}
+
+	// Once a certificate has been issued, everything but the challenges is redirected.
+	server.certificates.Put("app.example.com", &tls.Certificate{})
+	expected, _ := client.HTTP01ChallengeResponse("token")
+
+	recorder := httptest.NewRecorder()
+	server.httpHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://app.example.com/.well-known/acme-challenge/token", nil))
+
+	if recorder.Code != http.StatusOK || recorder.Body.String() != expected {
+		t.Errorf("Expected the challenge response, got %v %q", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	server.httpHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://app.example.com/", nil))
+
+	if recorder.Code != http.StatusPermanentRedirect {
+		t.Errorf("Expected other requests to be redirected, got %v", recorder.Code)
+	}
+}
+
+// writeTestCertificate writes a self-signed certificate for host and its key to a temporary directory.
+func writeTestCertificate(t *testing.T, host string) (certFile string, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatalf("Error creating certificate: %v", err)
+	}
+
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	_ = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	_ = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600)
+
+	return certFile, keyFile
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"cmp"
+	"errors"
+	"load-balancer/internal/backend"
+	"load-balancer/internal/balancer"
+	"load-balancer/internal/config"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Transport defaults for apps without a transport block, or that leave parts of it out. Idle connections are kept
+// per instance, and the standard library's default of 2 would have a busy instance dial for most requests.
+const (
+	DefaultMaxIdleConnsPerHost = 64
+	DefaultIdleConnTimeout     = 90 * time.Second
+	DefaultDialTimeout         = 30 * time.Second
+	DefaultTlsHandshakeTimeout = 10 * time.Second
+)
+
+// upstream is how an app reaches its instances: one transport, shared by proxied requests and health checks, and a
+// long-lived reverse proxy per backend. Connection pools are kept per host, so the limits apply to each instance.
+type upstream struct {
+	transport *http.Transport
+	// tlsModified is when the upstream TLS files the transport was built from last changed.
+	tlsModified time.Time
+	// proxies holds a *httputil.ReverseProxy per *backend.Backend, created on its first request.
+	proxies sync.Map
+	// owner is the load balancer currently serving the app. Only its backends have their proxy kept.
+	owner atomic.Pointer[balancer.LoadBalancer]
+}
+
+// proxyAttempt is one attempt at proxying a request to a backend. The proxies are shared between requests, so they
+// find it in the outgoing request's context.
+type proxyAttempt struct {
+	rec *responseRecorder
+	r   *http.Request
+	lb  *balancer.LoadBalancer
+	be  *backend.Backend
+	err error
+}
+
+type proxyAttemptKey struct{}
+
+// proxyBuffers lends every proxy the buffers response bodies are copied through, which would otherwise be allocated
+// for each request.
+var proxyBuffers = &bufferPool{}
+
+type bufferPool struct {
+	pool sync.Pool
+}
+
+func (bp *bufferPool) Get() []byte {
+	if buffer, ok := bp.pool.Get().(*[]byte); ok {
+		return *buffer
+	}
+
+	return make([]byte, 32*1024)
+}
+
+func (bp *bufferPool) Put(buffer []byte) {
+	bp.pool.Put(&buffer)
+}
+
+func buildUpstream(app *config.ApplicationConfig) (*upstream, error) {
+	transport, err := buildTransport(app)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &upstream{transport: transport, tlsModified: upstreamTlsModTime(app.UpstreamTls)}, nil
+}
+
+// buildTransport builds the transport an app's requests and health checks are sent over, with its transport and
+// upstream TLS settings applied.
+func buildTransport(app *config.ApplicationConfig) (*http.Transport, error) {
+	settings := app.Transport
+
+	if settings == nil {
+		settings = &config.TransportConfig{}
+	}
+
+	idleConnTimeout, idleErr := parseOptionalDuration(settings.IdleConnTimeout)
+	dialTimeout, dialErr := parseOptionalDuration(settings.DialTimeout)
+	tlsHandshakeTimeout, handshakeErr := parseOptionalDuration(settings.TlsHandshakeTimeout)
+	responseHeaderTimeout, headerErr := parseOptionalDuration(settings.ResponseHeaderTimeout)
+
+	if err := errors.Join(idleErr, dialErr, handshakeErr, headerErr); err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: cmp.Or(dialTimeout, DefaultDialTimeout), KeepAlive: 30 * time.Second}).DialContext
+	transport.MaxIdleConns = 0
+	transport.MaxIdleConnsPerHost = cmp.Or(settings.MaxIdleConnsPerHost, DefaultMaxIdleConnsPerHost)
+	transport.MaxConnsPerHost = settings.MaxConnsPerHost
+	transport.IdleConnTimeout = cmp.Or(idleConnTimeout, DefaultIdleConnTimeout)
+	transport.TLSHandshakeTimeout = cmp.Or(tlsHandshakeTimeout, DefaultTlsHandshakeTimeout)
+	transport.ResponseHeaderTimeout = responseHeaderTimeout
+
+	if app.UpstreamTls != nil {
+		tlsConfig, err := buildUpstreamTlsConfig(app.UpstreamTls)
+
+		if err != nil {
+			return nil, err
+		}
+
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return transport, nil
+}
+
+// proxy returns the reverse proxy for be, creating it on first use. A request still in flight for a backend that has
+// just left the owner gets a proxy that isn't kept, so the proxy dropped by forget or prune isn't brought back.
+func (up *upstream) proxy(be *backend.Backend) *httputil.ReverseProxy {
+	if proxy, ok := up.proxies.Load(be); ok {
+		return proxy.(*httputil.ReverseProxy)
+	}
+
+	proxy, _ := up.proxies.LoadOrStore(be, newReverseProxy(be.Url, up.transport))
+
+	// Backends leave the owner before their proxy is dropped, so checking only once the proxy is stored can't miss a
+	// backend that leaves in between.
+	if !up.owns(be) {
+		up.proxies.CompareAndDelete(be, proxy)
+	}
+
+	return proxy.(*httputil.ReverseProxy)
+}
+
+// owns reports whether be is in the owner, in rotation or draining.
+func (up *upstream) owns(be *backend.Backend) bool {
+	owner := up.owner.Load()
+
+	return owner == nil || slices.Contains(owner.GetBackends(), be) || slices.Contains(owner.GetDrainingBackends(), be)
+}
+
+// forget drops the proxy of be, which has left its load balancer.
+func (up *upstream) forget(be *backend.Backend) {
+	up.proxies.Delete(be)
+}
+
+// prune hands the upstream over to lb, which replaces its owner on a config reload, and drops the proxies of backends
+// that are not in lb, in rotation or draining.
+func (up *upstream) prune(lb *balancer.LoadBalancer) {
+	up.owner.Store(lb)
+
+	up.proxies.Range(func(key, _ any) bool {
+		if !up.owns(key.(*backend.Backend)) {
+			up.proxies.Delete(key)
+		}
+
+		return true
+	})
+}
+
+func newReverseProxy(target *url.URL, transport http.RoundTripper) *httputil.ReverseProxy {
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = transport
+	proxy.BufferPool = proxyBuffers
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		// Only pin the client to a backend that actually answered.
+		attempt := resp.Request.Context().Value(proxyAttemptKey{}).(*proxyAttempt)
+		attempt.lb.Stick(attempt.rec, attempt.r, attempt.be)
+		return nil
+	}
+	proxy.ErrorHandler = func(_ http.ResponseWriter, r *http.Request, err error) {
+		r.Context().Value(proxyAttemptKey{}).(*proxyAttempt).err = err
+	}
+
+	return proxy
+}
@@ -0,0 +1,262 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"load-balancer/internal/backend"
+	"load-balancer/internal/balancer"
+	"load-balancer/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBuildTransport(t *testing.T) {
+	scenarios := []struct {
+		name                          string
+		transport                     *config.TransportConfig
+		expectedMaxIdleConnsPerHost   int
+		expectedMaxConnsPerHost       int
+		expectedIdleConnTimeout       time.Duration
+		expectedResponseHeaderTimeout time.Duration
+	}{
+		{"Defaults", nil, DefaultMaxIdleConnsPerHost, 0, DefaultIdleConnTimeout, 0},
+		{"Configured", &config.TransportConfig{
+			MaxIdleConnsPerHost:   8,
+			MaxConnsPerHost:       32,
+			IdleConnTimeout:       "30s",
+			ResponseHeaderTimeout: "5s",
+		}, 8, 32, 30 * time.Second, 5 * time.Second},
+		{"Partly Configured", &config.TransportConfig{MaxConnsPerHost: 16}, DefaultMaxIdleConnsPerHost, 16, DefaultIdleConnTimeout, 0},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			transport, err := buildTransport(&config.ApplicationConfig{Transport: scenario.transport})
+
+			if err != nil {
+				t.Fatalf("buildTransport() returned an unexpected error = %v", err)
+			}
+
+			if transport.MaxIdleConnsPerHost != scenario.expectedMaxIdleConnsPerHost {
+				t.Errorf("MaxIdleConnsPerHost = %v, expected %v", transport.MaxIdleConnsPerHost, scenario.expectedMaxIdleConnsPerHost)
+			}
+
+			if transport.MaxConnsPerHost != scenario.expectedMaxConnsPerHost {
+				t.Errorf("MaxConnsPerHost = %v, expected %v", transport.MaxConnsPerHost, scenario.expectedMaxConnsPerHost)
+			}
+
+			if transport.IdleConnTimeout != scenario.expectedIdleConnTimeout {
+				t.Errorf("IdleConnTimeout = %v, expected %v", transport.IdleConnTimeout, scenario.expectedIdleConnTimeout)
+			}
+
+			if transport.ResponseHeaderTimeout != scenario.expectedResponseHeaderTimeout {
+				t.Errorf("ResponseHeaderTimeout = %v, expected %v", transport.ResponseHeaderTimeout, scenario.expectedResponseHeaderTimeout)
+			}
+		})
+	}
+}
+
+func TestUpstream_Proxy(t *testing.T) {
+	server, err := NewServer(0, writeConfig(t, `
+apps:
+  - host: app.example.com
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 1h
+    instances:
+      - url: http://127.0.0.1:1
+      - url: http://127.0.0.1:2
+      - url: http://127.0.0.1:3`))
+
+	if err != nil {
+		t.Fatalf("NewServer() returned an unexpected error = %v", err)
+	}
+
+	lb := server.loadBalancer("app.example.com")
+	up := server.routes.Load().upstreams["app.example.com"]
+	first, second := lb.GetBackends()[0], lb.GetBackends()[1]
+
+	if up.proxy(first) != up.proxy(first) {
+		t.Errorf("Expected a backend's proxy to be reused")
+	}
+
+	if up.proxy(first) == up.proxy(second) {
+		t.Errorf("Expected every backend to get its own proxy")
+	}
+
+	if err = lb.RemoveBackend(first.Url.String()); err != nil {
+		t.Fatalf("RemoveBackend() returned an unexpected error = %v", err)
+	}
+
+	if _, ok := up.proxies.Load(first); ok {
+		t.Errorf("Expected the proxy of a removed backend to be dropped")
+	}
+
+	if _, ok := up.proxies.Load(second); !ok {
+		t.Errorf("Expected the proxy of a backend still in rotation to be kept")
+	}
+
+	if err = lb.DrainBackend(second.Url.String(), time.Second); err != nil {
+		t.Fatalf("DrainBackend() returned an unexpected error = %v", err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	if _, ok := up.proxies.Load(second); ok {
+		t.Errorf("Expected the proxy of a drained backend to be dropped")
+	}
+
+	// A request still in flight for a removed backend gets a proxy, but it isn't kept.
+	if up.proxy(first) == nil {
+		t.Fatalf("Expected a proxy for a backend that has just been removed")
+	}
+
+	if _, ok := up.proxies.Load(first); ok {
+		t.Errorf("Expected no proxy to be kept for a backend no longer in the load balancer")
+	}
+
+	third := lb.GetBackends()[0]
+	up.proxy(third)
+
+	// A reload hands the upstream over to a load balancer without the backend.
+	up.prune(balancer.New(nil, balancer.NewRoundRobin(), time.Hour))
+
+	if _, ok := up.proxies.Load(third); ok {
+		t.Errorf("Expected prune to drop the proxy of a backend the new load balancer doesn't have")
+	}
+
+	up.proxy(third)
+
+	if _, ok := up.proxies.Load(third); ok {
+		t.Errorf("Expected no proxy to be kept for a backend of the previous load balancer")
+	}
+}
+
+func BenchmarkServer_HandleProxy(b *testing.B) {
+	handler := benchmarkProxyHandler(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://app.example.com/", nil))
+	}
+}
+
+func BenchmarkParallelServer_HandleProxy(b *testing.B) {
+	handler := benchmarkProxyHandler(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://app.example.com/", nil))
+		}
+	})
+}
+
+func BenchmarkUpstream_Proxy(b *testing.B) {
+	up, be := benchmarkUpstream(b)
+	rec := newResponseRecorder(httptest.NewRecorder())
+	lb := balancer.New(nil, nil, 0)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		r := httptest.NewRequest(http.MethodGet, "http://app.example.com/", nil)
+		attempt := &proxyAttempt{rec: rec, r: r, lb: lb, be: be}
+		up.proxy(be).ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), proxyAttemptKey{}, attempt)))
+	}
+}
+
+// BenchmarkUpstream_PerRequestProxy builds a reverse proxy for every request the way proxyTo used to, as a baseline
+// for BenchmarkUpstream_Proxy.
+func BenchmarkUpstream_PerRequestProxy(b *testing.B) {
+	up, be := benchmarkUpstream(b)
+	rec := newResponseRecorder(httptest.NewRecorder())
+	lb := balancer.New(nil, nil, 0)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		r := httptest.NewRequest(http.MethodGet, "http://app.example.com/", nil)
+
+		var transportErr error
+
+		proxy := httputil.NewSingleHostReverseProxy(be.Url)
+		proxy.Transport = up.transport
+		proxy.ModifyResponse = func(*http.Response) error {
+			lb.Stick(rec, r, be)
+			return nil
+		}
+		proxy.ErrorHandler = func(_ http.ResponseWriter, _ *http.Request, err error) {
+			transportErr = err
+		}
+
+		proxy.ServeHTTP(rec, r)
+
+		if transportErr != nil {
+			b.Fatalf("Unexpected transport error = %v", transportErr)
+		}
+	}
+}
+
+// benchmarkUpstream returns an upstream whose responses come from a stub, and a backend to proxy to through it.
+func benchmarkUpstream(b *testing.B) (*upstream, *backend.Backend) {
+	b.Helper()
+
+	up, err := buildUpstream(&config.ApplicationConfig{})
+
+	if err != nil {
+		b.Fatalf("buildUpstream() returned an unexpected error = %v", err)
+	}
+
+	up.transport.RegisterProtocol("http", stubRoundTripper{})
+	be, _ := backend.NewFromString("http://127.0.0.1:1", "/health", nil)
+
+	return up, be
+}
+
+// benchmarkProxyHandler returns the public handler of a server proxying app.example.com, with its access log going
+// to a file. Responses come from a stub registered on the app's transport, so only the load balancer's own work is
+// measured.
+func benchmarkProxyHandler(b *testing.B) http.Handler {
+	b.Helper()
+
+	server, err := NewServer(0, writeConfig(b, fmt.Sprintf(`
+access_log:
+  output: %v
+apps:
+  - host: app.example.com
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 1h
+    instances:
+      - url: http://127.0.0.1:1`, filepath.Join(b.TempDir(), "access.log"))))
+
+	if err != nil {
+		b.Fatalf("NewServer() returned an unexpected error = %v", err)
+	}
+
+	server.routes.Load().upstreams["app.example.com"].transport.RegisterProtocol("http", stubRoundTripper{})
+
+	return server.publicHandler()
+}
+
+type stubRoundTripper struct{}
+
+func (stubRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       http.NoBody,
+		Request:    r,
+	}, nil
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"load-balancer/internal/config"
+	"os"
+	"time"
+)
+
+var ErrNoCaCertificates = errors.New("no PEM encoded certificates")
+
+// tlsVersions maps the min_version values the config accepts to their TLS versions.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func buildUpstreamTlsConfig(upstreamTls *config.UpstreamTlsConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         upstreamTls.ServerName,
+		InsecureSkipVerify: upstreamTls.InsecureSkipVerify,
+	}
+
+	if upstreamTls.MinVersion != "" {
+		version, known := tlsVersions[upstreamTls.MinVersion]
+
+		if !known {
+			return nil, fmt.Errorf("unknown TLS version %q", upstreamTls.MinVersion)
+		}
+
+		tlsConfig.MinVersion = version
+	}
+
+	if upstreamTls.CaFile != "" {
+		roots, err := loadCertPool(upstreamTls.CaFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.RootCAs = roots
+	}
+
+	if upstreamTls.CertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(upstreamTls.CertFile, upstreamTls.KeyFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+// upstreamTlsModTime is the latest modification time of the CA bundle, client certificate and key, or zero when there
+// are none. A missing file counts as zero, so it reads as a change once it appears.
+func upstreamTlsModTime(upstreamTls *config.UpstreamTlsConfig) time.Time {
+	var latest time.Time
+
+	if upstreamTls == nil {
+		return latest
+	}
+
+	for _, path := range []string{upstreamTls.CaFile, upstreamTls.CertFile, upstreamTls.KeyFile} {
+		if modified := modTime(path); path != "" && modified.After(latest) {
+			latest = modified
+		}
+	}
+
+	return latest
+}
+
+// loadCertPool reads a PEM bundle of CA certificates.
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	pemBytes, err := os.ReadFile(caFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+
+	if !pool.AppendCertsFromPEM(pemBytes) {
+		return nil, fmt.Errorf("%s: %w", caFile, ErrNoCaCertificates)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"load-balancer/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBuildTransport_UpstreamTls(t *testing.T) {
+	caFile, _ := writeTestCertificate(t, "backend.internal")
+	notPem := filepath.Join(t.TempDir(), "ca.pem")
+	_ = os.WriteFile(notPem, []byte("not a certificate"), 0o600)
+
+	scenarios := []struct {
+		name               string
+		upstreamTls        *config.UpstreamTlsConfig
+		expectedMinVersion uint16
+		expectedRoots      bool
+		expectedError      error
+	}{
+		{"No Upstream Tls", nil, 0, false, nil},
+		{"Min Version", &config.UpstreamTlsConfig{MinVersion: "1.3"}, tls.VersionTLS13, false, nil},
+		{"Ca File", &config.UpstreamTlsConfig{CaFile: caFile}, 0, true, nil},
+		{"Ca File Without Certificates", &config.UpstreamTlsConfig{CaFile: notPem}, 0, false, ErrNoCaCertificates},
+		{"Missing Ca File", &config.UpstreamTlsConfig{CaFile: filepath.Join(t.TempDir(), "missing.pem")}, 0, false, os.ErrNotExist},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			transport, err := buildTransport(&config.ApplicationConfig{UpstreamTls: scenario.upstreamTls})
+
+			if !errors.Is(err, scenario.expectedError) {
+				t.Fatalf("buildTransport() error = %v, expected %v", err, scenario.expectedError)
+			}
+
+			if err != nil {
+				return
+			}
+
+			tlsConfig := transport.TLSClientConfig
+
+			if tlsConfig == nil {
+				tlsConfig = &tls.Config{}
+			}
+
+			if tlsConfig.MinVersion != scenario.expectedMinVersion {
+				t.Errorf("MinVersion = %x, expected %x", tlsConfig.MinVersion, scenario.expectedMinVersion)
+			}
+
+			if actual := tlsConfig.RootCAs != nil; actual != scenario.expectedRoots {
+				t.Errorf("custom roots = %v, expected %v", actual, scenario.expectedRoots)
+			}
+		})
+	}
+}
+
+func TestServer_UpstreamTls_MutualTls(t *testing.T) {
+	serverCertFile, serverKeyFile := writeTestCertificate(t, "backend.internal")
+	clientCertFile, clientKeyFile := writeTestCertificate(t, "lb.internal")
+
+	serverCertificate, _ := tls.LoadX509KeyPair(serverCertFile, serverKeyFile)
+	clientCas := x509.NewCertPool()
+	clientPem, _ := os.ReadFile(clientCertFile)
+	clientCas.AppendCertsFromPEM(clientPem)
+
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	upstream.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCertificate},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCas,
+	}
+	upstream.StartTLS()
+	defer upstream.Close()
+
+	scenarios := []struct {
+		name           string
+		upstreamTls    string
+		expectedStatus int
+	}{
+		{"Custom Ca And Client Certificate", fmt.Sprintf(`
+      ca_file: %v
+      server_name: backend.internal
+      cert_file: %v
+      key_file: %v`, serverCertFile, clientCertFile, clientKeyFile), http.StatusOK},
+		{"Insecure Skip Verify", fmt.Sprintf(`
+      insecure_skip_verify: true
+      cert_file: %v
+      key_file: %v`, clientCertFile, clientKeyFile), http.StatusOK},
+		{"Without Client Certificate", fmt.Sprintf(`
+      ca_file: %v
+      server_name: backend.internal`, serverCertFile), http.StatusBadGateway},
+		{"Without Custom Ca", fmt.Sprintf(`
+      server_name: backend.internal
+      cert_file: %v
+      key_file: %v`, clientCertFile, clientKeyFile), http.StatusBadGateway},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			server, err := NewServer(0, writeConfig(t, fmt.Sprintf(`
+apps:
+  - host: app.example.com
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 1h
+    upstream_tls:%v
+    instances:
+      - url: %v`, scenario.upstreamTls, upstream.URL)))
+
+			if err != nil {
+				t.Fatalf("NewServer() returned an unexpected error = %v", err)
+			}
+
+			recorder := httptest.NewRecorder()
+			server.publicHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://app.example.com/", nil))
+
+			if recorder.Code != scenario.expectedStatus {
+				t.Fatalf("Expected status %v, got %v", scenario.expectedStatus, recorder.Code)
+			}
+
+			if scenario.expectedStatus == http.StatusOK && recorder.Body.String() != "lb.internal" {
+				t.Errorf("Expected the client certificate for lb.internal, got %q", recorder.Body.String())
+			}
+
+			// Health checks go over the same TLS settings as proxied requests.
+			be := server.loadBalancer("app.example.com").GetBackends()[0]
+			be.CheckHealth()
+
+			if expected := scenario.expectedStatus == http.StatusOK; be.IsHealthy() != expected {
+				t.Errorf("healthy = %v, expected %v", be.IsHealthy(), expected)
+			}
+		})
+	}
+}
+
+func TestServer_Reload_UpstreamTlsFilesChanged(t *testing.T) {
+	serverCertFile, serverKeyFile := writeTestCertificate(t, "backend.internal")
+	otherCertFile, _ := writeTestCertificate(t, "other.internal")
+	serverCertificate, _ := tls.LoadX509KeyPair(serverCertFile, serverKeyFile)
+
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	upstream.TLS = &tls.Config{Certificates: []tls.Certificate{serverCertificate}}
+	upstream.StartTLS()
+	defer upstream.Close()
+
+	// The CA bundle starts out trusting some other certificate.
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	otherPem, _ := os.ReadFile(otherCertFile)
+	_ = os.WriteFile(caFile, otherPem, 0o600)
+
+	server, err := NewServer(0, writeConfig(t, fmt.Sprintf(`
+apps:
+  - host: app.example.com
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 1h
+    upstream_tls:
+      ca_file: %v
+      server_name: backend.internal
+    instances:
+      - url: %v`, caFile, upstream.URL)))
+
+	if err != nil {
+		t.Fatalf("NewServer() returned an unexpected error = %v", err)
+	}
+
+	proxy := func() int {
+		recorder := httptest.NewRecorder()
+		server.publicHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://app.example.com/", nil))
+
+		return recorder.Code
+	}
+
+	if status := proxy(); status != http.StatusBadGateway {
+		t.Fatalf("Expected the instance to be untrusted, got status %v", status)
+	}
+
+	before := server.routes.Load()
+	modified := server.upstreamTlsModTimes()
+
+	// The CA bundle is rotated in place, without touching the config.
+	serverPem, _ := os.ReadFile(serverCertFile)
+	_ = os.WriteFile(caFile, serverPem, 0o600)
+	_ = os.Chtimes(caFile, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+
+	if after := server.upstreamTlsModTimes(); after["app.example.com"].Equal(modified["app.example.com"]) {
+		t.Fatalf("Expected the rotated CA bundle to be noticed")
+	}
+
+	if err := server.reload(context.Background()); err != nil {
+		t.Fatalf("reload() returned an unexpected error = %v", err)
+	}
+
+	if server.routes.Load().upstreams["app.example.com"] == before.upstreams["app.example.com"] {
+		t.Errorf("Expected a new transport for the rotated CA bundle")
+	}
+
+	if server.loadBalancer("app.example.com") == before.loadBalancers["app.example.com"] {
+		t.Errorf("Expected the load balancer to be rebuilt so health checks use the new transport")
+	}
+
+	if status := proxy(); status != http.StatusOK {
+		t.Errorf("Expected the instance to be trusted with the rotated CA bundle, got status %v", status)
+	}
+}
@@ -1,7 +1,6 @@
 package backend
 
 import (
-	"context"
 	"errors"
 	"net/http"
 	"net/url"
@@ -12,19 +11,32 @@ import (
 
 type Backend struct {
 	Url               *url.URL
-	healthUri         string
+	healthCheck       HealthCheck
 	healthy           *atomic.Bool
 	httpClient        *http.Client
+	grpcClient        *http.Client
 	mutex             sync.Mutex
 	activeConnections *atomic.Int32
+	weight            int
+	latency           latencyTracker
+	outliers          *outlierDetector
+	circuit           *circuitBreaker
+	healthCheckStreak healthCheckStreak
+	observer          HealthCheckObserver
 }
 
 var UrlParseError = errors.New("invalid url")
 var ErrInvalidScheme = errors.New("missing or invalid scheme")
 var ErrMissingHost = errors.New("missing host")
 var ErrMissingHealthUri = errors.New("missing health uri")
+var ErrInvalidHealthCheckType = errors.New("invalid health check type")
+var ErrInvalidWeight = errors.New("weight must be positive")
 
 func NewFromString(rawUrl string, healthUri string, httpClient *http.Client) (*Backend, error) {
+	return NewWithHealthCheck(rawUrl, HealthCheck{Uri: healthUri}, httpClient)
+}
+
+func NewWithHealthCheck(rawUrl string, healthCheck HealthCheck, httpClient *http.Client) (*Backend, error) {
 	backendUrl, err := url.Parse(rawUrl)
 
 	if err != nil {
@@ -39,16 +51,28 @@ func NewFromString(rawUrl string, healthUri string, httpClient *http.Client) (*B
 		return nil, ErrMissingHost
 	}
 
-	if healthUri == "" {
-		return nil, ErrMissingHealthUri
+	switch healthCheck.Type {
+	case "", HealthCheckHttp:
+		if healthCheck.Uri == "" {
+			return nil, ErrMissingHealthUri
+		}
+	case HealthCheckTcp, HealthCheckGrpc:
+	default:
+		return nil, ErrInvalidHealthCheckType
 	}
 
-	return NewFromUrl(backendUrl, healthUri, httpClient)
+	return newFromUrl(backendUrl, healthCheck, httpClient), nil
 }
 
+// NewFromUrl builds a backend with a plain HTTP health check on healthUri. It is validated the same way as
+// NewWithHealthCheck.
 func NewFromUrl(url *url.URL, healthUri string, httpClient *http.Client) (*Backend, error) {
+	return NewWithHealthCheck(url.String(), HealthCheck{Uri: healthUri}, httpClient)
+}
+
+func newFromUrl(url *url.URL, healthCheck HealthCheck, httpClient *http.Client) *Backend {
 	healthy := &atomic.Bool{}
-	healthy.Store(true)
+	healthy.Store(!healthCheck.StartUnhealthy)
 	activeConnections := &atomic.Int32{}
 	activeConnections.Store(0)
 
@@ -56,45 +80,111 @@ func NewFromUrl(url *url.URL, healthUri string, httpClient *http.Client) (*Backe
 		httpClient = http.DefaultClient
 	}
 
-	return &Backend{url, healthUri, healthy, httpClient, sync.Mutex{}, activeConnections}, nil
+	be := &Backend{
+		Url:               url,
+		healthCheck:       healthCheck.withDefaults(),
+		healthy:           healthy,
+		httpClient:        httpClient,
+		activeConnections: activeConnections,
+		weight:            1,
+	}
+
+	if be.healthCheck.Type == HealthCheckGrpc {
+		be.grpcClient = newGrpcClient(url, httpClient)
+	}
+
+	return be
 }
 
-func (be *Backend) StartHealthCheck(ctx context.Context, cooldown time.Duration) {
-	ticker := time.NewTicker(cooldown)
-	defer ticker.Stop()
+// IsHealthy reports whether the backend passed its last health check, isn't currently ejected by outlier detection and
+// its circuit breaker would let a request through. It changes nothing; TryAcquire reserves the request.
+func (be *Backend) IsHealthy() bool {
+	return be.healthy.Load() && !be.IsEjected() && (be.circuit == nil || be.circuit.allows(time.Now()))
+}
 
-	for {
-		select {
-		case <-ticker.C:
-			be.CheckHealth()
-		case <-ctx.Done():
-			return
-		}
+// PassedHealthCheck reports the result of the backend's active health checks alone, whatever outlier detection and
+// its circuit breaker make of it.
+func (be *Backend) PassedHealthCheck() bool {
+	return be.healthy.Load()
+}
+
+// IsEjected reports whether outlier detection has taken the backend out of rotation.
+func (be *Backend) IsEjected() bool {
+	return be.outliers != nil && be.outliers.isEjected(time.Now())
+}
+
+// SetOutlierDetection turns on passive health checking from the results passed to RecordSuccess and RecordFailure.
+// It must be called before the backend starts taking traffic.
+func (be *Backend) SetOutlierDetection(settings OutlierDetection) {
+	be.outliers = newOutlierDetector(settings)
+}
+
+// SetCircuitBreaker turns on a circuit breaker fed by the results of the attempts taken with TryAcquire. It must be
+// called before the backend starts taking traffic.
+func (be *Backend) SetCircuitBreaker(settings CircuitBreaker) {
+	be.circuit = newCircuitBreaker(settings)
+}
+
+// CircuitState is the state of the backend's circuit breaker, CircuitClosed when it has none. An open circuit whose
+// cool-off has passed stays CircuitOpen until a request is sent to it.
+func (be *Backend) CircuitState() CircuitState {
+	if be.circuit == nil {
+		return CircuitClosed
 	}
+
+	return CircuitState(be.circuit.state.Load())
+}
+
+// Attempt is one request sent to a backend, from TryAcquire until its result is recorded.
+type Attempt struct {
+	be         *Backend
+	generation uint64
 }
 
-func (be *Backend) CheckHealth() {
-	if !be.mutex.TryLock() {
-		return
+// TryAcquire reserves the backend for a request about to be sent to it, once a strategy has picked it. It returns
+// false when the circuit breaker doesn't let the request through, because it is open or because the half-open probes
+// are all taken, and the request should go to another backend. Exactly one of the attempt's Record methods should be
+// called once the request has ended.
+func (be *Backend) TryAcquire() (Attempt, bool) {
+	if be.circuit == nil {
+		return Attempt{be: be}, true
 	}
-	defer be.mutex.Unlock()
 
-	healthUrl := be.Url.JoinPath(be.healthUri)
+	generation, ok := be.circuit.tryAcquire(time.Now())
 
-	resp, err := be.httpClient.Get(healthUrl.String())
+	return Attempt{be: be, generation: generation}, ok
+}
 
-	if err != nil {
-		be.SetHealth(false)
-		return
+func (attempt Attempt) RecordSuccess() {
+	be := attempt.be
+
+	if be.outliers != nil {
+		be.outliers.recordSuccess()
 	}
 
-	defer resp.Body.Close()
+	if be.circuit != nil {
+		be.circuit.record(true, attempt.generation, time.Now())
+	}
+}
+
+func (attempt Attempt) RecordFailure() {
+	be := attempt.be
 
-	be.SetHealth(http.StatusOK <= resp.StatusCode && resp.StatusCode < 300)
+	if be.outliers != nil {
+		be.outliers.recordFailure(time.Now())
+	}
+
+	if be.circuit != nil {
+		be.circuit.record(false, attempt.generation, time.Now())
+	}
 }
 
-func (be *Backend) IsHealthy() bool {
-	return be.healthy.Load()
+// RecordAbandoned is for a request that ended without telling anything about the backend, such as one the client
+// cancelled. It counts as neither a success nor a failure.
+func (attempt Attempt) RecordAbandoned() {
+	if attempt.be.circuit != nil {
+		attempt.be.circuit.abandon(attempt.generation)
+	}
 }
 
 func (be *Backend) SetHealth(healthy bool) {
@@ -112,3 +202,27 @@ func (be *Backend) AddConnection() {
 func (be *Backend) ReleaseConnection() {
 	be.activeConnections.Add(-1)
 }
+
+func (be *Backend) Weight() int {
+	return be.weight
+}
+
+func (be *Backend) SetWeight(weight int) error {
+	if weight <= 0 {
+		return ErrInvalidWeight
+	}
+
+	be.weight = weight
+
+	return nil
+}
+
+// Latency is the peak EWMA of the response times passed to ObserveLatency, decayed for the time since the last one but
+// no lower than half of it, or zero if none have been observed yet.
+func (be *Backend) Latency() time.Duration {
+	return be.latency.load(time.Now())
+}
+
+func (be *Backend) ObserveLatency(latency time.Duration) {
+	be.latency.observe(latency, time.Now())
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -43,6 +44,46 @@ func TestBackend_NewFromString(t *testing.T) {
 	}
 }
 
+func TestBackend_NewWithHealthCheck(t *testing.T) {
+	scenarios := []struct {
+		HealthCheck   HealthCheck
+		ExpectedError error
+	}{
+		{HealthCheck{Uri: "/health"}, nil},
+		{HealthCheck{Type: HealthCheckHttp, Uri: "/health"}, nil},
+		{HealthCheck{Type: HealthCheckHttp}, ErrMissingHealthUri},
+		{HealthCheck{Type: HealthCheckTcp}, nil},
+		{HealthCheck{Type: HealthCheckGrpc}, nil},
+		{HealthCheck{Type: HealthCheckGrpc, GrpcService: "payments"}, nil},
+		{HealthCheck{Type: "icmp"}, ErrInvalidHealthCheckType},
+	}
+
+	for _, scenario := range scenarios {
+		_, err := NewWithHealthCheck("http://valid.com", scenario.HealthCheck, nil)
+
+		if !errors.Is(err, scenario.ExpectedError) {
+			t.Errorf("NewWithHealthCheck(%+v) error = %v, expected %v", scenario.HealthCheck, err, scenario.ExpectedError)
+		}
+	}
+}
+
+func TestBackend_NewFromUrl(t *testing.T) {
+	backendUrl, _ := url.Parse("http://valid.com")
+	be, err := NewFromUrl(backendUrl, "/health", nil)
+
+	if err != nil {
+		t.Fatalf("NewFromUrl() returned an unexpected error = %v", err)
+	}
+
+	if be.Url.String() != "http://valid.com" || be.healthCheck.Uri != "/health" {
+		t.Errorf("NewFromUrl() = %v with health uri %v", be.Url, be.healthCheck.Uri)
+	}
+
+	if _, err = NewFromUrl(backendUrl, "", nil); !errors.Is(err, ErrMissingHealthUri) {
+		t.Errorf("NewFromUrl() error = %v, expected %v", err, ErrMissingHealthUri)
+	}
+}
+
 func TestBackend_CheckHealth(t *testing.T) {
 	scenarios := []struct {
 		name           string
@@ -129,6 +170,33 @@ func TestBackend_SetHealth(t *testing.T) {
 	}
 }
 
+func TestBackend_SetWeight(t *testing.T) {
+	scenarios := []struct {
+		SetTo         int
+		Expected      int
+		ExpectedError error
+	}{
+		{SetTo: 5, Expected: 5, ExpectedError: nil},
+		{SetTo: 1, Expected: 1, ExpectedError: nil},
+		{SetTo: 0, Expected: 1, ExpectedError: ErrInvalidWeight},
+		{SetTo: -3, Expected: 1, ExpectedError: ErrInvalidWeight},
+	}
+
+	for _, scenario := range scenarios {
+		be, _ := NewFromString("http://www.test.com", "/health", nil)
+
+		err := be.SetWeight(scenario.SetTo)
+
+		if !errors.Is(err, scenario.ExpectedError) {
+			t.Errorf("SetWeight(%v) expected error %v, actual %v", scenario.SetTo, scenario.ExpectedError, err)
+		}
+
+		if scenario.Expected != be.Weight() {
+			t.Errorf("SetWeight(%v) expected weight %v, actual %v", scenario.SetTo, scenario.Expected, be.Weight())
+		}
+	}
+}
+
 func BenchmarkNewFromString(b *testing.B) {
 	for n := 0; n < b.N; n++ {
 		_, _ = NewFromString("http://www.test.com", "/health", nil)
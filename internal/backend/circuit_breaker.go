@@ -0,0 +1,225 @@
+package backend
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultErrorRate        = 0.5
+	DefaultMinRequests      = 20
+	DefaultWindow           = 10 * time.Second
+	DefaultCoolOff          = 30 * time.Second
+	DefaultHalfOpenRequests = 1
+)
+
+// circuitBuckets is how many slices the rolling window is split into. Each slice expires as a whole, so the window
+// rolls forward a tenth of its length at a time.
+const circuitBuckets = 10
+
+// CircuitState is the state of a backend's circuit breaker.
+type CircuitState int32
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+const (
+	circuitClosed   = int32(CircuitClosed)
+	circuitOpen     = int32(CircuitOpen)
+	circuitHalfOpen = int32(CircuitHalfOpen)
+)
+
+// CircuitBreaker configures a circuit breaker: once at least MinRequests requests have finished within the last
+// Window and ErrorRate of them or more failed, the circuit opens and the backend is taken out of rotation. After
+// CoolOff it goes half-open and lets HalfOpenRequests requests through; if all of them succeed the circuit closes,
+// and if any fails it opens again.
+type CircuitBreaker struct {
+	ErrorRate        float64
+	MinRequests      int
+	Window           time.Duration
+	CoolOff          time.Duration
+	HalfOpenRequests int
+}
+
+type circuitBucket struct {
+	slot     int64
+	requests int
+	failures int
+}
+
+// circuitBreaker moves to a new generation on every change of state. Requests are stamped with the generation they
+// were sent in, so a result that arrives after the circuit has moved on, such as one from a request sent before the
+// circuit opened, is ignored instead of being taken for a half-open probe.
+type circuitBreaker struct {
+	settings   CircuitBreaker
+	state      atomic.Int32
+	generation atomic.Uint64
+	mutex      sync.Mutex
+	buckets    [circuitBuckets]circuitBucket
+	openedAt   time.Time
+	probes     int
+	successes  int
+}
+
+func newCircuitBreaker(settings CircuitBreaker) *circuitBreaker {
+	if settings.ErrorRate <= 0 || settings.ErrorRate > 1 {
+		settings.ErrorRate = DefaultErrorRate
+	}
+
+	if settings.MinRequests <= 0 {
+		settings.MinRequests = DefaultMinRequests
+	}
+
+	if settings.Window <= 0 {
+		settings.Window = DefaultWindow
+	}
+
+	if settings.CoolOff <= 0 {
+		settings.CoolOff = DefaultCoolOff
+	}
+
+	if settings.HalfOpenRequests <= 0 {
+		settings.HalfOpenRequests = DefaultHalfOpenRequests
+	}
+
+	return &circuitBreaker{settings: settings}
+}
+
+// allows reports whether a request could be sent: the circuit is closed, its cool-off has passed, or it is half-open
+// with probes left. It changes nothing, so it is safe to call from anywhere; tryAcquire reserves the request.
+func (cb *circuitBreaker) allows(now time.Time) bool {
+	if cb.state.Load() == circuitClosed {
+		return true
+	}
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	switch cb.state.Load() {
+	case circuitOpen:
+		return now.Sub(cb.openedAt) >= cb.settings.CoolOff
+	case circuitHalfOpen:
+		return cb.probes < cb.settings.HalfOpenRequests
+	default:
+		return true
+	}
+}
+
+// tryAcquire reserves a request, returning the generation to record its result against, or false if the circuit
+// doesn't let it through. An open circuit whose cool-off has passed goes half-open here, with this request as its
+// first probe, and a half-open one hands out at most HalfOpenRequests probes.
+func (cb *circuitBreaker) tryAcquire(now time.Time) (uint64, bool) {
+	// The generation is read first: if the circuit changes state in between, the request is stamped with a
+	// generation that has already passed and its result is ignored.
+	if generation := cb.generation.Load(); cb.state.Load() == circuitClosed {
+		return generation, true
+	}
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	switch cb.state.Load() {
+	case circuitOpen:
+		if now.Sub(cb.openedAt) < cb.settings.CoolOff {
+			return 0, false
+		}
+
+		cb.setState(circuitHalfOpen)
+		cb.probes, cb.successes = 1, 0
+	case circuitHalfOpen:
+		if cb.probes >= cb.settings.HalfOpenRequests {
+			return 0, false
+		}
+
+		cb.probes++
+	}
+
+	return cb.generation.Load(), true
+}
+
+// abandon gives back the half-open probe taken by a request that ended without a result, such as one the client
+// cancelled, so the circuit isn't left waiting for an answer that will never come.
+func (cb *circuitBreaker) abandon(generation uint64) {
+	if cb.state.Load() != circuitHalfOpen {
+		return
+	}
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if cb.state.Load() == circuitHalfOpen && cb.generation.Load() == generation && cb.probes > 0 {
+		cb.probes--
+	}
+}
+
+// record counts the result of a request sent in generation, unless the circuit has changed state since.
+func (cb *circuitBreaker) record(succeeded bool, generation uint64, now time.Time) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if cb.generation.Load() != generation {
+		return
+	}
+
+	switch cb.state.Load() {
+	case circuitOpen:
+		// Only a request that raced the circuit opening is stamped with an open generation.
+	case circuitHalfOpen:
+		if !succeeded {
+			cb.open(now)
+			return
+		}
+
+		if cb.successes++; cb.successes >= cb.settings.HalfOpenRequests {
+			cb.buckets = [circuitBuckets]circuitBucket{}
+			cb.setState(circuitClosed)
+		}
+	default:
+		cb.recordClosed(succeeded, now)
+	}
+}
+
+func (cb *circuitBreaker) recordClosed(succeeded bool, now time.Time) {
+	bucketWidth := int64(cb.settings.Window / circuitBuckets)
+	slot := now.UnixNano() / max(bucketWidth, 1)
+	bucket := &cb.buckets[slot%circuitBuckets]
+
+	if bucket.slot != slot {
+		*bucket = circuitBucket{slot: slot}
+	}
+
+	bucket.requests++
+
+	if !succeeded {
+		bucket.failures++
+	}
+
+	requests, failures := 0, 0
+
+	for _, bucket := range cb.buckets {
+		if slot-bucket.slot < circuitBuckets {
+			requests += bucket.requests
+			failures += bucket.failures
+		}
+	}
+
+	if requests >= cb.settings.MinRequests && float64(failures) >= cb.settings.ErrorRate*float64(requests) {
+		cb.open(now)
+	}
+}
+
+// open trips the circuit; the caller holds the mutex.
+func (cb *circuitBreaker) open(now time.Time) {
+	cb.openedAt = now
+	cb.setState(circuitOpen)
+}
+
+// setState moves the circuit to state in a new generation; the caller holds the mutex.
+func (cb *circuitBreaker) setState(state int32) {
+	cb.generation.Add(1)
+	cb.state.Store(state)
+}
@@ -0,0 +1,227 @@
+package backend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker_Opens(t *testing.T) {
+	scenarios := []struct {
+		name         string
+		results      []bool
+		expectedOpen bool
+	}{
+		{"No Results", []bool{}, false},
+		{"Below Min Requests", []bool{false, false, false}, false},
+		{"Below Error Rate", []bool{true, true, false, true}, false},
+		{"Reaches Error Rate", []bool{true, false, true, false}, true},
+		{"All Failed", []bool{false, false, false, false}, true},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			now := time.Now()
+			cb := newCircuitBreaker(CircuitBreaker{ErrorRate: 0.5, MinRequests: 4, Window: time.Minute, CoolOff: time.Minute})
+
+			for _, succeeded := range scenario.results {
+				recordResult(cb, succeeded, now)
+			}
+
+			if actual := !cb.allows(now); actual != scenario.expectedOpen {
+				t.Errorf("open = %v, expected %v", actual, scenario.expectedOpen)
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker_WindowRolls(t *testing.T) {
+	cb := newCircuitBreaker(CircuitBreaker{ErrorRate: 0.5, MinRequests: 4, Window: 10 * time.Second, CoolOff: time.Minute})
+	now := time.Now()
+
+	recordResult(cb, false, now)
+	recordResult(cb, false, now)
+	recordResult(cb, false, now)
+
+	// The first three failures have left the window, so this one alone doesn't open the circuit.
+	now = now.Add(11 * time.Second)
+	recordResult(cb, false, now)
+
+	if !cb.allows(now) {
+		t.Errorf("Expected failures older than the window not to count")
+	}
+}
+
+func TestCircuitBreaker_HalfOpen(t *testing.T) {
+	scenarios := []struct {
+		name           string
+		probeResults   []bool
+		expectedClosed bool
+	}{
+		{"Probes Succeed", []bool{true, true}, true},
+		{"Probe Fails", []bool{true, false}, false},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			cb := newCircuitBreaker(CircuitBreaker{ErrorRate: 0.5, MinRequests: 1, Window: time.Minute, CoolOff: 10 * time.Second, HalfOpenRequests: 2})
+			now := time.Now()
+			recordResult(cb, false, now)
+
+			if _, ok := cb.tryAcquire(now.Add(10*time.Second - time.Millisecond)); ok {
+				t.Fatalf("Expected the circuit to stay open until the cool-off has passed")
+			}
+
+			now = now.Add(10 * time.Second)
+			var generations []uint64
+
+			for range 2 {
+				generation, ok := cb.tryAcquire(now)
+
+				if !ok {
+					t.Fatalf("Expected the half-open circuit to allow a probe")
+				}
+
+				generations = append(generations, generation)
+			}
+
+			if _, ok := cb.tryAcquire(now); ok || cb.allows(now) {
+				t.Fatalf("Expected the half-open circuit to allow only 2 probes")
+			}
+
+			for i, succeeded := range scenario.probeResults {
+				cb.record(succeeded, generations[i], now)
+			}
+
+			if actual := cb.state.Load() == circuitClosed; actual != scenario.expectedClosed {
+				t.Errorf("closed = %v, expected %v", actual, scenario.expectedClosed)
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker_Allows_ChangesNothing(t *testing.T) {
+	cb := newCircuitBreaker(CircuitBreaker{ErrorRate: 0.5, MinRequests: 1, Window: time.Minute, CoolOff: 10 * time.Second, HalfOpenRequests: 1})
+	now := time.Now()
+	recordResult(cb, false, now)
+	now = now.Add(10 * time.Second)
+
+	// Strategies, the report and metric scrapes all ask; none of them may use up the probe.
+	for range 5 {
+		if !cb.allows(now) {
+			t.Fatalf("Expected the circuit to allow a probe once the cool-off has passed")
+		}
+	}
+
+	if cb.state.Load() != circuitOpen {
+		t.Fatalf("Expected allows() to leave the circuit open")
+	}
+
+	if _, ok := cb.tryAcquire(now); !ok {
+		t.Errorf("Expected the probe to still be there after allows()")
+	}
+}
+
+func TestCircuitBreaker_StaleResults(t *testing.T) {
+	cb := newCircuitBreaker(CircuitBreaker{ErrorRate: 0.5, MinRequests: 1, Window: time.Minute, CoolOff: 10 * time.Second, HalfOpenRequests: 1})
+	now := time.Now()
+
+	// Two requests are sent while the circuit is closed, then another one fails and opens it.
+	slowSuccess, _ := cb.tryAcquire(now)
+	slowFailure, _ := cb.tryAcquire(now)
+	recordResult(cb, false, now)
+
+	now = now.Add(10 * time.Second)
+	probe, ok := cb.tryAcquire(now)
+
+	if !ok {
+		t.Fatalf("Expected the half-open circuit to allow a probe")
+	}
+
+	cb.record(false, slowFailure, now)
+	cb.abandon(slowFailure)
+
+	if cb.state.Load() != circuitHalfOpen || cb.allows(now) {
+		t.Fatalf("Expected a failure sent before the circuit opened to neither reopen it nor free the probe")
+	}
+
+	cb.record(true, slowSuccess, now)
+
+	if cb.state.Load() != circuitHalfOpen {
+		t.Fatalf("Expected a success sent before the circuit opened not to count as the probe")
+	}
+
+	cb.record(true, probe, now)
+
+	if cb.state.Load() != circuitClosed {
+		t.Errorf("Expected the circuit to close once the probe succeeded")
+	}
+}
+
+func TestCircuitBreaker_HalfOpen_AbandonedProbe(t *testing.T) {
+	cb := newCircuitBreaker(CircuitBreaker{ErrorRate: 0.5, MinRequests: 1, Window: time.Minute, CoolOff: 10 * time.Second, HalfOpenRequests: 1})
+	now := time.Now()
+	recordResult(cb, false, now)
+	now = now.Add(10 * time.Second)
+
+	generation, ok := cb.tryAcquire(now)
+
+	if !ok {
+		t.Fatalf("Expected the half-open circuit to allow a probe")
+	}
+
+	cb.abandon(generation)
+
+	if generation, ok = cb.tryAcquire(now); !ok {
+		t.Fatalf("Expected an abandoned probe to free its slot")
+	}
+
+	cb.record(true, generation, now)
+
+	if cb.state.Load() != circuitClosed {
+		t.Errorf("Expected the circuit to close once the next probe succeeded")
+	}
+}
+
+func TestNewCircuitBreaker_Defaults(t *testing.T) {
+	cb := newCircuitBreaker(CircuitBreaker{})
+	expected := CircuitBreaker{
+		ErrorRate:        DefaultErrorRate,
+		MinRequests:      DefaultMinRequests,
+		Window:           DefaultWindow,
+		CoolOff:          DefaultCoolOff,
+		HalfOpenRequests: DefaultHalfOpenRequests,
+	}
+
+	if cb.settings != expected {
+		t.Errorf("settings = %+v, expected %+v", cb.settings, expected)
+	}
+}
+
+func TestBackend_IsHealthy_CircuitBreaker(t *testing.T) {
+	be, _ := NewFromString("http://www.test.com", "/health", nil)
+	be.SetCircuitBreaker(CircuitBreaker{MinRequests: 2, CoolOff: time.Hour})
+
+	attempt, _ := be.TryAcquire()
+	attempt.RecordSuccess()
+
+	if !be.IsHealthy() {
+		t.Fatalf("Expected a closed circuit to leave the backend healthy")
+	}
+
+	attempt, _ = be.TryAcquire()
+	attempt.RecordFailure()
+
+	if be.IsHealthy() {
+		t.Errorf("Expected an open circuit to take the backend out of rotation")
+	}
+
+	if _, ok := be.TryAcquire(); ok {
+		t.Errorf("Expected an open circuit to turn requests away")
+	}
+}
+
+// recordResult records the result of a request sent at now, as the proxy does.
+func recordResult(cb *circuitBreaker, succeeded bool, now time.Time) {
+	generation, _ := cb.tryAcquire(now)
+	cb.record(succeeded, generation, now)
+}
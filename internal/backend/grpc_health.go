@@ -0,0 +1,160 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// grpcHealthCheckPath is the method of the standard gRPC health checking protocol (grpc.health.v1).
+const grpcHealthCheckPath = "/grpc.health.v1.Health/Check"
+
+// grpcServing is HealthCheckResponse.ServingStatus.SERVING.
+const grpcServing = 1
+
+// newGrpcClient returns a client that speaks HTTP/2 to the backend, which gRPC requires: over TLS for https
+// backends and in cleartext (h2c) for http ones. It starts from the http client's transport when that is an
+// *http.Transport, so TLS settings carry over.
+func newGrpcClient(backendUrl *url.URL, httpClient *http.Client) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if base, ok := httpClient.Transport.(*http.Transport); ok {
+		transport = base.Clone()
+	}
+
+	protocols := new(http.Protocols)
+
+	if backendUrl.Scheme == "https" {
+		protocols.SetHTTP2(true)
+	} else {
+		protocols.SetUnencryptedHTTP2(true)
+	}
+
+	transport.Protocols = protocols
+
+	return &http.Client{Transport: transport}
+}
+
+// probeGrpc calls grpc.health.v1.Health/Check and passes only if the call succeeds and reports SERVING. The protocol
+// is small enough that the request and response messages are encoded by hand rather than pulling in gRPC.
+func (be *Backend) probeGrpc() bool {
+	ctx, cancel := be.healthCheckContext()
+	defer cancel()
+
+	body := bytes.NewReader(encodeGrpcHealthCheckRequest(be.healthCheck.GrpcService))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, be.Url.JoinPath(grpcHealthCheckPath).String(), body)
+
+	if err != nil {
+		return false
+	}
+
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	resp, err := be.grpcClient.Do(req)
+
+	if err != nil {
+		return false
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false
+	}
+
+	frame, err := io.ReadAll(io.LimitReader(resp.Body, maxHealthCheckBody))
+
+	if err != nil {
+		return false
+	}
+
+	// Errors may come back as a trailers-only response, which puts grpc-status in the headers.
+	grpcStatus := resp.Trailer.Get("Grpc-Status")
+
+	if grpcStatus == "" {
+		grpcStatus = resp.Header.Get("Grpc-Status")
+	}
+
+	if grpcStatus != "0" {
+		return false
+	}
+
+	servingStatus, ok := decodeGrpcHealthCheckResponse(frame)
+
+	return ok && servingStatus == grpcServing
+}
+
+// encodeGrpcHealthCheckRequest frames a HealthCheckRequest{service = 1} message: a zero compression flag, the
+// big-endian message length, then the protobuf encoding of the service name.
+func encodeGrpcHealthCheckRequest(service string) []byte {
+	var message []byte
+
+	if service != "" {
+		message = append(message, 1<<3|2)
+		message = binary.AppendUvarint(message, uint64(len(service)))
+		message = append(message, service...)
+	}
+
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+
+	return append(frame, message...)
+}
+
+// decodeGrpcHealthCheckResponse reads the status field from a framed HealthCheckResponse{status = 1}, skipping any
+// fields it doesn't know. A missing status field is UNKNOWN, which protobuf encodes by leaving it out.
+func decodeGrpcHealthCheckResponse(frame []byte) (uint64, bool) {
+	if len(frame) < 5 || frame[0] != 0 {
+		return 0, false
+	}
+
+	length := binary.BigEndian.Uint32(frame[1:5])
+	message := frame[5:]
+
+	if uint64(len(message)) < uint64(length) {
+		return 0, false
+	}
+
+	message = message[:length]
+	var status uint64
+
+	for len(message) > 0 {
+		key, n := binary.Uvarint(message)
+
+		if n <= 0 {
+			return 0, false
+		}
+
+		message = message[n:]
+
+		switch key & 7 {
+		case 0:
+			value, n := binary.Uvarint(message)
+
+			if n <= 0 {
+				return 0, false
+			}
+
+			message = message[n:]
+
+			if key>>3 == 1 {
+				status = value
+			}
+		case 2:
+			fieldLength, n := binary.Uvarint(message)
+
+			if n <= 0 || uint64(len(message)-n) < fieldLength {
+				return 0, false
+			}
+
+			message = message[n+int(fieldLength):]
+		default:
+			return 0, false
+		}
+	}
+
+	return status, true
+}
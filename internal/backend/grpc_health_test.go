@@ -0,0 +1,147 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEncodeGrpcHealthCheckRequest(t *testing.T) {
+	scenarios := []struct {
+		service  string
+		expected []byte
+	}{
+		{"", []byte{0, 0, 0, 0, 0}},
+		{"svc", []byte{0, 0, 0, 0, 5, 0x0a, 3, 's', 'v', 'c'}},
+	}
+
+	for _, scenario := range scenarios {
+		if actual := encodeGrpcHealthCheckRequest(scenario.service); !bytes.Equal(actual, scenario.expected) {
+			t.Errorf("encodeGrpcHealthCheckRequest(%q) = %v, expected %v", scenario.service, actual, scenario.expected)
+		}
+	}
+}
+
+func TestDecodeGrpcHealthCheckResponse(t *testing.T) {
+	scenarios := []struct {
+		name           string
+		frame          []byte
+		expectedStatus uint64
+		expectedOk     bool
+	}{
+		{"Serving", grpcFrame(0x08, 1), grpcServing, true},
+		{"Not Serving", grpcFrame(0x08, 2), 2, true},
+		{"Unknown Status Left Out", grpcFrame(), 0, true},
+		{"Unknown Fields Skipped", grpcFrame(0x12, 2, 'h', 'i', 0x08, 1), grpcServing, true},
+		{"Compressed", append([]byte{1}, grpcFrame(0x08, 1)[1:]...), 0, false},
+		{"Truncated Frame", grpcFrame(0x08, 1)[:6], 0, false},
+		{"Too Short", []byte{0, 0}, 0, false},
+		{"Unsupported Wire Type", grpcFrame(0x0d, 1, 2, 3, 4), 0, false},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			status, ok := decodeGrpcHealthCheckResponse(scenario.frame)
+
+			if ok != scenario.expectedOk || status != scenario.expectedStatus {
+				t.Errorf("decodeGrpcHealthCheckResponse() = (%v, %v), expected (%v, %v)", status, ok, scenario.expectedStatus, scenario.expectedOk)
+			}
+		})
+	}
+}
+
+func TestBackend_CheckHealth_Grpc(t *testing.T) {
+	scenarios := []struct {
+		name           string
+		service        string
+		response       []byte
+		grpcStatus     string
+		trailersOnly   bool
+		expectedHealth bool
+	}{
+		{"Serving", "", grpcFrame(0x08, 1), "0", false, true},
+		{"Named Service Serving", "payments", grpcFrame(0x08, 1), "0", false, true},
+		{"Not Serving", "", grpcFrame(0x08, 2), "0", false, false},
+		{"Unknown Service", "missing", nil, "5", true, false},
+		{"Unimplemented", "", nil, "12", true, false},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			var path, contentType, service string
+
+			testServer := newGrpcTestServer(func(w http.ResponseWriter, r *http.Request) {
+				path, contentType = r.URL.Path, r.Header.Get("Content-Type")
+				request, _ := io.ReadAll(r.Body)
+
+				if len(request) > 7 {
+					service = string(request[7:])
+				}
+
+				w.Header().Set("Content-Type", "application/grpc")
+
+				if scenario.trailersOnly {
+					w.Header().Set("Grpc-Status", scenario.grpcStatus)
+					return
+				}
+
+				w.Header().Set("Trailer", "Grpc-Status")
+				_, _ = w.Write(scenario.response)
+				w.Header().Set("Grpc-Status", scenario.grpcStatus)
+			})
+			defer testServer.Close()
+
+			be, _ := NewWithHealthCheck(testServer.URL, HealthCheck{Type: HealthCheckGrpc, GrpcService: scenario.service}, nil)
+			be.SetHealth(!scenario.expectedHealth)
+
+			be.CheckHealth()
+
+			if be.IsHealthy() != scenario.expectedHealth {
+				t.Errorf("IsHealthy() = %v, expected %v", be.IsHealthy(), scenario.expectedHealth)
+			}
+
+			if path != grpcHealthCheckPath || contentType != "application/grpc" || service != scenario.service {
+				t.Errorf("Health check called %v with content type %v for service %q", path, contentType, service)
+			}
+		})
+	}
+}
+
+func TestBackend_CheckHealth_Tcp(t *testing.T) {
+	testServer := httptest.NewServer(http.NotFoundHandler())
+	be, _ := NewWithHealthCheck(testServer.URL, HealthCheck{Type: HealthCheckTcp}, nil)
+
+	be.SetHealth(false)
+	be.CheckHealth()
+
+	if !be.IsHealthy() {
+		t.Errorf("Expected a listening backend to pass a TCP check")
+	}
+
+	testServer.Close()
+	be.CheckHealth()
+
+	if be.IsHealthy() {
+		t.Errorf("Expected a closed backend to fail a TCP check")
+	}
+}
+
+// newGrpcTestServer starts a cleartext HTTP/2 server, which is what gRPC speaks to http:// backends.
+func newGrpcTestServer(handler http.HandlerFunc) *httptest.Server {
+	testServer := httptest.NewUnstartedServer(handler)
+	testServer.Config.Protocols = new(http.Protocols)
+	testServer.Config.Protocols.SetUnencryptedHTTP2(true)
+	testServer.Start()
+
+	return testServer
+}
+
+func grpcFrame(message ...byte) []byte {
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+
+	return append(frame, message...)
+}
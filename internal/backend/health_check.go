@@ -0,0 +1,315 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxHealthCheckBody caps how much of a health check response is read when matching its body.
+const maxHealthCheckBody = 64 << 10
+
+const (
+	HealthCheckHttp = "http"
+	HealthCheckTcp  = "tcp"
+	HealthCheckGrpc = "grpc"
+)
+
+var ErrInvalidStatusRange = errors.New("invalid status code or range")
+
+// HealthCheck describes how a backend is probed. Type picks the protocol: HealthCheckHttp (the default),
+// HealthCheckTcp, which only opens a connection, or HealthCheckGrpc, which calls grpc.health.v1.Health/Check for
+// GrpcService ("" asks about the server as a whole). Timeout applies to all three; for TCP and gRPC checks it
+// defaults to the http client's timeout.
+//
+// An HTTP check sends Method (GET by default) to Uri with Headers, where a
+// Host header overrides the request's host. It passes when the status is in ExpectedStatuses (any 2xx by default) and
+// the body contains BodyContains and matches BodyRegex, when those are set. A non-zero Timeout replaces the http
+// client's timeout for the check.
+//
+// New backends are considered healthy until their first check unless StartUnhealthy is set, in which case they take
+// no traffic until they pass HealthyThreshold checks. The first check runs as soon as health checking starts, delayed
+// by a random amount up to Jitter so that every backend isn't probed at the same instant.
+//
+// A healthy backend needs UnhealthyThreshold failed checks in a row before it is taken out of rotation, and an
+// unhealthy one needs HealthyThreshold passing checks in a row before it is put back, so a single network blip
+// doesn't flap it in and out. Both default to 1.
+type HealthCheck struct {
+	Type               string
+	GrpcService        string
+	Uri                string
+	Method             string
+	Headers            map[string]string
+	ExpectedStatuses   []StatusRange
+	Timeout            time.Duration
+	BodyContains       string
+	BodyRegex          *regexp.Regexp
+	HealthyThreshold   int
+	UnhealthyThreshold int
+	StartUnhealthy     bool
+	Jitter             time.Duration
+}
+
+// StatusRange is an inclusive range of HTTP status codes. A single code has Min equal to Max.
+type StatusRange struct {
+	Min int
+	Max int
+}
+
+// ParseStatusRange parses a single status code such as "204" or an inclusive range such as "200-299".
+func ParseStatusRange(raw string) (StatusRange, error) {
+	low, high, isRange := strings.Cut(strings.TrimSpace(raw), "-")
+
+	if !isRange {
+		high = low
+	}
+
+	minStatus, minErr := strconv.Atoi(strings.TrimSpace(low))
+	maxStatus, maxErr := strconv.Atoi(strings.TrimSpace(high))
+
+	if minErr != nil || maxErr != nil || minStatus < 100 || maxStatus > 599 || minStatus > maxStatus {
+		return StatusRange{}, ErrInvalidStatusRange
+	}
+
+	return StatusRange{minStatus, maxStatus}, nil
+}
+
+func (sr StatusRange) contains(status int) bool {
+	return sr.Min <= status && status <= sr.Max
+}
+
+// HealthCheckObserver is told the result and duration of every health check, for metrics.
+type HealthCheckObserver func(passed bool, duration time.Duration)
+
+// healthCheckStreak counts consecutive check results. It is only touched while holding the backend's mutex.
+type healthCheckStreak struct {
+	successes int
+	failures  int
+}
+
+func (hc HealthCheck) withDefaults() HealthCheck {
+	if hc.Type == "" {
+		hc.Type = HealthCheckHttp
+	}
+
+	if hc.Method == "" {
+		hc.Method = http.MethodGet
+	}
+
+	if len(hc.ExpectedStatuses) == 0 {
+		hc.ExpectedStatuses = []StatusRange{{http.StatusOK, 299}}
+	}
+
+	if hc.HealthyThreshold <= 0 {
+		hc.HealthyThreshold = 1
+	}
+
+	if hc.UnhealthyThreshold <= 0 {
+		hc.UnhealthyThreshold = 1
+	}
+
+	return hc
+}
+
+// StartHealthCheck probes the backend right away, after the configured jitter, and then every cooldown until ctx is
+// done.
+func (be *Backend) StartHealthCheck(ctx context.Context, cooldown time.Duration) {
+	initialDelay := time.NewTimer(be.initialHealthCheckDelay())
+
+	select {
+	case <-initialDelay.C:
+		be.CheckHealth()
+	case <-ctx.Done():
+		initialDelay.Stop()
+		return
+	}
+
+	ticker := time.NewTicker(cooldown)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			be.CheckHealth()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (be *Backend) initialHealthCheckDelay() time.Duration {
+	if be.healthCheck.Jitter <= 0 {
+		return 0
+	}
+
+	return rand.N(be.healthCheck.Jitter)
+}
+
+func (be *Backend) CheckHealth() {
+	if !be.mutex.TryLock() {
+		return
+	}
+	defer be.mutex.Unlock()
+
+	start := time.Now()
+	passed := be.probe()
+
+	if be.observer != nil {
+		be.observer(passed, time.Since(start))
+	}
+
+	be.recordHealthCheck(passed)
+}
+
+// SetHealthCheckObserver registers observer to be told about every health check. It must be called before health
+// checks start.
+func (be *Backend) SetHealthCheckObserver(observer HealthCheckObserver) {
+	be.observer = observer
+}
+
+func (be *Backend) probe() bool {
+	switch be.healthCheck.Type {
+	case HealthCheckTcp:
+		return be.probeTcp()
+	case HealthCheckGrpc:
+		return be.probeGrpc()
+	default:
+		return be.probeHttp()
+	}
+}
+
+// probeTcp passes if a connection to the backend's host and port can be opened.
+func (be *Backend) probeTcp() bool {
+	ctx, cancel := be.healthCheckContext()
+	defer cancel()
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", hostPort(be.Url))
+
+	if err != nil {
+		return false
+	}
+
+	_ = conn.Close()
+
+	return true
+}
+
+func (be *Backend) probeHttp() bool {
+	hc := be.healthCheck
+	req, err := http.NewRequest(hc.Method, be.Url.JoinPath(hc.Uri).String(), nil)
+
+	if err != nil {
+		return false
+	}
+
+	for name, value := range hc.Headers {
+		if strings.EqualFold(name, "Host") {
+			req.Host = value
+		} else {
+			req.Header.Set(name, value)
+		}
+	}
+
+	client := be.httpClient
+
+	if hc.Timeout > 0 {
+		withTimeout := *be.httpClient
+		withTimeout.Timeout = hc.Timeout
+		client = &withTimeout
+	}
+
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return false
+	}
+
+	defer resp.Body.Close()
+
+	return hc.statusExpected(resp.StatusCode) && hc.bodyMatches(resp.Body)
+}
+
+// healthCheckContext bounds a TCP or gRPC check by the health check timeout, or failing that the http client's.
+func (be *Backend) healthCheckContext() (context.Context, context.CancelFunc) {
+	timeout := be.healthCheck.Timeout
+
+	if timeout <= 0 {
+		timeout = be.httpClient.Timeout
+	}
+
+	if timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// hostPort returns the backend's host with its port, filling in the scheme's default port when the URL has none.
+func hostPort(backendUrl *url.URL) string {
+	if backendUrl.Port() != "" {
+		return backendUrl.Host
+	}
+
+	if backendUrl.Scheme == "https" {
+		return net.JoinHostPort(backendUrl.Hostname(), "443")
+	}
+
+	return net.JoinHostPort(backendUrl.Hostname(), "80")
+}
+
+func (hc HealthCheck) statusExpected(status int) bool {
+	for _, expected := range hc.ExpectedStatuses {
+		if expected.contains(status) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (hc HealthCheck) bodyMatches(body io.Reader) bool {
+	if hc.BodyContains == "" && hc.BodyRegex == nil {
+		return true
+	}
+
+	content, err := io.ReadAll(io.LimitReader(body, maxHealthCheckBody))
+
+	if err != nil {
+		return false
+	}
+
+	if hc.BodyContains != "" && !strings.Contains(string(content), hc.BodyContains) {
+		return false
+	}
+
+	return hc.BodyRegex == nil || hc.BodyRegex.Match(content)
+}
+
+// recordHealthCheck flips the backend's health once the current streak of results reaches its threshold.
+func (be *Backend) recordHealthCheck(passed bool) {
+	if passed {
+		be.healthCheckStreak.failures = 0
+		be.healthCheckStreak.successes++
+
+		if be.healthCheckStreak.successes >= be.healthCheck.HealthyThreshold {
+			be.SetHealth(true)
+		}
+
+		return
+	}
+
+	be.healthCheckStreak.successes = 0
+	be.healthCheckStreak.failures++
+
+	if be.healthCheckStreak.failures >= be.healthCheck.UnhealthyThreshold {
+		be.SetHealth(false)
+	}
+}
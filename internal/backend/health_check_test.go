@@ -0,0 +1,249 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackend_CheckHealth_Thresholds(t *testing.T) {
+	scenarios := []struct {
+		name               string
+		healthyThreshold   int
+		unhealthyThreshold int
+		startHealthy       bool
+		results            []bool
+		expectedHealth     []bool
+	}{
+		{"Defaults Flip On Every Check", 0, 0, true, []bool{false, true, false}, []bool{false, true, false}},
+		{"Falls After Three Failures", 1, 3, true, []bool{false, false, false}, []bool{true, true, false}},
+		{"Success Resets Failure Streak", 1, 3, true, []bool{false, false, true, false, false}, []bool{true, true, true, true, true}},
+		{"Rises After Two Successes", 2, 1, false, []bool{true, true}, []bool{false, true}},
+		{"Failure Resets Success Streak", 2, 1, false, []bool{true, false, true, true}, []bool{false, false, false, true}},
+		{"Healthy Stays Healthy", 2, 2, true, []bool{true, true, true}, []bool{true, true, true}},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			passing := atomic.Bool{}
+
+			testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if passing.Load() {
+					w.WriteHeader(http.StatusOK)
+				} else {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			defer testServer.Close()
+
+			healthCheck := HealthCheck{Uri: "/health", HealthyThreshold: scenario.healthyThreshold, UnhealthyThreshold: scenario.unhealthyThreshold}
+			be, _ := NewWithHealthCheck(testServer.URL, healthCheck, testServer.Client())
+			be.SetHealth(scenario.startHealthy)
+
+			for i, result := range scenario.results {
+				passing.Store(result)
+				be.CheckHealth()
+
+				if be.IsHealthy() != scenario.expectedHealth[i] {
+					t.Fatalf("(check %v) IsHealthy() = %v, expected %v", i+1, be.IsHealthy(), scenario.expectedHealth[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseStatusRange(t *testing.T) {
+	scenarios := []struct {
+		raw           string
+		expected      StatusRange
+		expectedError error
+	}{
+		{"200", StatusRange{200, 200}, nil},
+		{"200-299", StatusRange{200, 299}, nil},
+		{" 204 - 206 ", StatusRange{204, 206}, nil},
+		{"299-200", StatusRange{}, ErrInvalidStatusRange},
+		{"2xx", StatusRange{}, ErrInvalidStatusRange},
+		{"42", StatusRange{}, ErrInvalidStatusRange},
+		{"200-600", StatusRange{}, ErrInvalidStatusRange},
+		{"", StatusRange{}, ErrInvalidStatusRange},
+	}
+
+	for _, scenario := range scenarios {
+		actual, err := ParseStatusRange(scenario.raw)
+
+		if !errors.Is(err, scenario.expectedError) {
+			t.Errorf("ParseStatusRange(%q) error = %v, expected %v", scenario.raw, err, scenario.expectedError)
+		}
+
+		if actual != scenario.expected {
+			t.Errorf("ParseStatusRange(%q) = %+v, expected %+v", scenario.raw, actual, scenario.expected)
+		}
+	}
+}
+
+func TestBackend_CheckHealth_Definition(t *testing.T) {
+	scenarios := []struct {
+		name           string
+		healthCheck    HealthCheck
+		status         int
+		body           string
+		delay          time.Duration
+		expectedHealth bool
+	}{
+		{"Default Accepts 2xx", HealthCheck{}, http.StatusNoContent, "", 0, true},
+		{"Expected Status List", HealthCheck{ExpectedStatuses: []StatusRange{{200, 200}, {503, 503}}}, http.StatusServiceUnavailable, "", 0, true},
+		{"Unexpected Status", HealthCheck{ExpectedStatuses: []StatusRange{{200, 200}}}, http.StatusNoContent, "", 0, false},
+		{"Body Contains", HealthCheck{BodyContains: `"status":"ok"`}, http.StatusOK, `{"status":"ok"}`, 0, true},
+		{"Degraded Body", HealthCheck{BodyContains: `"status":"ok"`}, http.StatusOK, `{"status":"degraded"}`, 0, false},
+		{"Body Regex", HealthCheck{BodyRegex: regexp.MustCompile(`"status":\s*"(ok|up)"`)}, http.StatusOK, `{"status": "up"}`, 0, true},
+		{"Body Regex Mismatch", HealthCheck{BodyRegex: regexp.MustCompile(`"status":\s*"(ok|up)"`)}, http.StatusOK, `{"status": "down"}`, 0, false},
+		{"Body Matches But Status Does Not", HealthCheck{BodyContains: "ok"}, http.StatusInternalServerError, "ok", 0, false},
+		{"Health Check Timeout", HealthCheck{Timeout: 10 * time.Millisecond}, http.StatusOK, "", 100 * time.Millisecond, false},
+		{"Within Health Check Timeout", HealthCheck{Timeout: time.Second}, http.StatusOK, "", 10 * time.Millisecond, true},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(scenario.delay)
+				w.WriteHeader(scenario.status)
+				_, _ = w.Write([]byte(scenario.body))
+			}))
+			defer testServer.Close()
+
+			scenario.healthCheck.Uri = "/health"
+			be, _ := NewWithHealthCheck(testServer.URL, scenario.healthCheck, testServer.Client())
+			be.SetHealth(!scenario.expectedHealth)
+
+			be.CheckHealth()
+
+			if be.IsHealthy() != scenario.expectedHealth {
+				t.Errorf("IsHealthy() = %v, expected %v", be.IsHealthy(), scenario.expectedHealth)
+			}
+		})
+	}
+}
+
+func TestBackend_CheckHealth_Request(t *testing.T) {
+	var method, host, token, path string
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, host, token, path = r.Method, r.Host, r.Header.Get("Authorization"), r.URL.Path
+	}))
+	defer testServer.Close()
+
+	healthCheck := HealthCheck{
+		Uri:     "/internal/health",
+		Method:  http.MethodHead,
+		Headers: map[string]string{"Host": "api.example.com", "Authorization": "Bearer token"},
+	}
+	be, _ := NewWithHealthCheck(testServer.URL, healthCheck, testServer.Client())
+
+	be.CheckHealth()
+
+	if method != http.MethodHead || host != "api.example.com" || token != "Bearer token" || path != "/internal/health" {
+		t.Errorf("Health check sent %v %v to host %v with Authorization %q", method, path, host, token)
+	}
+}
+
+func TestBackend_CheckHealth_Observer(t *testing.T) {
+	status := http.StatusOK
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		w.WriteHeader(status)
+	}))
+	defer testServer.Close()
+
+	be, _ := NewFromString(testServer.URL, "/health", testServer.Client())
+
+	var results []bool
+	var durations []time.Duration
+
+	be.SetHealthCheckObserver(func(passed bool, duration time.Duration) {
+		results = append(results, passed)
+		durations = append(durations, duration)
+	})
+
+	be.CheckHealth()
+	status = http.StatusServiceUnavailable
+	be.CheckHealth()
+
+	if len(results) != 2 || !results[0] || results[1] {
+		t.Fatalf("Observer saw results %v, expected [true false]", results)
+	}
+
+	for _, duration := range durations {
+		if duration < 5*time.Millisecond {
+			t.Errorf("Observer saw duration %v, expected at least 5ms", duration)
+		}
+	}
+}
+
+func TestBackend_StartUnhealthy(t *testing.T) {
+	scenarios := []struct {
+		startUnhealthy bool
+		expected       bool
+	}{
+		{false, true},
+		{true, false},
+	}
+
+	for _, scenario := range scenarios {
+		be, _ := NewWithHealthCheck("http://www.test.com", HealthCheck{Uri: "/health", StartUnhealthy: scenario.startUnhealthy}, nil)
+
+		if be.IsHealthy() != scenario.expected {
+			t.Errorf("StartUnhealthy = %v, expected IsHealthy() = %v", scenario.startUnhealthy, scenario.expected)
+		}
+	}
+}
+
+func TestBackend_StartHealthCheck_ProbesImmediately(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+
+	be, _ := NewWithHealthCheck(testServer.URL, HealthCheck{Uri: "/health", StartUnhealthy: true}, testServer.Client())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go be.StartHealthCheck(ctx, time.Hour)
+
+	deadline := time.Now().Add(time.Second)
+
+	for !be.IsHealthy() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if !be.IsHealthy() {
+		t.Errorf("Expected the first health check to run without waiting for the cooldown")
+	}
+}
+
+func TestBackend_InitialHealthCheckDelay(t *testing.T) {
+	scenarios := []struct {
+		jitter time.Duration
+	}{
+		{0},
+		{time.Millisecond},
+		{5 * time.Second},
+	}
+
+	for _, scenario := range scenarios {
+		be, _ := NewWithHealthCheck("http://www.test.com", HealthCheck{Uri: "/health", Jitter: scenario.jitter}, nil)
+
+		for range 100 {
+			delay := be.initialHealthCheckDelay()
+
+			if delay < 0 || (scenario.jitter == 0 && delay != 0) || (scenario.jitter > 0 && delay >= scenario.jitter) {
+				t.Fatalf("Jitter %v gave an initial delay of %v", scenario.jitter, delay)
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package backend
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyDecay is how quickly old samples stop mattering: a sample observed latencyDecay ago carries about a third
+// of the weight of one observed now.
+const latencyDecay = 10 * time.Second
+
+// latencyFloor is the share of the last sample the average never decays below while a backend gets no traffic.
+const latencyFloor = 0.5
+
+// latencyTracker keeps a peak exponentially weighted moving average of response latency. A sample slower than the
+// average replaces it outright so a backend that starts struggling is noticed on the next response, while faster
+// samples only pull it down gradually as time passes. The average also decays when it is read, so a backend that
+// stopped getting traffic after one slow response becomes worth trying again once the others are busy, but never below
+// latencyFloor of its last sample, so a backend that is slow throughout can't look faster than a healthy one just by
+// sitting idle.
+type latencyTracker struct {
+	mutex        sync.Mutex
+	ewma         atomic.Int64
+	lastSample   atomic.Int64
+	lastObserved atomic.Int64
+}
+
+func (lt *latencyTracker) observe(latency time.Duration, now time.Time) {
+	lt.mutex.Lock()
+	defer lt.mutex.Unlock()
+
+	current := time.Duration(lt.ewma.Load())
+	lastObserved := lt.lastObserved.Load()
+	lt.lastSample.Store(int64(latency))
+
+	if lastObserved == 0 || latency > current {
+		lt.ewma.Store(int64(latency))
+		lt.lastObserved.Store(now.UnixNano())
+
+		return
+	}
+
+	weight := decayWeight(now.UnixNano() - lastObserved)
+	lt.ewma.Store(int64(float64(current)*weight + float64(latency)*(1-weight)))
+	lt.lastObserved.Store(now.UnixNano())
+}
+
+func (lt *latencyTracker) load(now time.Time) time.Duration {
+	lastObserved := lt.lastObserved.Load()
+
+	if lastObserved == 0 {
+		return 0
+	}
+
+	decayed := float64(lt.ewma.Load()) * decayWeight(now.UnixNano()-lastObserved)
+
+	return time.Duration(max(decayed, float64(lt.lastSample.Load())*latencyFloor))
+}
+
+// decayWeight is how much of the average is left after elapsed nanoseconds without a sample.
+func decayWeight(elapsed int64) float64 {
+	return math.Exp(-float64(max(elapsed, 0)) / float64(latencyDecay))
+}
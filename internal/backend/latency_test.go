@@ -0,0 +1,122 @@
+package backend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyTracker_Observe(t *testing.T) {
+	start := time.Now()
+
+	scenarios := []struct {
+		name    string
+		samples []time.Duration
+		offsets []time.Duration
+		minimum time.Duration
+		maximum time.Duration
+	}{
+		{"No Samples", nil, nil, 0, 0},
+		{"First Sample Is Taken As Is", []time.Duration{40 * time.Millisecond}, []time.Duration{0}, 40 * time.Millisecond, 40 * time.Millisecond},
+		{
+			"Slower Sample Replaces Average",
+			[]time.Duration{10 * time.Millisecond, 500 * time.Millisecond},
+			[]time.Duration{0, time.Millisecond},
+			500 * time.Millisecond,
+			500 * time.Millisecond,
+		},
+		{
+			"Faster Sample Right Away Barely Moves Average",
+			[]time.Duration{500 * time.Millisecond, 10 * time.Millisecond},
+			[]time.Duration{0, time.Millisecond},
+			490 * time.Millisecond,
+			500 * time.Millisecond,
+		},
+		{
+			"Faster Sample After One Decay Period",
+			[]time.Duration{500 * time.Millisecond, 10 * time.Millisecond},
+			[]time.Duration{0, latencyDecay},
+			185 * time.Millisecond,
+			195 * time.Millisecond,
+		},
+		{
+			"Faster Sample Long After Replaces Average",
+			[]time.Duration{500 * time.Millisecond, 10 * time.Millisecond},
+			[]time.Duration{0, 20 * latencyDecay},
+			10 * time.Millisecond,
+			11 * time.Millisecond,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			tracker := &latencyTracker{}
+
+			for i, sample := range scenario.samples {
+				tracker.observe(sample, start.Add(scenario.offsets[i]))
+			}
+
+			var readAt time.Time
+
+			if len(scenario.offsets) > 0 {
+				readAt = start.Add(scenario.offsets[len(scenario.offsets)-1])
+			}
+
+			if actual := tracker.load(readAt); actual < scenario.minimum || actual > scenario.maximum {
+				t.Errorf("Expected latency between %v and %v, got %v", scenario.minimum, scenario.maximum, actual)
+			}
+		})
+	}
+}
+
+func TestLatencyTracker_Load_DecaysOldSpike(t *testing.T) {
+	now := time.Now()
+
+	spiked := &latencyTracker{}
+	spiked.observe(2*time.Second, now.Add(-6*latencyDecay))
+	spiked.observe(20*time.Millisecond, now.Add(-6*latencyDecay))
+
+	if actual := spiked.load(now.Add(-6 * latencyDecay)); actual != 2*time.Second {
+		t.Errorf("Expected the spike to be reported in full right after it was observed, got %v", actual)
+	}
+
+	if actual := spiked.load(now.Add(-5 * latencyDecay)); actual < 730*time.Millisecond || actual > 740*time.Millisecond {
+		t.Errorf("Expected the spike to decay to about a third after one decay period, got %v", actual)
+	}
+
+	if actual := spiked.load(now); actual != 10*time.Millisecond {
+		t.Errorf("Expected the spike to decay down to half of the last sample, got %v", actual)
+	}
+}
+
+func TestLatencyTracker_Load_IdleSlowBackendStaysSlow(t *testing.T) {
+	now := time.Now()
+
+	idleSlow := &latencyTracker{}
+	idleSlow.observe(200*time.Millisecond, now.Add(-5*latencyDecay))
+	idleSlow.observe(200*time.Millisecond, now.Add(-4*latencyDecay))
+
+	busyFast := &latencyTracker{}
+
+	for elapsed := 4 * latencyDecay; elapsed >= 0; elapsed -= time.Second {
+		busyFast.observe(20*time.Millisecond, now.Add(-elapsed))
+	}
+
+	if actual := idleSlow.load(now); actual >= 200*time.Millisecond {
+		t.Errorf("Expected an idle backend's latency to fade so it gets probed again, got %v", actual)
+	}
+
+	if idleSlow.load(now) <= busyFast.load(now) {
+		t.Errorf("Expected a slow backend left idle (%v) to still look slower than a fast busy one (%v)", idleSlow.load(now), busyFast.load(now))
+	}
+}
+
+func BenchmarkBackend_Latency(b *testing.B) {
+	be, _ := NewFromString("http://www.test.com", "/health", nil)
+	be.ObserveLatency(20 * time.Millisecond)
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		be.Latency()
+	}
+}
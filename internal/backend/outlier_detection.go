@@ -0,0 +1,94 @@
+package backend
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultConsecutiveFailures = 5
+	DefaultBaseEjectionTime    = 30 * time.Second
+	DefaultMaxEjectionTime     = 5 * time.Minute
+)
+
+// OutlierDetection configures passive health checking: after ConsecutiveFailures failed proxied requests in a row,
+// the backend is ejected from rotation. The first ejection lasts BaseEjectionTime, and every further one lasts
+// BaseEjectionTime longer, up to MaxEjectionTime.
+type OutlierDetection struct {
+	ConsecutiveFailures int
+	BaseEjectionTime    time.Duration
+	MaxEjectionTime     time.Duration
+}
+
+type outlierDetector struct {
+	settings            OutlierDetection
+	consecutiveFailures atomic.Int32
+	ejectedUntil        atomic.Int64
+	mutex               sync.Mutex
+	ejections           int
+	lastEjectionEnd     time.Time
+}
+
+func newOutlierDetector(settings OutlierDetection) *outlierDetector {
+	if settings.ConsecutiveFailures <= 0 {
+		settings.ConsecutiveFailures = DefaultConsecutiveFailures
+	}
+
+	if settings.BaseEjectionTime <= 0 {
+		settings.BaseEjectionTime = DefaultBaseEjectionTime
+	}
+
+	if settings.MaxEjectionTime <= 0 {
+		settings.MaxEjectionTime = DefaultMaxEjectionTime
+	}
+
+	settings.MaxEjectionTime = max(settings.MaxEjectionTime, settings.BaseEjectionTime)
+
+	return &outlierDetector{settings: settings}
+}
+
+func (od *outlierDetector) recordSuccess() {
+	od.consecutiveFailures.Store(0)
+}
+
+func (od *outlierDetector) recordFailure(now time.Time) {
+	if od.consecutiveFailures.Add(1) < int32(od.settings.ConsecutiveFailures) {
+		return
+	}
+
+	od.mutex.Lock()
+	defer od.mutex.Unlock()
+
+	if od.isEjected(now) {
+		return
+	}
+
+	// A backend that stayed in rotation for a full MaxEjectionTime since its last ejection starts over at
+	// BaseEjectionTime, so one bad day doesn't keep it out for MaxEjectionTime forever after.
+	if !od.lastEjectionEnd.IsZero() && now.Sub(od.lastEjectionEnd) > od.settings.MaxEjectionTime {
+		od.ejections = 0
+	}
+
+	od.ejections++
+	ejectionTime := min(od.settings.BaseEjectionTime*time.Duration(od.ejections), od.settings.MaxEjectionTime)
+	od.lastEjectionEnd = now.Add(ejectionTime)
+	od.ejectedUntil.Store(od.lastEjectionEnd.UnixNano())
+	od.consecutiveFailures.Store(0)
+}
+
+func (od *outlierDetector) isEjected(now time.Time) bool {
+	ejectedUntil := od.ejectedUntil.Load()
+
+	if ejectedUntil == 0 {
+		return false
+	}
+
+	if now.UnixNano() < ejectedUntil {
+		return true
+	}
+
+	od.ejectedUntil.CompareAndSwap(ejectedUntil, 0)
+
+	return false
+}
@@ -0,0 +1,140 @@
+package backend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOutlierDetector_RecordFailure(t *testing.T) {
+	scenarios := []struct {
+		name            string
+		results         []bool
+		expectedEjected bool
+	}{
+		{"No Results", []bool{}, false},
+		{"Below Threshold", []bool{false, false}, false},
+		{"Reaches Threshold", []bool{false, false, false}, true},
+		{"Success Resets Streak", []bool{false, false, true, false, false}, false},
+		{"Streak After Success", []bool{false, true, false, false, false}, true},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			now := time.Now()
+			od := newOutlierDetector(OutlierDetection{ConsecutiveFailures: 3, BaseEjectionTime: time.Minute})
+
+			for _, succeeded := range scenario.results {
+				if succeeded {
+					od.recordSuccess()
+				} else {
+					od.recordFailure(now)
+				}
+			}
+
+			if actual := od.isEjected(now); actual != scenario.expectedEjected {
+				t.Errorf("isEjected() = %v, expected %v", actual, scenario.expectedEjected)
+			}
+		})
+	}
+}
+
+func TestOutlierDetector_EjectionTimeGrows(t *testing.T) {
+	od := newOutlierDetector(OutlierDetection{ConsecutiveFailures: 1, BaseEjectionTime: 10 * time.Second, MaxEjectionTime: 25 * time.Second})
+	now := time.Now()
+
+	for _, expectedEjectionTime := range []time.Duration{10 * time.Second, 20 * time.Second, 25 * time.Second, 25 * time.Second} {
+		od.recordFailure(now)
+
+		if !od.isEjected(now.Add(expectedEjectionTime - time.Millisecond)) {
+			t.Fatalf("Expected to still be ejected just before %v", expectedEjectionTime)
+		}
+
+		if od.isEjected(now.Add(expectedEjectionTime)) {
+			t.Fatalf("Expected to be back in rotation after %v", expectedEjectionTime)
+		}
+
+		now = now.Add(expectedEjectionTime)
+	}
+}
+
+func TestOutlierDetector_EjectionTimeResetsAfterQuietPeriod(t *testing.T) {
+	od := newOutlierDetector(OutlierDetection{ConsecutiveFailures: 1, BaseEjectionTime: 10 * time.Second, MaxEjectionTime: time.Minute})
+	now := time.Now()
+
+	od.recordFailure(now)
+	od.recordFailure(now.Add(10 * time.Second))
+
+	now = now.Add(30*time.Second + 2*time.Minute)
+	od.recordFailure(now)
+
+	if od.isEjected(now.Add(10 * time.Second)) {
+		t.Errorf("Expected the ejection time to start over at the base ejection time")
+	}
+}
+
+func TestOutlierDetector_FailuresWhileEjectedDoNotExtendEjection(t *testing.T) {
+	od := newOutlierDetector(OutlierDetection{ConsecutiveFailures: 1, BaseEjectionTime: 10 * time.Second})
+	now := time.Now()
+
+	od.recordFailure(now)
+	od.recordFailure(now.Add(5 * time.Second))
+
+	if od.isEjected(now.Add(10 * time.Second)) {
+		t.Errorf("Expected failures during an ejection not to extend it")
+	}
+}
+
+func TestBackend_IsHealthy_OutlierDetection(t *testing.T) {
+	scenarios := []struct {
+		name            string
+		outlierDetector bool
+		healthy         bool
+		failures        int
+		expected        bool
+	}{
+		{"Outlier Detection Off", false, true, 10, true},
+		{"Below Threshold", true, true, 1, true},
+		{"Ejected", true, true, 2, false},
+		{"Failed Health Check", true, false, 0, false},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			be, _ := NewFromString("http://www.test.com", "/health", nil)
+			be.SetHealth(scenario.healthy)
+
+			if scenario.outlierDetector {
+				be.SetOutlierDetection(OutlierDetection{ConsecutiveFailures: 2})
+			}
+
+			for range scenario.failures {
+				attempt, _ := be.TryAcquire()
+				attempt.RecordFailure()
+			}
+
+			if actual := be.IsHealthy(); actual != scenario.expected {
+				t.Errorf("IsHealthy() = %v, expected %v", actual, scenario.expected)
+			}
+		})
+	}
+}
+
+func TestNewOutlierDetector_Defaults(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		settings OutlierDetection
+		expected OutlierDetection
+	}{
+		{"All Defaults", OutlierDetection{}, OutlierDetection{DefaultConsecutiveFailures, DefaultBaseEjectionTime, DefaultMaxEjectionTime}},
+		{"Max Below Base", OutlierDetection{3, time.Minute, time.Second}, OutlierDetection{3, time.Minute, time.Minute}},
+		{"Explicit", OutlierDetection{2, time.Second, time.Minute}, OutlierDetection{2, time.Second, time.Minute}},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			if actual := newOutlierDetector(scenario.settings).settings; actual != scenario.expected {
+				t.Errorf("newOutlierDetector(%+v) settings = %+v, expected %+v", scenario.settings, actual, scenario.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"load-balancer/internal/backend"
+	"slices"
+	"time"
+)
+
+// drainPollInterval is how often a draining backend is checked for in-flight requests.
+const drainPollInterval = 100 * time.Millisecond
+
+// drain is a backend being drained: when it must be gone by, and how to stop waiting for it once it has been removed
+// or handed to another load balancer.
+type drain struct {
+	deadline time.Time
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+var ErrDuplicateBackend = errors.New("backend already registered")
+var ErrBackendNotFound = errors.New("backend not found")
+
+// RemovalObserver is told about every backend that leaves the load balancer, whether removed outright or once it has
+// drained, so anything kept per backend elsewhere can be let go.
+type RemovalObserver func(be *backend.Backend)
+
+// SetRemovalObserver registers observer to be told about removed backends. The observer is called with the mutex held,
+// so it must not call back into the load balancer. It must be called before the load balancer starts taking traffic.
+func (lb *LoadBalancer) SetRemovalObserver(observer RemovalObserver) {
+	lb.removalObserver = observer
+}
+
+// AddBackend puts be into rotation, health checking it if health checks have been started.
+func (lb *LoadBalancer) AddBackend(be *backend.Backend) error {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	if findBackend(lb.GetBackends(), be.Url.String()) != nil || findBackend(lb.GetDrainingBackends(), be.Url.String()) != nil {
+		return ErrDuplicateBackend
+	}
+
+	backends := append(slices.Clone(lb.GetBackends()), be)
+	lb.backends.Store(&backends)
+	lb.startHealthCheck(be)
+
+	return nil
+}
+
+// RemoveBackend takes the backend with the given URL out of the load balancer straight away, whether or not it is
+// draining. Requests already sent to it are left to finish.
+func (lb *LoadBalancer) RemoveBackend(rawUrl string) error {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	be := findBackend(lb.GetBackends(), rawUrl)
+
+	if be == nil {
+		be = findBackend(lb.GetDrainingBackends(), rawUrl)
+	}
+
+	if be == nil {
+		return ErrBackendNotFound
+	}
+
+	lb.remove(be)
+
+	return nil
+}
+
+// DrainBackend stops sending new requests to the backend with the given URL and removes it once its in-flight
+// requests have finished, or once timeout has passed, whichever comes first.
+func (lb *LoadBalancer) DrainBackend(rawUrl string, timeout time.Duration) error {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	be := findBackend(lb.GetBackends(), rawUrl)
+
+	if be == nil {
+		return ErrBackendNotFound
+	}
+
+	backends := slices.DeleteFunc(slices.Clone(lb.GetBackends()), func(other *backend.Backend) bool { return other == be })
+	draining := append(slices.Clone(lb.GetDrainingBackends()), be)
+	lb.backends.Store(&backends)
+	lb.draining.Store(&draining)
+
+	lb.startDrain(be, time.Now().Add(timeout))
+
+	return nil
+}
+
+// TakeOverDraining moves the backends previous is draining into lb, keeping their deadlines, for a load balancer that
+// replaces previous on a config reload. The drains running on previous are stopped, and lb removes the backends once
+// they finish instead.
+func (lb *LoadBalancer) TakeOverDraining(previous *LoadBalancer) {
+	previous.mutex.Lock()
+	handedOver, drains := previous.GetDrainingBackends(), previous.drains
+	previous.draining.Store(&[]*backend.Backend{})
+	previous.drains = map[*backend.Backend]drain{}
+	previous.mutex.Unlock()
+
+	for _, handed := range drains {
+		handed.cancel()
+	}
+
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	draining := slices.Clone(lb.GetDrainingBackends())
+
+	for _, be := range handedOver {
+		if findBackend(lb.GetBackends(), be.Url.String()) != nil || findBackend(draining, be.Url.String()) != nil {
+			continue
+		}
+
+		draining = append(draining, be)
+		lb.startDrain(be, drains[be].deadline)
+	}
+
+	lb.draining.Store(&draining)
+}
+
+// startDrain waits in the background for be to finish its in-flight requests or reach deadline, then removes it. The
+// caller must hold the mutex.
+func (lb *LoadBalancer) startDrain(be *backend.Backend, deadline time.Time) {
+	ctx, cancel := context.WithCancel(context.Background())
+	lb.drains[be] = drain{deadline: deadline, ctx: ctx, cancel: cancel}
+
+	go lb.awaitDrain(ctx, be, deadline)
+}
+
+func (lb *LoadBalancer) stopDrain(be *backend.Backend) {
+	if running, ok := lb.drains[be]; ok {
+		running.cancel()
+		delete(lb.drains, be)
+	}
+}
+
+func (lb *LoadBalancer) awaitDrain(ctx context.Context, be *backend.Backend, deadline time.Time) {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for be.ActiveConnections() > 0 && time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	// The backend may have been removed outright while it was draining.
+	if slices.Contains(lb.GetDrainingBackends(), be) {
+		lb.remove(be)
+	}
+}
+
+// remove drops be from both the active and draining backends, stops its drain and health check and tells the removal
+// observer. The caller must hold the mutex.
+func (lb *LoadBalancer) remove(be *backend.Backend) {
+	isBe := func(other *backend.Backend) bool { return other == be }
+
+	backends := slices.DeleteFunc(slices.Clone(lb.GetBackends()), isBe)
+	draining := slices.DeleteFunc(slices.Clone(lb.GetDrainingBackends()), isBe)
+	lb.backends.Store(&backends)
+	lb.draining.Store(&draining)
+	lb.stopDrain(be)
+	lb.stopHealthCheck(be)
+
+	if lb.removalObserver != nil {
+		lb.removalObserver(be)
+	}
+}
+
+func findBackend(backends []*backend.Backend, rawUrl string) *backend.Backend {
+	for _, be := range backends {
+		if be.Url.String() == rawUrl {
+			return be
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package balancer
+
+import (
+	"errors"
+	"load-balancer/internal/backend"
+	"testing"
+	"time"
+)
+
+func TestLoadBalancer_AddBackend(t *testing.T) {
+	backends := hashBackends([]bool{true, true})
+	lb := New(backends, NewRoundRobin(), time.Hour)
+	added, _ := backend.NewFromString("http://added.com", "/test", nil)
+
+	if err := lb.AddBackend(added); err != nil {
+		t.Fatalf("AddBackend() returned an unexpected error = %v", err)
+	}
+
+	if len(lb.GetBackends()) != 3 || lb.GetBackends()[2] != added {
+		t.Fatalf("Expected the added backend to be in rotation, got %v backends", len(lb.GetBackends()))
+	}
+
+	if len(backends) != 2 {
+		t.Errorf("AddBackend() modified the slice the load balancer was created with")
+	}
+
+	duplicate, _ := backend.NewFromString("http://added.com", "/test", nil)
+
+	if err := lb.AddBackend(duplicate); !errors.Is(err, ErrDuplicateBackend) {
+		t.Errorf("AddBackend() of a duplicate url error = %v, expected %v", err, ErrDuplicateBackend)
+	}
+}
+
+func TestLoadBalancer_RemoveBackend(t *testing.T) {
+	scenarios := []struct {
+		name          string
+		url           string
+		drainFirst    bool
+		expectedError error
+	}{
+		{"Active Backend", "http://test1.com", false, nil},
+		{"Draining Backend", "http://test1.com", true, nil},
+		{"Unknown Backend", "http://unknown.com", false, ErrBackendNotFound},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			lb := New(hashBackends([]bool{true, true, true}), NewRoundRobin(), time.Hour)
+			lb.GetBackends()[1].AddConnection()
+
+			var removed []string
+			lb.SetRemovalObserver(func(be *backend.Backend) { removed = append(removed, be.Url.String()) })
+
+			if scenario.drainFirst {
+				_ = lb.DrainBackend(scenario.url, time.Hour)
+			}
+
+			err := lb.RemoveBackend(scenario.url)
+
+			if !errors.Is(err, scenario.expectedError) {
+				t.Fatalf("RemoveBackend(%v) error = %v, expected %v", scenario.url, err, scenario.expectedError)
+			}
+
+			remaining := len(lb.GetBackends()) + len(lb.GetDrainingBackends())
+
+			if err == nil && remaining != 2 {
+				t.Errorf("Expected 2 backends left, got %v", remaining)
+			}
+
+			if err != nil && remaining != 3 {
+				t.Errorf("Expected all 3 backends left, got %v", remaining)
+			}
+
+			if err == nil && (len(removed) != 1 || removed[0] != scenario.url) {
+				t.Errorf("Expected the removal observer to be told about %v, got %v", scenario.url, removed)
+			}
+
+			if err != nil && len(removed) != 0 {
+				t.Errorf("Expected the removal observer not to be called, got %v", removed)
+			}
+
+			if len(lb.drains) != 0 {
+				t.Errorf("Expected no drain left waiting on a removed backend, got %v", len(lb.drains))
+			}
+		})
+	}
+}
+
+func TestLoadBalancer_DrainBackend(t *testing.T) {
+	lb := New(hashBackends([]bool{true, true}), NewRoundRobin(), time.Hour)
+	draining := lb.GetBackends()[0]
+	draining.AddConnection()
+
+	removed := make(chan *backend.Backend, 1)
+	lb.SetRemovalObserver(func(be *backend.Backend) { removed <- be })
+
+	if err := lb.DrainBackend("http://unknown.com", time.Hour); !errors.Is(err, ErrBackendNotFound) {
+		t.Errorf("DrainBackend() of an unknown url error = %v, expected %v", err, ErrBackendNotFound)
+	}
+
+	if err := lb.DrainBackend(draining.Url.String(), time.Hour); err != nil {
+		t.Fatalf("DrainBackend() returned an unexpected error = %v", err)
+	}
+
+	for range 10 {
+		if be, _ := lb.GetNextBackend(nil); be == draining {
+			t.Fatalf("Draining backend was picked for a new request")
+		}
+	}
+
+	if len(lb.GetDrainingBackends()) != 1 {
+		t.Fatalf("Expected the backend to be draining while it has a connection open")
+	}
+
+	time.Sleep(2 * drainPollInterval)
+
+	if len(lb.GetDrainingBackends()) != 1 {
+		t.Fatalf("Expected the backend to keep draining while it has a connection open")
+	}
+
+	draining.ReleaseConnection()
+	time.Sleep(2 * drainPollInterval)
+
+	if len(lb.GetDrainingBackends()) != 0 || len(lb.GetBackends()) != 1 {
+		t.Errorf("Expected the drained backend to be removed, got %v active and %v draining",
+			len(lb.GetBackends()), len(lb.GetDrainingBackends()))
+	}
+
+	select {
+	case be := <-removed:
+		if be != draining {
+			t.Errorf("Expected the removal observer to be told about the drained backend")
+		}
+	default:
+		t.Errorf("Expected the removal observer to be told once the backend drained")
+	}
+}
+
+func TestLoadBalancer_DrainBackend_Timeout(t *testing.T) {
+	lb := New(hashBackends([]bool{true, true}), NewRoundRobin(), time.Hour)
+	lb.GetBackends()[0].AddConnection()
+
+	_ = lb.DrainBackend(lb.GetBackends()[0].Url.String(), drainPollInterval)
+	time.Sleep(3 * drainPollInterval)
+
+	if len(lb.GetDrainingBackends()) != 0 {
+		t.Errorf("Expected the backend to be removed once the drain timed out")
+	}
+}
+
+func TestLoadBalancer_TakeOverDraining(t *testing.T) {
+	previous := New(hashBackends([]bool{true, true}), NewRoundRobin(), time.Hour)
+	draining := previous.GetBackends()[0]
+	draining.AddConnection()
+
+	if err := previous.DrainBackend(draining.Url.String(), time.Hour); err != nil {
+		t.Fatalf("DrainBackend() returned an unexpected error = %v", err)
+	}
+
+	previousDrain := previous.drains[draining].ctx
+
+	lb := New(previous.GetBackends(), NewRoundRobin(), time.Hour)
+	lb.TakeOverDraining(previous)
+
+	if len(previous.GetDrainingBackends()) != 0 {
+		t.Errorf("Expected the previous load balancer to hand over its draining backends")
+	}
+
+	if previousDrain.Err() == nil {
+		t.Errorf("Expected the previous load balancer to stop waiting for the handed over backend")
+	}
+
+	if len(lb.GetDrainingBackends()) != 1 || lb.GetDrainingBackends()[0] != draining {
+		t.Fatalf("Expected the new load balancer to be draining the backend, got %v", lb.GetDrainingBackends())
+	}
+
+	draining.ReleaseConnection()
+	time.Sleep(2 * drainPollInterval)
+
+	if len(lb.GetDrainingBackends()) != 0 || len(lb.GetBackends()) != 1 {
+		t.Errorf("Expected the new load balancer to remove the drained backend, got %v active and %v draining",
+			len(lb.GetBackends()), len(lb.GetDrainingBackends()))
+	}
+}
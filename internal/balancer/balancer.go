@@ -4,45 +4,152 @@ import (
 	"context"
 	"errors"
 	"load-balancer/internal/backend"
+	"net/http"
+	"slices"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
 const (
-	RoundRobinStrategy       = "round_robin"
-	LeastConnectionsStrategy = "least_connections"
+	RoundRobinStrategy         = "round_robin"
+	WeightedRoundRobinStrategy = "weighted_round_robin"
+	LeastConnectionsStrategy   = "least_connections"
+	ConsistentHashStrategy     = "consistent_hash"
+	PowerOfTwoChoicesStrategy  = "p2c"
+	LeastLatencyStrategy       = "least_latency"
 )
 
 var NoRegisteredBackends = errors.New("no registered backends")
 var NoHealthyBackends = errors.New("no healthy backends available")
 
+// Strategy picks the backend a request is routed to. The request is passed along for strategies that route on its
+// contents; strategies that don't can ignore it, and it may be nil.
 type Strategy interface {
-	NextBackend([]*backend.Backend) (*backend.Backend, error)
+	NextBackend([]*backend.Backend, *http.Request) (*backend.Backend, error)
 }
 
+// LoadBalancer routes requests for one app across its backends. The set of backends can change while traffic is
+// flowing: writers copy the slice and swap it in under the mutex, so readers always see a consistent snapshot
+// without taking a lock.
 type LoadBalancer struct {
-	backends            []*backend.Backend
+	backends            atomic.Pointer[[]*backend.Backend]
+	draining            atomic.Pointer[[]*backend.Backend]
 	strategy            Strategy
 	healthCheckCooldown time.Duration
+	affinity            *SessionAffinity
+	mutex               sync.Mutex
+	healthCheckCtx      context.Context
+	stopHealthChecks    context.CancelFunc
+	healthChecks        map[*backend.Backend]context.CancelFunc
+	drains              map[*backend.Backend]drain
+	removalObserver     RemovalObserver
 }
 
 func New(backends []*backend.Backend, strategy Strategy, healthCheckCooldown time.Duration) *LoadBalancer {
-	routeToIndex := &atomic.Uint64{}
-	routeToIndex.Store(0)
+	lb := &LoadBalancer{
+		strategy:            strategy,
+		healthCheckCooldown: healthCheckCooldown,
+		drains:              map[*backend.Backend]drain{},
+	}
+	lb.backends.Store(&backends)
+	lb.draining.Store(&[]*backend.Backend{})
+
+	return lb
+}
 
-	return &LoadBalancer{backends, strategy, healthCheckCooldown}
+// SetSessionAffinity turns on sticky sessions. It must be called before the load balancer starts taking traffic.
+func (lb *LoadBalancer) SetSessionAffinity(affinity *SessionAffinity) {
+	lb.affinity = affinity
 }
 
+// StartHealthChecks starts health checking every backend, including ones added later, until ctx is done or
+// StopHealthChecks is called.
 func (lb *LoadBalancer) StartHealthChecks(ctx context.Context) {
-	for _, be := range lb.backends {
-		go be.StartHealthCheck(ctx, lb.healthCheckCooldown)
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	lb.healthCheckCtx, lb.stopHealthChecks = context.WithCancel(ctx)
+	lb.healthChecks = map[*backend.Backend]context.CancelFunc{}
+
+	for _, be := range lb.GetBackends() {
+		lb.startHealthCheck(be)
+	}
+}
+
+// StopHealthChecks stops the health checks started by StartHealthChecks, for a load balancer that has been replaced
+// by a config reload.
+func (lb *LoadBalancer) StopHealthChecks() {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	if lb.stopHealthChecks != nil {
+		lb.stopHealthChecks()
+	}
+}
+
+func (lb *LoadBalancer) startHealthCheck(be *backend.Backend) {
+	if lb.healthCheckCtx == nil {
+		return
 	}
+
+	ctx, cancel := context.WithCancel(lb.healthCheckCtx)
+	lb.healthChecks[be] = cancel
+
+	go be.StartHealthCheck(ctx, lb.healthCheckCooldown)
 }
 
-func (lb *LoadBalancer) GetNextBackend() (*backend.Backend, error) {
-	return lb.strategy.NextBackend(lb.backends)
+func (lb *LoadBalancer) stopHealthCheck(be *backend.Backend) {
+	if cancel, ok := lb.healthChecks[be]; ok {
+		cancel()
+		delete(lb.healthChecks, be)
+	}
 }
 
+// GetNextBackend returns the backend the request's affinity cookie is pinned to when sticky sessions are on and that
+// backend is still healthy, and otherwise whichever backend the strategy picks.
+func (lb *LoadBalancer) GetNextBackend(r *http.Request) (*backend.Backend, error) {
+	return lb.nextBackend(lb.GetBackends(), r)
+}
+
+// GetNextBackendExcluding is GetNextBackend without the backends in exclude, for retrying a request on a backend it
+// hasn't already failed on.
+func (lb *LoadBalancer) GetNextBackendExcluding(r *http.Request, exclude []*backend.Backend) (*backend.Backend, error) {
+	if len(exclude) == 0 {
+		return lb.GetNextBackend(r)
+	}
+
+	backends := slices.DeleteFunc(slices.Clone(lb.GetBackends()), func(be *backend.Backend) bool {
+		return slices.Contains(exclude, be)
+	})
+
+	return lb.nextBackend(backends, r)
+}
+
+func (lb *LoadBalancer) nextBackend(backends []*backend.Backend, r *http.Request) (*backend.Backend, error) {
+	if lb.affinity != nil {
+		if be := lb.affinity.backendFor(r, backends); be != nil {
+			return be, nil
+		}
+	}
+
+	return lb.strategy.NextBackend(backends, r)
+}
+
+// Stick pins the client to be for its following requests by setting the affinity cookie on the response. It is a
+// no-op when sticky sessions are off, and must be called before the response is written.
+func (lb *LoadBalancer) Stick(w http.ResponseWriter, r *http.Request, be *backend.Backend) {
+	if lb.affinity != nil {
+		lb.affinity.stick(w, r, be)
+	}
+}
+
+// GetBackends returns the backends currently in rotation. The slice must not be modified.
 func (lb *LoadBalancer) GetBackends() []*backend.Backend {
-	return lb.backends
+	return *lb.backends.Load()
+}
+
+// GetDrainingBackends returns the backends that are finishing their in-flight requests before being removed.
+func (lb *LoadBalancer) GetDrainingBackends() []*backend.Backend {
+	return *lb.draining.Load()
 }
@@ -0,0 +1,145 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"load-balancer/internal/backend"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoadBalancer_StopHealthChecks(t *testing.T) {
+	checks := atomic.Int32{}
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checks.Add(1)
+	}))
+	defer testServer.Close()
+
+	be, _ := backend.NewFromString(testServer.URL, "/health", testServer.Client())
+	lb := New([]*backend.Backend{be}, NewRoundRobin(), 10*time.Millisecond)
+
+	lb.StartHealthChecks(context.Background())
+	time.Sleep(35 * time.Millisecond)
+	lb.StopHealthChecks()
+	time.Sleep(15 * time.Millisecond)
+
+	stoppedAt := checks.Load()
+	time.Sleep(50 * time.Millisecond)
+
+	if stoppedAt == 0 {
+		t.Fatalf("Expected health checks to run before being stopped")
+	}
+
+	if checks.Load() != stoppedAt {
+		t.Errorf("Expected no health checks after StopHealthChecks(), got %v more", checks.Load()-stoppedAt)
+	}
+}
+
+func TestLoadBalancer_AddAndRemoveBackend_HealthChecks(t *testing.T) {
+	checks := atomic.Int32{}
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checks.Add(1)
+	}))
+	defer testServer.Close()
+
+	lb := New(nil, NewRoundRobin(), 10*time.Millisecond)
+	lb.StartHealthChecks(context.Background())
+	defer lb.StopHealthChecks()
+
+	be, _ := backend.NewFromString(testServer.URL, "/health", testServer.Client())
+	_ = lb.AddBackend(be)
+	time.Sleep(35 * time.Millisecond)
+	_ = lb.RemoveBackend(be.Url.String())
+	time.Sleep(15 * time.Millisecond)
+
+	stoppedAt := checks.Load()
+	time.Sleep(50 * time.Millisecond)
+
+	if stoppedAt == 0 {
+		t.Fatalf("Expected the added backend to be health checked")
+	}
+
+	if checks.Load() != stoppedAt {
+		t.Errorf("Expected no health checks after RemoveBackend(), got %v more", checks.Load()-stoppedAt)
+	}
+}
+
+func TestLoadBalancer_GetNextBackendExcluding(t *testing.T) {
+	backends := hashBackends([]bool{true, true, true})
+	lb := New(backends, NewRoundRobin(), time.Hour)
+
+	scenarios := []struct {
+		name          string
+		exclude       []*backend.Backend
+		expectedError error
+	}{
+		{"Nothing Excluded", nil, nil},
+		{"One Excluded", backends[:1], nil},
+		{"Two Excluded", backends[1:], nil},
+		{"All Excluded", backends, NoRegisteredBackends},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			for range 6 {
+				be, err := lb.GetNextBackendExcluding(nil, scenario.exclude)
+
+				if !errors.Is(err, scenario.expectedError) {
+					t.Fatalf("GetNextBackendExcluding() error = %v, expected %v", err, scenario.expectedError)
+				}
+
+				if err == nil && slices.Contains(scenario.exclude, be) {
+					t.Fatalf("GetNextBackendExcluding() returned excluded backend %v", be.Url)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadBalancer_SkipsOpenCircuits(t *testing.T) {
+	consistentHash, _ := NewConsistentHash(HashKey{Source: HashKeyClientIp}, 0)
+
+	strategies := []struct {
+		name     string
+		strategy Strategy
+	}{
+		{RoundRobinStrategy, NewRoundRobin()},
+		{WeightedRoundRobinStrategy, NewWeightedRoundRobin()},
+		{LeastConnectionsStrategy, NewLeastConnections()},
+		{PowerOfTwoChoicesStrategy, NewPowerOfTwoChoices()},
+		{LeastLatencyStrategy, NewLeastLatency()},
+		{ConsistentHashStrategy, consistentHash},
+	}
+
+	for _, scenario := range strategies {
+		t.Run(scenario.name, func(t *testing.T) {
+			backends := hashBackends([]bool{true, true, true})
+
+			for _, be := range backends[:2] {
+				be.SetCircuitBreaker(backend.CircuitBreaker{MinRequests: 1, CoolOff: time.Hour})
+				attempt, _ := be.TryAcquire()
+				attempt.RecordFailure()
+			}
+
+			lb := New(backends, scenario.strategy, time.Hour)
+
+			for range 10 {
+				be, err := lb.GetNextBackend(httptest.NewRequest(http.MethodGet, "/", nil))
+
+				if err != nil {
+					t.Fatalf("GetNextBackend() returned an unexpected error = %v", err)
+				}
+
+				if be != backends[2] {
+					t.Fatalf("GetNextBackend() returned %v, whose circuit is open", be.Url)
+				}
+			}
+		})
+	}
+}
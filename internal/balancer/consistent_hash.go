@@ -0,0 +1,189 @@
+package balancer
+
+import (
+	"cmp"
+	"errors"
+	"hash/fnv"
+	"load-balancer/internal/backend"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	HashKeyClientIp    = "client_ip"
+	HashKeyHeader      = "header"
+	HashKeyCookie      = "cookie"
+	HashKeyPathSegment = "path_segment"
+)
+
+const DefaultVirtualNodes = 160
+
+var ErrInvalidHashKey = errors.New("invalid hash key source")
+var ErrMissingHashKeyName = errors.New("hash key source requires a name")
+
+// HashKey describes which part of a request is hashed onto the ring. Name is the header or cookie name and Segment
+// is the zero-based index of the path segment; each only applies to its own Source.
+type HashKey struct {
+	Source  string
+	Name    string
+	Segment int
+}
+
+// ConsistentHash routes every request with the same key to the same backend. Each backend is placed on a hash ring
+// many times (its virtual nodes) so keys spread evenly, and a key is served by the first healthy backend clockwise
+// from it. When a backend goes unhealthy only the keys it owned move, and they move back once it recovers.
+type ConsistentHash struct {
+	key          HashKey
+	virtualNodes int
+	mutex        sync.RWMutex
+	ring         *hashRing
+}
+
+type hashRing struct {
+	members []*backend.Backend
+	nodes   []ringNode
+}
+
+type ringNode struct {
+	hash  uint64
+	owner *backend.Backend
+}
+
+func NewConsistentHash(key HashKey, virtualNodes int) (*ConsistentHash, error) {
+	switch key.Source {
+	case HashKeyClientIp:
+	case HashKeyPathSegment:
+		if key.Segment < 0 {
+			return nil, ErrInvalidHashKey
+		}
+	case HashKeyHeader, HashKeyCookie:
+		if key.Name == "" {
+			return nil, ErrMissingHashKeyName
+		}
+	default:
+		return nil, ErrInvalidHashKey
+	}
+
+	if virtualNodes <= 0 {
+		virtualNodes = DefaultVirtualNodes
+	}
+
+	return &ConsistentHash{key: key, virtualNodes: virtualNodes, ring: &hashRing{}}, nil
+}
+
+func (ch *ConsistentHash) NextBackend(backends []*backend.Backend, r *http.Request) (*backend.Backend, error) {
+	if len(backends) <= 0 {
+		return nil, NoRegisteredBackends
+	}
+
+	ring := ch.ringFor(backends)
+	keyHash := hash(ch.routingKey(r))
+	start, _ := slices.BinarySearchFunc(ring.nodes, keyHash, func(node ringNode, target uint64) int {
+		return cmp.Compare(node.hash, target)
+	})
+
+	for i := range ring.nodes {
+		owner := ring.nodes[(start+i)%len(ring.nodes)].owner
+
+		if owner.IsHealthy() {
+			return owner, nil
+		}
+	}
+
+	return nil, NoHealthyBackends
+}
+
+// ringFor returns a ring built from backends, rebuilding the cached one only when the set of backends has changed.
+func (ch *ConsistentHash) ringFor(backends []*backend.Backend) *hashRing {
+	ch.mutex.RLock()
+	ring := ch.ring
+	ch.mutex.RUnlock()
+
+	if slices.Equal(ring.members, backends) {
+		return ring
+	}
+
+	ch.mutex.Lock()
+	defer ch.mutex.Unlock()
+
+	if !slices.Equal(ch.ring.members, backends) {
+		ch.ring = newHashRing(backends, ch.virtualNodes)
+	}
+
+	return ch.ring
+}
+
+func newHashRing(backends []*backend.Backend, virtualNodes int) *hashRing {
+	ring := &hashRing{members: slices.Clone(backends), nodes: make([]ringNode, 0, len(backends)*virtualNodes)}
+
+	for _, be := range backends {
+		// Placing nodes by URL rather than slice position keeps a backend's share of the ring stable when others are
+		// added or removed.
+		for i := range virtualNodes {
+			ring.nodes = append(ring.nodes, ringNode{hash(be.Url.String() + "#" + strconv.Itoa(i)), be})
+		}
+	}
+
+	slices.SortFunc(ring.nodes, func(a, b ringNode) int {
+		return cmp.Compare(a.hash, b.hash)
+	})
+
+	return ring
+}
+
+// routingKey extracts the configured key from the request. Requests that don't carry the key (no such header,
+// cookie or path segment) fall back to the client IP, so they still stick to one backend.
+func (ch *ConsistentHash) routingKey(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+
+	switch ch.key.Source {
+	case HashKeyHeader:
+		if value := r.Header.Get(ch.key.Name); value != "" {
+			return value
+		}
+	case HashKeyCookie:
+		if cookie, err := r.Cookie(ch.key.Name); err == nil && cookie.Value != "" {
+			return cookie.Value
+		}
+	case HashKeyPathSegment:
+		segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+		if ch.key.Segment < len(segments) && segments[ch.key.Segment] != "" {
+			return segments[ch.key.Segment]
+		}
+	}
+
+	return clientIp(r)
+}
+
+func clientIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// hash is FNV-1a followed by the murmur3 finalizer. FNV alone clusters badly on the near-identical virtual node
+// names, and unlike maphash the result is the same in every process, so replicas agree on where a key lives.
+func hash(key string) uint64 {
+	hasher := fnv.New64a()
+	_, _ = hasher.Write([]byte(key))
+	h := hasher.Sum64()
+
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+
+	return h
+}
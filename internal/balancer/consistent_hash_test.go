@@ -0,0 +1,215 @@
+package balancer
+
+import (
+	"errors"
+	"load-balancer/internal/backend"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestNewConsistentHash(t *testing.T) {
+	scenarios := []struct {
+		name          string
+		key           HashKey
+		expectedError error
+	}{
+		{"Client IP", HashKey{Source: HashKeyClientIp}, nil},
+		{"Header", HashKey{Source: HashKeyHeader, Name: "X-User-Id"}, nil},
+		{"Header Without Name", HashKey{Source: HashKeyHeader}, ErrMissingHashKeyName},
+		{"Cookie", HashKey{Source: HashKeyCookie, Name: "session"}, nil},
+		{"Cookie Without Name", HashKey{Source: HashKeyCookie}, ErrMissingHashKeyName},
+		{"Path Segment", HashKey{Source: HashKeyPathSegment, Segment: 1}, nil},
+		{"Negative Path Segment", HashKey{Source: HashKeyPathSegment, Segment: -1}, ErrInvalidHashKey},
+		{"Unknown Source", HashKey{Source: "query"}, ErrInvalidHashKey},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			_, err := NewConsistentHash(scenario.key, 0)
+
+			if !errors.Is(err, scenario.expectedError) {
+				t.Errorf("NewConsistentHash(%+v) error = %v, expected %v", scenario.key, err, scenario.expectedError)
+			}
+		})
+	}
+}
+
+func TestConsistentHash_NextBackend(t *testing.T) {
+	scenarios := []struct {
+		name          string
+		healthStates  []bool
+		expectedError error
+	}{
+		{"No Registered Backends", []bool{}, NoRegisteredBackends},
+		{"No Healthy Backends", []bool{false, false}, NoHealthyBackends},
+		{"Some Healthy Backends", []bool{false, true, true}, nil},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			ch, _ := NewConsistentHash(HashKey{Source: HashKeyHeader, Name: "X-User-Id"}, 0)
+			backends := hashBackends(scenario.healthStates)
+
+			for i := range 20 {
+				actualBackend, err := ch.NextBackend(backends, requestWithHeader("X-User-Id", "user-"+strconv.Itoa(i)))
+
+				if !errors.Is(err, scenario.expectedError) {
+					t.Fatalf("NextBackend() error = %v, expected %v", err, scenario.expectedError)
+				}
+
+				if err == nil && !actualBackend.IsHealthy() {
+					t.Fatalf("NextBackend() returned an unhealthy backend")
+				}
+			}
+		})
+	}
+}
+
+func TestConsistentHash_NextBackend_SameKeySameBackend(t *testing.T) {
+	ch, _ := NewConsistentHash(HashKey{Source: HashKeyHeader, Name: "X-User-Id"}, 0)
+	backends := hashBackends([]bool{true, true, true, true})
+
+	for i := range 50 {
+		key := "user-" + strconv.Itoa(i)
+		first, _ := ch.NextBackend(backends, requestWithHeader("X-User-Id", key))
+
+		for range 5 {
+			next, _ := ch.NextBackend(backends, requestWithHeader("X-User-Id", key))
+
+			if first != next {
+				t.Fatalf("Key %v was routed to %v and then %v", key, first.Url, next.Url)
+			}
+		}
+	}
+}
+
+func TestConsistentHash_NextBackend_OnlyUnhealthyBackendsKeysMove(t *testing.T) {
+	ch, _ := NewConsistentHash(HashKey{Source: HashKeyHeader, Name: "X-User-Id"}, 0)
+	backends := hashBackends([]bool{true, true, true, true})
+	before := map[string]*backend.Backend{}
+
+	for i := range 1000 {
+		key := "user-" + strconv.Itoa(i)
+		before[key], _ = ch.NextBackend(backends, requestWithHeader("X-User-Id", key))
+	}
+
+	backends[2].SetHealth(false)
+
+	for key, previous := range before {
+		after, _ := ch.NextBackend(backends, requestWithHeader("X-User-Id", key))
+
+		if previous != backends[2] && previous != after {
+			t.Fatalf("Key %v moved from healthy backend %v to %v", key, previous.Url, after.Url)
+		}
+
+		if previous == backends[2] && after == backends[2] {
+			t.Fatalf("Key %v is still routed to the unhealthy backend", key)
+		}
+	}
+
+	backends[2].SetHealth(true)
+
+	for key, previous := range before {
+		after, _ := ch.NextBackend(backends, requestWithHeader("X-User-Id", key))
+
+		if previous != after {
+			t.Fatalf("Key %v did not return to %v once it recovered, got %v", key, previous.Url, after.Url)
+		}
+	}
+}
+
+func TestConsistentHash_NextBackend_Distribution(t *testing.T) {
+	ch, _ := NewConsistentHash(HashKey{Source: HashKeyHeader, Name: "X-User-Id"}, 0)
+	backends := hashBackends([]bool{true, true, true, true})
+	counts := map[*backend.Backend]int{}
+
+	for i := range 10000 {
+		be, _ := ch.NextBackend(backends, requestWithHeader("X-User-Id", "user-"+strconv.Itoa(i)))
+		counts[be]++
+	}
+
+	for _, be := range backends {
+		if counts[be] < 1500 || counts[be] > 3500 {
+			t.Errorf("Expected roughly a quarter of 10000 keys on %v, got %v", be.Url, counts[be])
+		}
+	}
+}
+
+func TestConsistentHash_RoutingKey(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/tenants/acme/orders", nil)
+	request.RemoteAddr = "10.0.0.7:51234"
+	request.Header.Set("X-User-Id", "user-1")
+	request.AddCookie(&http.Cookie{Name: "session", Value: "abc123"})
+
+	scenarios := []struct {
+		name     string
+		key      HashKey
+		expected string
+	}{
+		{"Client IP", HashKey{Source: HashKeyClientIp}, "10.0.0.7"},
+		{"Header", HashKey{Source: HashKeyHeader, Name: "X-User-Id"}, "user-1"},
+		{"Missing Header", HashKey{Source: HashKeyHeader, Name: "X-Tenant"}, "10.0.0.7"},
+		{"Cookie", HashKey{Source: HashKeyCookie, Name: "session"}, "abc123"},
+		{"Missing Cookie", HashKey{Source: HashKeyCookie, Name: "other"}, "10.0.0.7"},
+		{"Path Segment", HashKey{Source: HashKeyPathSegment, Segment: 1}, "acme"},
+		{"Missing Path Segment", HashKey{Source: HashKeyPathSegment, Segment: 5}, "10.0.0.7"},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			ch, _ := NewConsistentHash(scenario.key, 0)
+
+			if actual := ch.routingKey(request); actual != scenario.expected {
+				t.Errorf("routingKey() = %v, expected %v", actual, scenario.expected)
+			}
+		})
+	}
+}
+
+func BenchmarkConsistentHash_NextBackend(b *testing.B) {
+	ch, _ := NewConsistentHash(HashKey{Source: HashKeyHeader, Name: "X-User-Id"}, 0)
+	backends := hashBackends([]bool{true, false, false, true, true, false, true})
+	request := requestWithHeader("X-User-Id", "user-1")
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		_, _ = ch.NextBackend(backends, request)
+	}
+}
+
+func BenchmarkParallelConsistentHash_NextBackend(b *testing.B) {
+	ch, _ := NewConsistentHash(HashKey{Source: HashKeyHeader, Name: "X-User-Id"}, 0)
+	backends := hashBackends([]bool{true, false, false, true, true, false, true})
+	request := requestWithHeader("X-User-Id", "user-1")
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = ch.NextBackend(backends, request)
+		}
+	})
+}
+
+func hashBackends(healthStates []bool) []*backend.Backend {
+	var backends []*backend.Backend
+
+	for i, healthState := range healthStates {
+		be, _ := backend.NewFromString("http://test"+strconv.Itoa(i)+".com", "/test", nil)
+		be.SetHealth(healthState)
+
+		backends = append(backends, be)
+	}
+
+	return backends
+}
+
+func requestWithHeader(name string, value string) *http.Request {
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(name, value)
+
+	return request
+}
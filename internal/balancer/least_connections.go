@@ -3,6 +3,7 @@ package balancer
 import (
 	"load-balancer/internal/backend"
 	"math"
+	"net/http"
 )
 
 type LeastConnections struct {
@@ -12,7 +13,7 @@ func NewLeastConnections() *LeastConnections {
 	return &LeastConnections{}
 }
 
-func (lc *LeastConnections) NextBackend(backends []*backend.Backend) (*backend.Backend, error) {
+func (lc *LeastConnections) NextBackend(backends []*backend.Backend, _ *http.Request) (*backend.Backend, error) {
 	if len(backends) <= 0 {
 		return nil, NoRegisteredBackends
 	}
@@ -57,7 +57,7 @@ func TestLeastConnections_NextBackend(t *testing.T) {
 		t.Run(scenario.name, func(t *testing.T) {
 			lc := NewLeastConnections()
 
-			nextBackend, err := lc.NextBackend(scenario.backends)
+			nextBackend, err := lc.NextBackend(scenario.backends, nil)
 
 			if scenario.expectedError != nil && err == nil {
 				t.Errorf("Expected error %v, got nil", scenario.expectedError)
@@ -96,7 +96,7 @@ func BenchmarkLeastConnections_NextBackend(b *testing.B) {
 	b.ResetTimer()
 
 	for n := 0; n < b.N; n++ {
-		_, _ = lc.NextBackend(backends)
+		_, _ = lc.NextBackend(backends, nil)
 	}
 }
 
@@ -123,7 +123,7 @@ func BenchmarkParallelLeastConnections_NextBackend(b *testing.B) {
 
 	b.RunParallel(func(pb *testing.PB) {
 		for pb.Next() {
-			_, _ = lc.NextBackend(backends)
+			_, _ = lc.NextBackend(backends, nil)
 		}
 	})
 }
@@ -0,0 +1,53 @@
+package balancer
+
+import (
+	"load-balancer/internal/backend"
+	"math"
+	"net/http"
+)
+
+// LeastLatency is a peak-EWMA strategy: it routes to the backend with the lowest observed latency weighted by the
+// requests it already has in flight. A backend that slows down (GC pauses, noisy neighbours) while still passing its
+// health check gets a higher cost and sheds traffic until it recovers.
+//
+// A backend's latency fades while it gets no traffic, so one that was shed is probed again once the faster backends
+// have enough requests in flight. It fades to no less than half of its last response time, so a backend that is slow
+// throughout doesn't win over a faster one just by having been left alone.
+type LeastLatency struct {
+}
+
+func NewLeastLatency() *LeastLatency {
+	return &LeastLatency{}
+}
+
+func (ll *LeastLatency) NextBackend(backends []*backend.Backend, _ *http.Request) (*backend.Backend, error) {
+	if len(backends) <= 0 {
+		return nil, NoRegisteredBackends
+	}
+
+	minCost := math.Inf(1)
+	var selectedBackend *backend.Backend
+
+	for _, be := range backends {
+		if !be.IsHealthy() {
+			continue
+		}
+
+		if cost := latencyCost(be); cost < minCost {
+			minCost = cost
+			selectedBackend = be
+		}
+	}
+
+	if selectedBackend == nil {
+		return nil, NoHealthyBackends
+	}
+
+	return selectedBackend, nil
+}
+
+// latencyCost adds a nanosecond to the latency so backends that have not been observed yet still compare by their
+// in-flight requests instead of all costing zero.
+func latencyCost(be *backend.Backend) float64 {
+	return float64(be.Latency()+1) * float64(be.ActiveConnections()+1)
+}
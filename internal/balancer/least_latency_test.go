@@ -0,0 +1,128 @@
+package balancer
+
+import (
+	"errors"
+	"load-balancer/internal/backend"
+	"testing"
+	"time"
+)
+
+func TestLeastLatency_NextBackend(t *testing.T) {
+	scenarios := []struct {
+		name          string
+		backends      []*backend.Backend
+		expectedIndex int
+		expectedError error
+	}{
+		{
+			"No Backends",
+			[]*backend.Backend{},
+			-1,
+			NoRegisteredBackends,
+		},
+		{
+			"No Healthy Backends",
+			[]*backend.Backend{
+				backendWithLatency(10*time.Millisecond, 0, false),
+				backendWithLatency(10*time.Millisecond, 0, false),
+			},
+			-1,
+			NoHealthyBackends,
+		},
+		{
+			"Fastest Backend",
+			[]*backend.Backend{
+				backendWithLatency(80*time.Millisecond, 0, true),
+				backendWithLatency(20*time.Millisecond, 0, true),
+				backendWithLatency(5*time.Millisecond, 0, false),
+				backendWithLatency(40*time.Millisecond, 0, true),
+			},
+			1,
+			nil,
+		},
+		{
+			"Fastest Backend Is Too Busy",
+			[]*backend.Backend{
+				backendWithLatency(30*time.Millisecond, 1, true),
+				backendWithLatency(20*time.Millisecond, 4, true),
+			},
+			0,
+			nil,
+		},
+		{
+			"Unobserved Backends Compare By Connections",
+			[]*backend.Backend{
+				backendWithLatency(0, 3, true),
+				backendWithLatency(0, 1, true),
+				backendWithLatency(0, 2, true),
+			},
+			1,
+			nil,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			ll := NewLeastLatency()
+
+			nextBackend, err := ll.NextBackend(scenario.backends, nil)
+
+			if !errors.Is(err, scenario.expectedError) {
+				t.Fatalf("Expected error %v, got %v", scenario.expectedError, err)
+			}
+
+			if scenario.expectedError == nil && scenario.backends[scenario.expectedIndex] != nextBackend {
+				t.Errorf("Expected backend %v, got backend with latency %v and %v connections", scenario.expectedIndex, nextBackend.Latency(), nextBackend.ActiveConnections())
+			}
+		})
+	}
+}
+
+func BenchmarkLeastLatency_NextBackend(b *testing.B) {
+	ll := NewLeastLatency()
+	backends := latencyBenchmarkBackends()
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		_, _ = ll.NextBackend(backends, nil)
+	}
+}
+
+func BenchmarkParallelLeastLatency_NextBackend(b *testing.B) {
+	ll := NewLeastLatency()
+	backends := latencyBenchmarkBackends()
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = ll.NextBackend(backends, nil)
+		}
+	})
+}
+
+func latencyBenchmarkBackends() []*backend.Backend {
+	return []*backend.Backend{
+		backendWithLatency(0, 0, false),
+		backendWithLatency(10*time.Millisecond, 10, true),
+		backendWithLatency(12*time.Millisecond, 12, true),
+		backendWithLatency(23*time.Millisecond, 23, true),
+		backendWithLatency(8*time.Millisecond, 8, true),
+		backendWithLatency(9*time.Millisecond, 9, true),
+		backendWithLatency(15*time.Millisecond, 15, true),
+		backendWithLatency(17*time.Millisecond, 17, true),
+		backendWithLatency(3*time.Millisecond, 3, true),
+		backendWithLatency(0, 0, false),
+	}
+}
+
+func backendWithLatency(latency time.Duration, connections int32, healthy bool) *backend.Backend {
+	be := backendWithConnections(connections, healthy)
+
+	if latency > 0 {
+		be.ObserveLatency(latency)
+	}
+
+	return be
+}
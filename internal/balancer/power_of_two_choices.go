@@ -0,0 +1,90 @@
+package balancer
+
+import (
+	"load-balancer/internal/backend"
+	"math/rand/v2"
+	"net/http"
+)
+
+// PowerOfTwoChoices samples two random healthy backends and routes to the one with fewer active connections. It
+// gets most of the benefit of least connections without scanning every backend, and because each request compares
+// a different pair, a burst of simultaneous requests doesn't all herd onto the same least-loaded instance.
+type PowerOfTwoChoices struct {
+}
+
+func NewPowerOfTwoChoices() *PowerOfTwoChoices {
+	return &PowerOfTwoChoices{}
+}
+
+func (p2c *PowerOfTwoChoices) NextBackend(backends []*backend.Backend, _ *http.Request) (*backend.Backend, error) {
+	if len(backends) <= 0 {
+		return nil, NoRegisteredBackends
+	}
+
+	first, second := randomHealthyPair(backends)
+
+	if first == nil {
+		return nil, NoHealthyBackends
+	}
+
+	if second == nil || first.ActiveConnections() <= second.ActiveConnections() {
+		return first, nil
+	}
+
+	return second, nil
+}
+
+// pairAttempts is how many random pairs randomHealthyPair draws before scanning for healthy backends instead.
+const pairAttempts = 3
+
+// randomHealthyPair picks two distinct healthy backends uniformly at random. It first draws random pairs of indices and
+// keeps the first pair where both are healthy, which is a single draw when every backend is healthy. If that keeps
+// landing on unhealthy backends it falls back to reservoir sampling over one pass, so every pair of healthy backends is
+// equally likely either way. The pair comes back in random order too, so a tie between them doesn't favour the backend
+// listed first. second is nil when only one backend is healthy, and both are nil when none are.
+func randomHealthyPair(backends []*backend.Backend) (first, second *backend.Backend) {
+	if len(backends) >= 2 {
+		for range pairAttempts {
+			i := rand.IntN(len(backends))
+			j := rand.IntN(len(backends) - 1)
+
+			if j >= i {
+				j++
+			}
+
+			if backends[i].IsHealthy() && backends[j].IsHealthy() {
+				return backends[i], backends[j]
+			}
+		}
+	}
+
+	healthy := 0
+
+	for _, be := range backends {
+		if !be.IsHealthy() {
+			continue
+		}
+
+		healthy++
+
+		switch {
+		case healthy == 1:
+			first = be
+		case healthy == 2:
+			second = be
+		case rand.IntN(healthy) < 2:
+			if rand.IntN(2) == 0 {
+				first = be
+			} else {
+				second = be
+			}
+		}
+	}
+
+	// The scan keeps the pair in list order, so it is shuffled before being returned.
+	if second != nil && rand.IntN(2) == 0 {
+		first, second = second, first
+	}
+
+	return first, second
+}
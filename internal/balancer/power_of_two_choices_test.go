@@ -0,0 +1,291 @@
+package balancer
+
+import (
+	"errors"
+	"load-balancer/internal/backend"
+	"testing"
+)
+
+func TestPowerOfTwoChoices_NextBackend(t *testing.T) {
+	scenarios := []struct {
+		name                string
+		backends            []*backend.Backend
+		expectedConnections int32
+		expectedError       error
+	}{
+		{
+			"No Backends",
+			[]*backend.Backend{},
+			0,
+			NoRegisteredBackends,
+		},
+		{
+			"No Healthy Backends",
+			[]*backend.Backend{
+				backendWithConnections(0, false),
+				backendWithConnections(0, false),
+			},
+			0,
+			NoHealthyBackends,
+		},
+		{
+			"One Healthy Backend",
+			[]*backend.Backend{
+				backendWithConnections(0, false),
+				backendWithConnections(40, true),
+				backendWithConnections(0, false),
+			},
+			40,
+			nil,
+		},
+		{
+			"Two Healthy Backends - Always Picks Less Busy",
+			[]*backend.Backend{
+				backendWithConnections(12, true),
+				backendWithConnections(0, false),
+				backendWithConnections(5, true),
+				backendWithConnections(1, false),
+			},
+			5,
+			nil,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			p2c := NewPowerOfTwoChoices()
+
+			for range 50 {
+				nextBackend, err := p2c.NextBackend(scenario.backends, nil)
+
+				if !errors.Is(err, scenario.expectedError) {
+					t.Fatalf("Expected error %v, got %v", scenario.expectedError, err)
+				}
+
+				if scenario.expectedError == nil && scenario.expectedConnections != nextBackend.ActiveConnections() {
+					t.Fatalf("Expected Backend with %v connections, got one with %v connections", scenario.expectedConnections, nextBackend.ActiveConnections())
+				}
+			}
+		})
+	}
+}
+
+func TestPowerOfTwoChoices_NextBackend_NeverPicksBusiest(t *testing.T) {
+	p2c := NewPowerOfTwoChoices()
+	busiest := backendWithConnections(100, true)
+
+	backends := []*backend.Backend{
+		backendWithConnections(3, true),
+		busiest,
+		backendWithConnections(7, true),
+		backendWithConnections(0, false),
+		backendWithConnections(5, true),
+	}
+
+	for range 1000 {
+		nextBackend, err := p2c.NextBackend(backends, nil)
+
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if nextBackend == busiest {
+			t.Fatalf("Picked the busiest backend, which should always lose its comparison")
+		}
+
+		if !nextBackend.IsHealthy() {
+			t.Fatalf("Picked an unhealthy backend")
+		}
+	}
+}
+
+func TestRandomHealthyPair_Uniform(t *testing.T) {
+	a := backendWithConnections(0, true)
+	b := backendWithConnections(0, true)
+	c := backendWithConnections(0, true)
+
+	scenarios := []struct {
+		name     string
+		backends []*backend.Backend
+	}{
+		{
+			"All Healthy",
+			[]*backend.Backend{a, b, c},
+		},
+		{
+			"Unhealthy Backend Between Healthy Ones",
+			[]*backend.Backend{a, backendWithConnections(0, false), b, c},
+		},
+		{
+			"Mostly Unhealthy",
+			[]*backend.Backend{
+				backendWithConnections(0, false),
+				a,
+				backendWithConnections(0, false),
+				backendWithConnections(0, false),
+				b,
+				backendWithConnections(0, false),
+				backendWithConnections(0, false),
+				c,
+			},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			const draws = 30000
+			pairs := map[[2]*backend.Backend]int{}
+
+			for range draws {
+				first, second := randomHealthyPair(scenario.backends)
+
+				if first == nil || second == nil || first == second {
+					t.Fatalf("Expected two distinct healthy backends, got %p and %p", first, second)
+				}
+
+				if !first.IsHealthy() || !second.IsHealthy() {
+					t.Fatalf("Picked an unhealthy backend")
+				}
+
+				for _, pair := range [][2]*backend.Backend{{a, b}, {a, c}, {b, c}} {
+					if (first == pair[0] && second == pair[1]) || (first == pair[1] && second == pair[0]) {
+						pairs[pair]++
+					}
+				}
+			}
+
+			for pair, count := range pairs {
+				if count < draws/3-draws/20 || count > draws/3+draws/20 {
+					t.Errorf("Expected each pair about %d times, got %d for %p/%p", draws/3, count, pair[0], pair[1])
+				}
+			}
+
+			if len(pairs) != 3 {
+				t.Errorf("Expected all 3 pairs to be drawn, got %d", len(pairs))
+			}
+		})
+	}
+}
+
+func TestPowerOfTwoChoices_NextBackend_TiesSpreadEvenly(t *testing.T) {
+	a := backendWithConnections(4, true)
+	b := backendWithConnections(4, true)
+	c := backendWithConnections(4, true)
+
+	scenarios := []struct {
+		name     string
+		backends []*backend.Backend
+		tied     []*backend.Backend
+	}{
+		{
+			"All Healthy",
+			[]*backend.Backend{a, b, c},
+			[]*backend.Backend{a, b, c},
+		},
+		{
+			"Two Healthy Among Unhealthy",
+			[]*backend.Backend{
+				a,
+				backendWithConnections(0, false),
+				backendWithConnections(0, false),
+				backendWithConnections(0, false),
+				backendWithConnections(0, false),
+				b,
+			},
+			[]*backend.Backend{a, b},
+		},
+		{
+			"Mostly Unhealthy",
+			[]*backend.Backend{
+				a,
+				backendWithConnections(0, false),
+				backendWithConnections(0, false),
+				b,
+				backendWithConnections(0, false),
+				backendWithConnections(0, false),
+				c,
+			},
+			[]*backend.Backend{a, b, c},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			const draws = 30000
+			p2c := NewPowerOfTwoChoices()
+			picks := map[*backend.Backend]int{}
+
+			for range draws {
+				nextBackend, err := p2c.NextBackend(scenario.backends, nil)
+
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+
+				picks[nextBackend]++
+			}
+
+			expected := draws / len(scenario.tied)
+
+			for _, be := range scenario.tied {
+				if picks[be] < expected-draws/20 || picks[be] > expected+draws/20 {
+					t.Errorf("Expected each tied backend about %d times, got %v", expected, picks[be])
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkPowerOfTwoChoices_NextBackend(b *testing.B) {
+	p2c := NewPowerOfTwoChoices()
+
+	backends := []*backend.Backend{
+		backendWithConnections(0, false),
+		backendWithConnections(10, true),
+		backendWithConnections(12, true),
+		backendWithConnections(23, true),
+		backendWithConnections(8, true),
+		backendWithConnections(9, true),
+		backendWithConnections(15, true),
+		backendWithConnections(17, true),
+		backendWithConnections(12, true),
+		backendWithConnections(3, true),
+		backendWithConnections(8, true),
+		backendWithConnections(1, true),
+		backendWithConnections(0, false),
+	}
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		_, _ = p2c.NextBackend(backends, nil)
+	}
+}
+
+func BenchmarkParallelPowerOfTwoChoices_NextBackend(b *testing.B) {
+	p2c := NewPowerOfTwoChoices()
+
+	backends := []*backend.Backend{
+		backendWithConnections(0, false),
+		backendWithConnections(10, true),
+		backendWithConnections(12, true),
+		backendWithConnections(23, true),
+		backendWithConnections(8, true),
+		backendWithConnections(9, true),
+		backendWithConnections(15, true),
+		backendWithConnections(17, true),
+		backendWithConnections(12, true),
+		backendWithConnections(3, true),
+		backendWithConnections(8, true),
+		backendWithConnections(1, true),
+		backendWithConnections(0, false),
+	}
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = p2c.NextBackend(backends, nil)
+		}
+	})
+}
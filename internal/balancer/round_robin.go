@@ -2,6 +2,7 @@ package balancer
 
 import (
 	"load-balancer/internal/backend"
+	"net/http"
 	"sync/atomic"
 )
 
@@ -16,7 +17,7 @@ func NewRoundRobin() *RoundRobin {
 	return &RoundRobin{routeToIndex}
 }
 
-func (rr *RoundRobin) NextBackend(backends []*backend.Backend) (*backend.Backend, error) {
+func (rr *RoundRobin) NextBackend(backends []*backend.Backend, _ *http.Request) (*backend.Backend, error) {
 	if len(backends) <= 0 {
 		return nil, NoRegisteredBackends
 	}
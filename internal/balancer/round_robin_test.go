@@ -36,7 +36,7 @@ func TestRoundRobin_NextBackend(t *testing.T) {
 		lb := New(backends, NewRoundRobin(), 30*time.Second)
 
 		for i, expectedIndex := range scenario.expectedIndices {
-			actualBackend, actualErr := lb.GetNextBackend()
+			actualBackend, actualErr := lb.GetNextBackend(nil)
 
 			if scenario.expectedError != nil && actualErr != nil && !errors.Is(actualErr, scenario.expectedError) {
 				t.Errorf("%v (iteration %v) GetNextBackend() error = %v, expected error = %v", scenario.name, i+1, actualErr, scenario.expectedError)
@@ -79,7 +79,7 @@ func BenchmarkRoundRobin_NextBackend(b *testing.B) {
 	b.ResetTimer()
 
 	for n := 0; n < b.N; n++ {
-		_, _ = lb.GetNextBackend()
+		_, _ = lb.GetNextBackend(nil)
 	}
 }
 
@@ -99,7 +99,7 @@ func BenchmarkParallelRoundRobin_NextBackend(b *testing.B) {
 
 	b.RunParallel(func(pb *testing.PB) {
 		for pb.Next() {
-			_, _ = lb.GetNextBackend()
+			_, _ = lb.GetNextBackend(nil)
 		}
 	})
 }
@@ -0,0 +1,105 @@
+package balancer
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"load-balancer/internal/backend"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const DefaultAffinityCookieName = "lb_affinity"
+
+// SessionAffinity pins a client to the backend that served its first request using a cookie the load balancer
+// issues. The cookie holds an HMAC of the backend's URL rather than the URL itself, so it neither exposes the
+// topology nor can be forged to reach a backend of the client's choosing.
+type SessionAffinity struct {
+	cookieName string
+	secret     []byte
+	maxAge     time.Duration
+	tokens     sync.Map
+}
+
+// NewSessionAffinity creates a SessionAffinity signing with secret. A nil or empty secret generates a random one,
+// which means cookies stop matching when the process restarts and aren't shared between replicas. A zero maxAge
+// issues session cookies.
+func NewSessionAffinity(cookieName string, secret []byte, maxAge time.Duration) *SessionAffinity {
+	if cookieName == "" {
+		cookieName = DefaultAffinityCookieName
+	}
+
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		_, _ = rand.Read(secret)
+	}
+
+	return &SessionAffinity{cookieName: cookieName, secret: secret, maxAge: maxAge}
+}
+
+// backendFor returns the backend named by the request's affinity cookie, or nil if there is no valid cookie or the
+// backend it names is no longer registered or healthy.
+func (sa *SessionAffinity) backendFor(r *http.Request, backends []*backend.Backend) *backend.Backend {
+	if r == nil {
+		return nil
+	}
+
+	cookie, err := r.Cookie(sa.cookieName)
+
+	if err != nil {
+		return nil
+	}
+
+	for _, be := range backends {
+		if hmac.Equal([]byte(cookie.Value), []byte(sa.token(be))) {
+			if !be.IsHealthy() {
+				return nil
+			}
+
+			return be
+		}
+	}
+
+	return nil
+}
+
+// stick sets the affinity cookie for be on the response, unless the request already carries it.
+func (sa *SessionAffinity) stick(w http.ResponseWriter, r *http.Request, be *backend.Backend) {
+	token := sa.token(be)
+
+	if cookie, err := r.Cookie(sa.cookieName); err == nil && cookie.Value == token {
+		return
+	}
+
+	cookie := &http.Cookie{
+		Name:     sa.cookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	}
+
+	if sa.maxAge > 0 {
+		cookie.MaxAge = int(sa.maxAge.Seconds())
+	}
+
+	http.SetCookie(w, cookie)
+}
+
+func (sa *SessionAffinity) token(be *backend.Backend) string {
+	backendUrl := be.Url.String()
+
+	if token, ok := sa.tokens.Load(backendUrl); ok {
+		return token.(string)
+	}
+
+	mac := hmac.New(sha256.New, sa.secret)
+	mac.Write([]byte(backendUrl))
+	token := hex.EncodeToString(mac.Sum(nil)[:16])
+	sa.tokens.Store(backendUrl, token)
+
+	return token
+}
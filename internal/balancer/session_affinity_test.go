@@ -0,0 +1,120 @@
+package balancer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLoadBalancer_GetNextBackend_SessionAffinity(t *testing.T) {
+	scenarios := []struct {
+		name          string
+		pinnedIndex   int
+		healthStates  []bool
+		cookieValue   string
+		expectedIndex int
+	}{
+		{"No Cookie Uses Strategy", -1, []bool{true, true, true}, "", 0},
+		{"Cookie Pins Backend", 2, []bool{true, true, true}, "", 2},
+		{"Pinned Backend Unhealthy Uses Strategy", 2, []bool{true, true, false}, "", 0},
+		{"Forged Cookie Uses Strategy", -1, []bool{true, true, true}, "not-a-valid-token", 0},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			backends := hashBackends(scenario.healthStates)
+			affinity := NewSessionAffinity("", []byte("secret"), 0)
+			lb := New(backends, NewRoundRobin(), 30*time.Second)
+			lb.SetSessionAffinity(affinity)
+
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+
+			if scenario.pinnedIndex >= 0 {
+				request.AddCookie(&http.Cookie{Name: DefaultAffinityCookieName, Value: affinity.token(backends[scenario.pinnedIndex])})
+			}
+
+			if scenario.cookieValue != "" {
+				request.AddCookie(&http.Cookie{Name: DefaultAffinityCookieName, Value: scenario.cookieValue})
+			}
+
+			actual, err := lb.GetNextBackend(request)
+
+			if err != nil {
+				t.Fatalf("GetNextBackend() returned an unexpected error = %v", err)
+			}
+
+			if backends[scenario.expectedIndex] != actual {
+				t.Errorf("GetNextBackend() expected %v, got %v", backends[scenario.expectedIndex].Url, actual.Url)
+			}
+		})
+	}
+}
+
+func TestLoadBalancer_Stick(t *testing.T) {
+	backends := hashBackends([]bool{true, true})
+	affinity := NewSessionAffinity("session_backend", []byte("secret"), time.Hour)
+
+	scenarios := []struct {
+		name           string
+		affinity       *SessionAffinity
+		existingCookie string
+		expectCookie   bool
+	}{
+		{"Sticky Sessions Off", nil, "", false},
+		{"First Response", affinity, "", true},
+		{"Already Pinned To Backend", affinity, affinity.token(backends[0]), false},
+		{"Pinned To Another Backend", affinity, affinity.token(backends[1]), true},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			lb := New(backends, NewRoundRobin(), 30*time.Second)
+			lb.SetSessionAffinity(scenario.affinity)
+
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+
+			if scenario.existingCookie != "" {
+				request.AddCookie(&http.Cookie{Name: "session_backend", Value: scenario.existingCookie})
+			}
+
+			recorder := httptest.NewRecorder()
+			lb.Stick(recorder, request, backends[0])
+			cookies := recorder.Result().Cookies()
+
+			if !scenario.expectCookie && len(cookies) != 0 {
+				t.Fatalf("Expected no cookie, got %v", cookies)
+			}
+
+			if !scenario.expectCookie {
+				return
+			}
+
+			if len(cookies) != 1 || cookies[0].Name != "session_backend" || cookies[0].Value != affinity.token(backends[0]) {
+				t.Fatalf("Expected an affinity cookie for the backend, got %v", cookies)
+			}
+
+			if cookies[0].MaxAge != 3600 || !cookies[0].HttpOnly {
+				t.Errorf("Expected an HttpOnly cookie with a one hour max age, got %v", cookies[0])
+			}
+		})
+	}
+}
+
+func TestSessionAffinity_Token(t *testing.T) {
+	backends := hashBackends([]bool{true, true})
+	first := NewSessionAffinity("", []byte("secret"), 0)
+	second := NewSessionAffinity("", []byte("another secret"), 0)
+
+	if first.token(backends[0]) == first.token(backends[1]) {
+		t.Errorf("Expected different backends to get different tokens")
+	}
+
+	if first.token(backends[0]) == second.token(backends[0]) {
+		t.Errorf("Expected different secrets to sign the same backend differently")
+	}
+
+	if first.token(backends[0]) != NewSessionAffinity("", []byte("secret"), 0).token(backends[0]) {
+		t.Errorf("Expected the same secret to sign the same backend the same way")
+	}
+}
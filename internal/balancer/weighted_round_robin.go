@@ -0,0 +1,68 @@
+package balancer
+
+import (
+	"load-balancer/internal/backend"
+	"net/http"
+	"sync"
+)
+
+// WeightedRoundRobin implements nginx's smooth weighted round-robin: every pick adds each healthy backend's weight
+// to its current weight, routes to the highest, then subtracts the total from the winner. Heavier backends get
+// proportionally more traffic, but it is interleaved rather than sent in bursts.
+type WeightedRoundRobin struct {
+	mutex          sync.Mutex
+	currentWeights map[*backend.Backend]int
+}
+
+func NewWeightedRoundRobin() *WeightedRoundRobin {
+	return &WeightedRoundRobin{currentWeights: map[*backend.Backend]int{}}
+}
+
+func (wrr *WeightedRoundRobin) NextBackend(backends []*backend.Backend, _ *http.Request) (*backend.Backend, error) {
+	if len(backends) <= 0 {
+		return nil, NoRegisteredBackends
+	}
+
+	wrr.mutex.Lock()
+	defer wrr.mutex.Unlock()
+
+	wrr.forgetRemovedBackends(backends)
+
+	totalWeight := 0
+	var selectedBackend *backend.Backend
+
+	for _, be := range backends {
+		if !be.IsHealthy() {
+			continue
+		}
+
+		wrr.currentWeights[be] += be.Weight()
+		totalWeight += be.Weight()
+
+		if selectedBackend == nil || wrr.currentWeights[be] > wrr.currentWeights[selectedBackend] {
+			selectedBackend = be
+		}
+	}
+
+	if selectedBackend == nil {
+		return nil, NoHealthyBackends
+	}
+
+	wrr.currentWeights[selectedBackend] -= totalWeight
+
+	return selectedBackend, nil
+}
+
+func (wrr *WeightedRoundRobin) forgetRemovedBackends(backends []*backend.Backend) {
+	if len(wrr.currentWeights) <= len(backends) {
+		return
+	}
+
+	present := make(map[*backend.Backend]int, len(backends))
+
+	for _, be := range backends {
+		present[be] = wrr.currentWeights[be]
+	}
+
+	wrr.currentWeights = present
+}
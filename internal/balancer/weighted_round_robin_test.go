@@ -0,0 +1,112 @@
+package balancer
+
+import (
+	"errors"
+	"load-balancer/internal/backend"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWeightedRoundRobin_NextBackend(t *testing.T) {
+	scenarios := []struct {
+		name            string
+		weights         []int
+		healthStates    []bool
+		expectedIndices []int
+		expectedError   error
+	}{
+		{"No Registered Backends", []int{}, []bool{}, []int{-1}, NoRegisteredBackends},
+		{"No Healthy Backends", []int{1, 2}, []bool{false, false}, []int{-1}, NoHealthyBackends},
+		{"Equal Weights", []int{1, 1, 1}, []bool{true, true, true}, []int{0, 1, 2, 0, 1, 2}, nil},
+		{"Smooth Interleaving", []int{5, 1, 1}, []bool{true, true, true}, []int{0, 0, 1, 0, 2, 0, 0, 0, 0, 1}, nil},
+		{"Two To One", []int{2, 1}, []bool{true, true}, []int{0, 1, 0, 0, 1, 0}, nil},
+		{"Heaviest Backend Unhealthy", []int{5, 1, 1}, []bool{false, true, true}, []int{1, 2, 1, 2}, nil},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			var backends []*backend.Backend
+
+			for i, weight := range scenario.weights {
+				backends = append(backends, backendWithWeight(i, weight, scenario.healthStates[i]))
+			}
+
+			lb := New(backends, NewWeightedRoundRobin(), 30*time.Second)
+
+			for i, expectedIndex := range scenario.expectedIndices {
+				actualBackend, actualErr := lb.GetNextBackend(nil)
+
+				if scenario.expectedError != nil && !errors.Is(actualErr, scenario.expectedError) {
+					t.Fatalf("(iteration %v) GetNextBackend() error = %v, expected error = %v", i+1, actualErr, scenario.expectedError)
+				}
+
+				if scenario.expectedError == nil && actualErr != nil {
+					t.Fatalf("(iteration %v) GetNextBackend() returned an unexpected error = %v", i+1, actualErr)
+				}
+
+				if scenario.expectedError == nil && backends[expectedIndex] != actualBackend {
+					t.Fatalf("(iteration %v) GetNextBackend() returned the wrong backend, expected %v, actual %v", i+1, backends[expectedIndex].Url, actualBackend.Url)
+				}
+			}
+		})
+	}
+}
+
+func TestWeightedRoundRobin_NextBackend_ForgetsRemovedBackends(t *testing.T) {
+	wrr := NewWeightedRoundRobin()
+	backends := []*backend.Backend{backendWithWeight(0, 3, true), backendWithWeight(1, 1, true), backendWithWeight(2, 1, true)}
+
+	for range 3 {
+		_, _ = wrr.NextBackend(backends, nil)
+	}
+
+	_, _ = wrr.NextBackend(backends[:2], nil)
+
+	if len(wrr.currentWeights) != 2 {
+		t.Errorf("Expected removed backends to be forgotten, still tracking %d backends", len(wrr.currentWeights))
+	}
+}
+
+func BenchmarkWeightedRoundRobin_NextBackend(b *testing.B) {
+	var backends []*backend.Backend
+
+	for i, healthState := range []bool{true, false, false, true, true, false, true} {
+		backends = append(backends, backendWithWeight(i, i+1, healthState))
+	}
+
+	lb := New(backends, NewWeightedRoundRobin(), 30*time.Second)
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		_, _ = lb.GetNextBackend(nil)
+	}
+}
+
+func BenchmarkParallelWeightedRoundRobin_NextBackend(b *testing.B) {
+	var backends []*backend.Backend
+
+	for i, healthState := range []bool{true, false, false, true, true, false, true} {
+		backends = append(backends, backendWithWeight(i, i+1, healthState))
+	}
+
+	lb := New(backends, NewWeightedRoundRobin(), 30*time.Second)
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = lb.GetNextBackend(nil)
+		}
+	})
+}
+
+func backendWithWeight(index int, weight int, healthy bool) *backend.Backend {
+	be, _ := backend.NewFromString("http://test"+strconv.Itoa(index)+".com", "/test", nil)
+
+	_ = be.SetWeight(weight)
+	be.SetHealth(healthy)
+
+	return be
+}
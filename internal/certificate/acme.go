@@ -0,0 +1,385 @@
+package certificate
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/acme"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultDirectoryUrl = acme.LetsEncryptURL
+	DefaultRenewBefore  = 30 * 24 * time.Hour
+)
+
+const (
+	// acmeCheckInterval is how often certificates are checked for renewal, and hosts without one retried.
+	acmeCheckInterval = time.Minute
+	// acmeMinBackoff and acmeMaxBackoff bound how long a host whose issuance failed waits before it is tried again,
+	// doubling on every failure, so a misconfigured host doesn't run into the CA's rate limits.
+	acmeMinBackoff = time.Minute
+	acmeMaxBackoff = time.Hour
+)
+
+var ErrNoSolver = errors.New("no solver for any of the offered challenges")
+
+// Solver answers one type of ACME challenge, such as http-01 or dns-01. Present makes the response to challenge
+// available for domain, working it out with client, and CleanUp removes it once the CA has validated it or given up.
+type Solver interface {
+	Type() string
+	Present(ctx context.Context, client *acme.Client, domain string, challenge *acme.Challenge) error
+	CleanUp(ctx context.Context, client *acme.Client, domain string, challenge *acme.Challenge) error
+}
+
+// Acme configures an AcmeManager. Only CacheDir and a solver are required.
+type Acme struct {
+	// DirectoryUrl is the CA's ACME directory, DefaultDirectoryUrl by default.
+	DirectoryUrl string
+	// Email is given to the CA as the account's contact, for expiry warnings and policy changes.
+	Email string
+	// CacheDir holds the account key and the issued certificates, so a restart doesn't issue them again.
+	CacheDir string
+	// RenewBefore is how long before it expires a certificate is renewed, DefaultRenewBefore by default.
+	RenewBefore time.Duration
+	// Solvers answer challenges; the first one matching a challenge the CA offers is used.
+	Solvers []Solver
+}
+
+type hostState struct {
+	expires     time.Time
+	nextAttempt time.Time
+	backoff     time.Duration
+}
+
+// AcmeManager issues certificates from an ACME CA for its hosts, renews them before they expire and hands them to a
+// Store.
+type AcmeManager struct {
+	settings Acme
+	client   *acme.Client
+	store    *Store
+	mutex    sync.Mutex
+	hosts    map[string]*hostState
+	wake     chan struct{}
+}
+
+// NewAcmeManager loads the account key from settings.CacheDir, creating the directory and the key if needed. The
+// account itself is registered with the CA on the first issuance.
+func NewAcmeManager(settings Acme, store *Store) (*AcmeManager, error) {
+	if settings.DirectoryUrl == "" {
+		settings.DirectoryUrl = DefaultDirectoryUrl
+	}
+
+	if settings.RenewBefore <= 0 {
+		settings.RenewBefore = DefaultRenewBefore
+	}
+
+	if err := os.MkdirAll(settings.CacheDir, 0o700); err != nil {
+		return nil, err
+	}
+
+	accountKey, err := loadOrCreateKey(filepath.Join(settings.CacheDir, "account.key"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &AcmeManager{
+		settings: settings,
+		client:   &acme.Client{Key: accountKey, DirectoryURL: settings.DirectoryUrl},
+		store:    store,
+		hosts:    map[string]*hostState{},
+		wake:     make(chan struct{}, 1),
+	}, nil
+}
+
+// SetHosts replaces the hosts certificates are managed for. Certificates of hosts that are dropped stop being served;
+// new hosts are served from the cache straight away when it has a certificate for them, and issued one otherwise.
+func (manager *AcmeManager) SetHosts(hosts []string) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	for host := range manager.hosts {
+		if !slices.Contains(hosts, host) {
+			delete(manager.hosts, host)
+			manager.store.Remove(host)
+		}
+	}
+
+	for _, host := range hosts {
+		if manager.hosts[host] != nil {
+			continue
+		}
+
+		manager.hosts[host] = &hostState{}
+
+		if certificate, err := manager.loadCached(host); err == nil {
+			manager.store.Put(host, certificate)
+			manager.hosts[host].expires = certificate.Leaf.NotAfter
+		}
+	}
+
+	select {
+	case manager.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run issues and renews certificates until ctx is done.
+func (manager *AcmeManager) Run(ctx context.Context) {
+	ticker := time.NewTicker(acmeCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		manager.renewDue(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-manager.wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// renewDue issues a certificate for every host that has none or whose certificate is due for renewal, one at a time.
+func (manager *AcmeManager) renewDue(ctx context.Context) {
+	now := time.Now()
+
+	for _, host := range manager.dueHosts(now) {
+		certificate, err := manager.issue(ctx, host)
+
+		manager.mutex.Lock()
+		state := manager.hosts[host]
+
+		if state == nil {
+			// Dropped by SetHosts while it was being issued.
+			manager.mutex.Unlock()
+			continue
+		}
+
+		if err != nil {
+			state.backoff = min(max(state.backoff*2, acmeMinBackoff), acmeMaxBackoff)
+			state.nextAttempt = time.Now().Add(state.backoff)
+			manager.mutex.Unlock()
+			slog.Error("acme: issuing a certificate failed", "host", host, "retry_in", state.backoff, "error", err)
+			continue
+		}
+
+		state.expires, state.backoff, state.nextAttempt = certificate.Leaf.NotAfter, 0, time.Time{}
+		manager.store.Put(host, certificate)
+		manager.mutex.Unlock()
+		slog.Info("acme: issued a certificate", "host", host, "valid_until", certificate.Leaf.NotAfter)
+	}
+}
+
+func (manager *AcmeManager) dueHosts(now time.Time) []string {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	var due []string
+
+	for host, state := range manager.hosts {
+		if now.Before(state.nextAttempt) {
+			continue
+		}
+
+		if state.expires.IsZero() || now.After(state.expires.Add(-manager.settings.RenewBefore)) {
+			due = append(due, host)
+		}
+	}
+
+	slices.Sort(due)
+
+	return due
+}
+
+// issue orders a certificate for host, answers its challenges and writes the result to the cache.
+func (manager *AcmeManager) issue(ctx context.Context, host string) (*tls.Certificate, error) {
+	if err := manager.register(ctx); err != nil {
+		return nil, err
+	}
+
+	order, err := manager.client.AuthorizeOrder(ctx, acme.DomainIDs(host))
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, authzUrl := range order.AuthzURLs {
+		if err = manager.authorize(ctx, host, authzUrl); err != nil {
+			return nil, err
+		}
+	}
+
+	if order, err = manager.client.WaitOrder(ctx, order.URI); err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{host}}, key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	chain, _, err := manager.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cached, err := encodeCertificate(chain, key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.WriteFile(manager.cachePath(host), cached, 0o600); err != nil {
+		return nil, err
+	}
+
+	return parseCertificate(cached)
+}
+
+// authorize proves control of host for one authorization of an order, using the first solver that matches one of the
+// challenges offered.
+func (manager *AcmeManager) authorize(ctx context.Context, host string, authzUrl string) error {
+	authz, err := manager.client.GetAuthorization(ctx, authzUrl)
+
+	if err != nil || authz.Status == acme.StatusValid {
+		return err
+	}
+
+	for _, challenge := range authz.Challenges {
+		for _, solver := range manager.settings.Solvers {
+			if solver.Type() != challenge.Type {
+				continue
+			}
+
+			if err = solver.Present(ctx, manager.client, host, challenge); err != nil {
+				return err
+			}
+
+			defer func() { _ = solver.CleanUp(context.WithoutCancel(ctx), manager.client, host, challenge) }()
+
+			if _, err = manager.client.Accept(ctx, challenge); err != nil {
+				return err
+			}
+
+			_, err = manager.client.WaitAuthorization(ctx, authz.URI)
+
+			return err
+		}
+	}
+
+	return fmt.Errorf("%w for %s", ErrNoSolver, host)
+}
+
+// register creates the account on the first issuance. An account that already exists for the key is reused.
+func (manager *AcmeManager) register(ctx context.Context) error {
+	var contact []string
+
+	if manager.settings.Email != "" {
+		contact = []string{"mailto:" + manager.settings.Email}
+	}
+
+	_, err := manager.client.Register(ctx, &acme.Account{Contact: contact}, acme.AcceptTOS)
+
+	if errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil
+	}
+
+	return err
+}
+
+func (manager *AcmeManager) loadCached(host string) (*tls.Certificate, error) {
+	cached, err := os.ReadFile(manager.cachePath(host))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return parseCertificate(cached)
+}
+
+func (manager *AcmeManager) cachePath(host string) string {
+	return filepath.Join(manager.settings.CacheDir, strings.ToLower(host)+".pem")
+}
+
+// encodeCertificate encodes a private key followed by its certificate chain as PEM, the format of the cache files.
+func encodeCertificate(chain [][]byte, key crypto.Signer) ([]byte, error) {
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer})
+
+	for _, der := range chain {
+		encoded = append(encoded, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+
+	return encoded, nil
+}
+
+func parseCertificate(encoded []byte) (*tls.Certificate, error) {
+	certificate, err := tls.X509KeyPair(encoded, encoded)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(certificate.Leaf.NotAfter) {
+		return nil, fmt.Errorf("certificate expired on %v", certificate.Leaf.NotAfter)
+	}
+
+	return &certificate, nil
+}
+
+func loadOrCreateKey(path string) (crypto.Signer, error) {
+	if encoded, err := os.ReadFile(path); err == nil {
+		block, _ := pem.Decode(encoded)
+
+		if block == nil {
+			return nil, fmt.Errorf("%s: no PEM encoded key", path)
+		}
+
+		return x509.ParseECPrivateKey(block.Bytes)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return key, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600)
+}
@@ -0,0 +1,331 @@
+package certificate
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"golang.org/x/crypto/acme"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestAcmeManager_IssuesWithHttp01(t *testing.T) {
+	solver := NewHttp01Solver()
+	ca := newFakeCa(t, solver.Handler(http.NotFoundHandler()))
+	store := NewStore()
+	cacheDir := t.TempDir()
+
+	manager, err := NewAcmeManager(Acme{DirectoryUrl: ca.URL + "/directory", CacheDir: cacheDir, Solvers: []Solver{solver}}, store)
+
+	if err != nil {
+		t.Fatalf("NewAcmeManager() returned an unexpected error = %v", err)
+	}
+
+	ca.keyAuthorization = func(token string) string {
+		thumbprint, _ := acme.JWKThumbprint(manager.client.Key.Public())
+		return token + "." + thumbprint
+	}
+
+	manager.SetHosts([]string{"app.example.com"})
+	manager.renewDue(context.Background())
+
+	certificate, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: "app.example.com"})
+
+	if err != nil {
+		t.Fatalf("Expected a certificate to be issued, got %v", err)
+	}
+
+	if names := certificate.Leaf.DNSNames; len(names) != 1 || names[0] != "app.example.com" {
+		t.Errorf("Expected a certificate for app.example.com, got %v", names)
+	}
+
+	// A restarted manager serves the cached certificate without going back to the CA.
+	ca.Close()
+	restartedStore := NewStore()
+	restarted, err := NewAcmeManager(Acme{DirectoryUrl: ca.URL + "/directory", CacheDir: cacheDir, Solvers: []Solver{solver}}, restartedStore)
+
+	if err != nil {
+		t.Fatalf("NewAcmeManager() returned an unexpected error = %v", err)
+	}
+
+	restarted.SetHosts([]string{"app.example.com"})
+
+	if !restartedStore.Has("app.example.com") {
+		t.Errorf("Expected the cached certificate to be served after a restart")
+	}
+
+	if due := restarted.dueHosts(time.Now()); len(due) != 0 {
+		t.Errorf("Expected no host to be due for renewal, got %v", due)
+	}
+
+	if due := restarted.dueHosts(time.Now().Add(80 * 24 * time.Hour)); len(due) != 1 {
+		t.Errorf("Expected the certificate to be due for renewal 30 days before it expires, got %v", due)
+	}
+}
+
+func TestAcmeManager_BacksOffAfterFailure(t *testing.T) {
+	ca := newFakeCa(t, http.NotFoundHandler())
+	ca.Close()
+
+	manager, err := NewAcmeManager(Acme{DirectoryUrl: ca.URL + "/directory", CacheDir: t.TempDir(), Solvers: []Solver{NewHttp01Solver()}}, NewStore())
+
+	if err != nil {
+		t.Fatalf("NewAcmeManager() returned an unexpected error = %v", err)
+	}
+
+	manager.SetHosts([]string{"app.example.com"})
+	manager.renewDue(context.Background())
+
+	if due := manager.dueHosts(time.Now()); len(due) != 0 {
+		t.Errorf("Expected a failed host to wait before it is retried, got %v", due)
+	}
+
+	if due := manager.dueHosts(time.Now().Add(acmeMinBackoff + time.Second)); len(due) != 1 {
+		t.Errorf("Expected a failed host to be retried after %v, got %v", acmeMinBackoff, due)
+	}
+}
+
+func TestAcmeManager_SetHosts_RemovesDroppedHosts(t *testing.T) {
+	store := NewStore()
+	manager, err := NewAcmeManager(Acme{CacheDir: t.TempDir()}, store)
+
+	if err != nil {
+		t.Fatalf("NewAcmeManager() returned an unexpected error = %v", err)
+	}
+
+	manager.SetHosts([]string{"app1.example.com", "app2.example.com"})
+	store.Put("app1.example.com", &tls.Certificate{})
+	store.Put("app2.example.com", &tls.Certificate{})
+
+	manager.SetHosts([]string{"app2.example.com"})
+
+	if store.Has("app1.example.com") || !store.Has("app2.example.com") {
+		t.Errorf("Expected only the dropped host's certificate to be removed")
+	}
+}
+
+func TestNewAcmeManager_ReusesAccountKey(t *testing.T) {
+	cacheDir := t.TempDir()
+	first, _ := NewAcmeManager(Acme{CacheDir: cacheDir}, NewStore())
+	second, err := NewAcmeManager(Acme{CacheDir: cacheDir}, NewStore())
+
+	if err != nil {
+		t.Fatalf("NewAcmeManager() returned an unexpected error = %v", err)
+	}
+
+	if !first.client.Key.Public().(*ecdsa.PublicKey).Equal(second.client.Key.Public()) {
+		t.Errorf("Expected the account key to be loaded from the cache")
+	}
+
+	if _, err = os.Stat(cacheDir + "/account.key"); err != nil {
+		t.Errorf("Expected the account key to be written to the cache: %v", err)
+	}
+}
+
+func TestHttp01Solver_Handler(t *testing.T) {
+	client := &acme.Client{Key: mustKey(t)}
+	solver := NewHttp01Solver()
+	challenge := &acme.Challenge{Type: "http-01", Token: "token"}
+	handler := solver.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	if err := solver.Present(context.Background(), client, "app.example.com", challenge); err != nil {
+		t.Fatalf("Present() returned an unexpected error = %v", err)
+	}
+
+	expected, _ := client.HTTP01ChallengeResponse("token")
+
+	scenarios := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"Pending Challenge", "/.well-known/acme-challenge/token", http.StatusOK, expected},
+		{"Unknown Token", "/.well-known/acme-challenge/other", http.StatusTeapot, ""},
+		{"Other Path", "/", http.StatusTeapot, ""},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://app.example.com"+scenario.path, nil))
+
+			if recorder.Code != scenario.expectedStatus || recorder.Body.String() != scenario.expectedBody {
+				t.Errorf("Expected %v %q, got %v %q", scenario.expectedStatus, scenario.expectedBody, recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+
+	_ = solver.CleanUp(context.Background(), client, "app.example.com", challenge)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/.well-known/acme-challenge/token", nil))
+
+	if recorder.Code != http.StatusTeapot {
+		t.Errorf("Expected the challenge to be gone after CleanUp, got %v", recorder.Code)
+	}
+}
+
+// fakeCa is just enough of an RFC 8555 CA for one order with one http-01 authorization. It validates the challenge
+// by asking challenges for the key authorization, the way a real CA would over port 80.
+type fakeCa struct {
+	*httptest.Server
+	challenges       http.Handler
+	keyAuthorization func(token string) string
+	key              *ecdsa.PrivateKey
+	root             *x509.Certificate
+	authzStatus      string
+	orderStatus      string
+	issued           []byte
+}
+
+func newFakeCa(t *testing.T, challenges http.Handler) *fakeCa {
+	key := mustKey(t)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Fake CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	root, _ := x509.ParseCertificate(der)
+
+	ca := &fakeCa{challenges: challenges, key: key, root: root, authzStatus: acme.StatusPending, orderStatus: acme.StatusPending}
+	ca.Server = httptest.NewServer(http.HandlerFunc(ca.serve))
+	t.Cleanup(ca.Close)
+
+	return ca
+}
+
+func (ca *fakeCa) serve(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", time.Now().UnixNano()))
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.URL.Path {
+	case "/directory":
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"newNonce":   ca.URL + "/nonce",
+			"newAccount": ca.URL + "/account",
+			"newOrder":   ca.URL + "/order",
+			"revokeCert": ca.URL + "/revoke",
+			"keyChange":  ca.URL + "/key-change",
+		})
+	case "/nonce":
+		w.WriteHeader(http.StatusOK)
+	case "/account":
+		w.Header().Set("Location", ca.URL+"/account/1")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"status":"valid"}`))
+	case "/order":
+		w.Header().Set("Location", ca.URL+"/order/1")
+		w.WriteHeader(http.StatusCreated)
+		ca.writeOrder(w)
+	case "/order/1":
+		w.Header().Set("Location", ca.URL+"/order/1")
+		ca.writeOrder(w)
+	case "/authz/1":
+		ca.writeAuthz(w)
+	case "/challenge/1":
+		recorder := httptest.NewRecorder()
+		ca.challenges.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://app.example.com/.well-known/acme-challenge/token", nil))
+
+		if recorder.Body.String() == ca.keyAuthorization("token") {
+			ca.authzStatus, ca.orderStatus = acme.StatusValid, acme.StatusReady
+		} else {
+			ca.authzStatus = acme.StatusInvalid
+		}
+
+		_, _ = fmt.Fprintf(w, `{"type":"http-01","url":"%s/challenge/1","token":"token","status":"processing"}`, ca.URL)
+	case "/finalize/1":
+		ca.issue(w, r)
+	case "/certificate/1":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		_, _ = w.Write(ca.issued)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (ca *fakeCa) writeOrder(w http.ResponseWriter) {
+	order := map[string]any{
+		"status":         ca.orderStatus,
+		"identifiers":    []map[string]string{{"type": "dns", "value": "app.example.com"}},
+		"authorizations": []string{ca.URL + "/authz/1"},
+		"finalize":       ca.URL + "/finalize/1",
+	}
+
+	if ca.orderStatus == acme.StatusValid {
+		order["certificate"] = ca.URL + "/certificate/1"
+	}
+
+	_ = json.NewEncoder(w).Encode(order)
+}
+
+func (ca *fakeCa) writeAuthz(w http.ResponseWriter) {
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"status":     ca.authzStatus,
+		"identifier": map[string]string{"type": "dns", "value": "app.example.com"},
+		"challenges": []map[string]string{{"type": "http-01", "url": ca.URL + "/challenge/1", "token": "token", "status": ca.authzStatus}},
+	})
+}
+
+// issue signs the CSR in a finalize request with the CA's key.
+func (ca *fakeCa) issue(w http.ResponseWriter, r *http.Request) {
+	var jws struct{ Payload string }
+	var finalize struct{ Csr string }
+
+	_ = json.NewDecoder(r.Body).Decode(&jws)
+	payload, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+	_ = json.Unmarshal(payload, &finalize)
+	csrDer, _ := base64.RawURLEncoding.DecodeString(finalize.Csr)
+	csr, err := x509.ParseCertificateRequest(csrDer)
+
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"type":"urn:ietf:params:acme:error:badCSR"}`))
+		return
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: csr.DNSNames[0]},
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, ca.root, csr.PublicKey, ca.key)
+	ca.issued = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.root.Raw})...)
+	ca.orderStatus = acme.StatusValid
+
+	w.Header().Set("Location", ca.URL+"/order/1")
+	ca.writeOrder(w)
+}
+
+func mustKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+
+	return key
+}
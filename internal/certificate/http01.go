@@ -0,0 +1,64 @@
+package certificate
+
+import (
+	"context"
+	"golang.org/x/crypto/acme"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Http01Solver answers http-01 challenges. Its Handler has to be in front of whatever serves plain HTTP on port 80
+// of every managed host.
+type Http01Solver struct {
+	mutex     sync.RWMutex
+	responses map[string]string
+}
+
+func NewHttp01Solver() *Http01Solver {
+	return &Http01Solver{responses: map[string]string{}}
+}
+
+func (solver *Http01Solver) Type() string {
+	return "http-01"
+}
+
+func (solver *Http01Solver) Present(_ context.Context, client *acme.Client, _ string, challenge *acme.Challenge) error {
+	response, err := client.HTTP01ChallengeResponse(challenge.Token)
+
+	if err != nil {
+		return err
+	}
+
+	solver.mutex.Lock()
+	defer solver.mutex.Unlock()
+	solver.responses[client.HTTP01ChallengePath(challenge.Token)] = response
+
+	return nil
+}
+
+func (solver *Http01Solver) CleanUp(_ context.Context, client *acme.Client, _ string, challenge *acme.Challenge) error {
+	solver.mutex.Lock()
+	defer solver.mutex.Unlock()
+	delete(solver.responses, client.HTTP01ChallengePath(challenge.Token))
+
+	return nil
+}
+
+// Handler answers requests for pending challenges and passes every other request, including ones for other paths
+// under /.well-known/acme-challenge/, to next.
+func (solver *Http01Solver) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		solver.mutex.RLock()
+		response, found := solver.responses[r.URL.Path]
+		solver.mutex.RUnlock()
+
+		if !found {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = io.WriteString(w, response)
+	})
+}
@@ -0,0 +1,202 @@
+package certificate
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrUnknownServerName = errors.New("no certificate for server name")
+
+// Files names the PEM encoded certificate chain and private key of a host.
+type Files struct {
+	CertFile string
+	KeyFile  string
+}
+
+type entry struct {
+	files       Files
+	modified    time.Time
+	certificate *tls.Certificate
+}
+
+// Store holds a certificate per host and hands the right one to each TLS handshake by its SNI server name. Certificates
+// are either loaded from files, by Set, or handed over in memory, by Put. Entries are never changed in place: every
+// change builds a new map and swaps it in, so handshakes never wait on a reload.
+type Store struct {
+	entries atomic.Pointer[map[string]*entry]
+	mutex   sync.Mutex
+}
+
+func NewStore() *Store {
+	store := &Store{}
+	store.entries.Store(&map[string]*entry{})
+
+	return store
+}
+
+// Set replaces the store's file backed certificates with files, loading every certificate that is new or has changed
+// on disk. Certificates handed over by Put are kept unless files has one for the same host. If any of them fails to
+// load, the store is left as it was and the errors are returned.
+func (store *Store) Set(files map[string]Files) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	current := *store.entries.Load()
+	next := make(map[string]*entry, len(files))
+	var loadErrors []error
+
+	for host, existing := range current {
+		if existing.files == (Files{}) {
+			next[host] = existing
+		}
+	}
+
+	for host, hostFiles := range files {
+		host = strings.ToLower(host)
+
+		if existing := current[host]; existing != nil && existing.files == hostFiles && existing.modified.Equal(modTime(hostFiles)) {
+			next[host] = existing
+			continue
+		}
+
+		loaded, err := load(hostFiles)
+
+		if err != nil {
+			loadErrors = append(loadErrors, fmt.Errorf("certificate for %s: %w", host, err))
+			continue
+		}
+
+		next[host] = loaded
+	}
+
+	if len(loadErrors) > 0 {
+		return errors.Join(loadErrors...)
+	}
+
+	store.entries.Store(&next)
+
+	return nil
+}
+
+// Reload re-reads every certificate whose files have changed on disk since they were loaded. A certificate that fails
+// to load keeps being served in its previous version, and isn't tried again until its files change once more, so a
+// renewal written in two steps is picked up after the second.
+func (store *Store) Reload() error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	current := *store.entries.Load()
+	next := make(map[string]*entry, len(current))
+	var loadErrors []error
+	changed := false
+
+	for host, existing := range current {
+		next[host] = existing
+
+		if existing.files == (Files{}) {
+			continue
+		}
+
+		modified := modTime(existing.files)
+
+		if modified.Equal(existing.modified) {
+			continue
+		}
+
+		changed = true
+		loaded, err := load(existing.files)
+
+		if err != nil {
+			loadErrors = append(loadErrors, fmt.Errorf("certificate for %s: %w", host, err))
+			next[host] = &entry{existing.files, modified, existing.certificate}
+			continue
+		}
+
+		next[host] = loaded
+	}
+
+	if changed {
+		store.entries.Store(&next)
+	}
+
+	return errors.Join(loadErrors...)
+}
+
+// Put serves certificate for host, replacing whatever was served for it before.
+func (store *Store) Put(host string, certificate *tls.Certificate) {
+	store.update(func(entries map[string]*entry) {
+		entries[strings.ToLower(host)] = &entry{certificate: certificate}
+	})
+}
+
+// Remove stops serving the certificate handed over by Put for host. A certificate loaded from files is left alone.
+func (store *Store) Remove(host string) {
+	store.update(func(entries map[string]*entry) {
+		if existing := entries[strings.ToLower(host)]; existing != nil && existing.files == (Files{}) {
+			delete(entries, strings.ToLower(host))
+		}
+	})
+}
+
+func (store *Store) update(change func(entries map[string]*entry)) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	next := maps.Clone(*store.entries.Load())
+	change(next)
+	store.entries.Store(&next)
+}
+
+// Has reports whether the store has a certificate for host.
+func (store *Store) Has(host string) bool {
+	_, found := (*store.entries.Load())[strings.ToLower(host)]
+
+	return found
+}
+
+// GetCertificate returns the certificate for the server name the client asked for, for use as
+// tls.Config.GetCertificate.
+func (store *Store) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	serverName := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+
+	if found := (*store.entries.Load())[serverName]; found != nil {
+		return found.certificate, nil
+	}
+
+	return nil, fmt.Errorf("%w %q", ErrUnknownServerName, serverName)
+}
+
+func load(files Files) (*entry, error) {
+	// Taken before reading, so a file replaced while it is read is read again on the next reload.
+	modified := modTime(files)
+	certificate, err := tls.LoadX509KeyPair(files.CertFile, files.KeyFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &entry{files, modified, &certificate}, nil
+}
+
+// modTime is the later of the modification times of the certificate and key files, or zero if either is missing.
+func modTime(files Files) time.Time {
+	certInfo, certErr := os.Stat(files.CertFile)
+	keyInfo, keyErr := os.Stat(files.KeyFile)
+
+	if certErr != nil || keyErr != nil {
+		return time.Time{}
+	}
+
+	if keyInfo.ModTime().After(certInfo.ModTime()) {
+		return keyInfo.ModTime()
+	}
+
+	return certInfo.ModTime()
+}
@@ -0,0 +1,174 @@
+package certificate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStore_GetCertificate(t *testing.T) {
+	store := NewStore()
+
+	err := store.Set(map[string]Files{
+		"app1.example.com": writeCertificate(t, t.TempDir(), "app1.example.com"),
+		"App2.example.com": writeCertificate(t, t.TempDir(), "app2.example.com"),
+	})
+
+	if err != nil {
+		t.Fatalf("Set() returned an unexpected error = %v", err)
+	}
+
+	scenarios := []struct {
+		name               string
+		serverName         string
+		expectedCommonName string
+		expectedError      error
+	}{
+		{"Exact Match", "app1.example.com", "app1.example.com", nil},
+		{"Case Insensitive", "APP2.example.com", "app2.example.com", nil},
+		{"Trailing Dot", "app1.example.com.", "app1.example.com", nil},
+		{"Unknown Server Name", "app3.example.com", "", ErrUnknownServerName},
+		{"No Server Name", "", "", ErrUnknownServerName},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			certificate, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: scenario.serverName})
+
+			if !errors.Is(err, scenario.expectedError) {
+				t.Fatalf("GetCertificate() error = %v, expected %v", err, scenario.expectedError)
+			}
+
+			if err == nil && commonName(t, certificate) != scenario.expectedCommonName {
+				t.Errorf("Expected certificate for %v, got %v", scenario.expectedCommonName, commonName(t, certificate))
+			}
+		})
+	}
+}
+
+func TestStore_Set_KeepsCertificatesOnError(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore()
+	files := writeCertificate(t, dir, "app1.example.com")
+
+	if err := store.Set(map[string]Files{"app1.example.com": files}); err != nil {
+		t.Fatalf("Set() returned an unexpected error = %v", err)
+	}
+
+	err := store.Set(map[string]Files{
+		"app1.example.com": files,
+		"app2.example.com": {CertFile: filepath.Join(dir, "missing.pem"), KeyFile: filepath.Join(dir, "missing.key")},
+	})
+
+	if err == nil {
+		t.Fatalf("Expected Set() to fail for a missing certificate")
+	}
+
+	if !store.Has("app1.example.com") || store.Has("app2.example.com") {
+		t.Errorf("Expected a failed Set() to leave the store unchanged")
+	}
+}
+
+func TestStore_Reload(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore()
+	files := writeCertificate(t, dir, "first.example.com")
+
+	if err := store.Set(map[string]Files{"app.example.com": files}); err != nil {
+		t.Fatalf("Set() returned an unexpected error = %v", err)
+	}
+
+	hello := &tls.ClientHelloInfo{ServerName: "app.example.com"}
+
+	// A broken file is reported, and the previous certificate is kept.
+	_ = os.WriteFile(files.CertFile, []byte("not a certificate"), 0o600)
+	touch(t, files, time.Now().Add(time.Minute))
+
+	if err := store.Reload(); err == nil {
+		t.Errorf("Expected Reload() to report the broken certificate")
+	}
+
+	if certificate, _ := store.GetCertificate(hello); commonName(t, certificate) != "first.example.com" {
+		t.Errorf("Expected the previous certificate to be kept, got %v", commonName(t, certificate))
+	}
+
+	writeCertificate(t, dir, "second.example.com")
+	touch(t, files, time.Now().Add(2*time.Minute))
+
+	if err := store.Reload(); err != nil {
+		t.Fatalf("Reload() returned an unexpected error = %v", err)
+	}
+
+	if certificate, _ := store.GetCertificate(hello); commonName(t, certificate) != "second.example.com" {
+		t.Errorf("Expected the renewed certificate, got %v", commonName(t, certificate))
+	}
+}
+
+// writeCertificate writes a self-signed certificate for commonName and its key to dir, replacing any written before.
+func writeCertificate(t *testing.T, dir string, commonName string) Files {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatalf("Error creating certificate: %v", err)
+	}
+
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	files := Files{CertFile: filepath.Join(dir, "cert.pem"), KeyFile: filepath.Join(dir, "key.pem")}
+	_ = os.WriteFile(files.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	_ = os.WriteFile(files.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600)
+
+	return files
+}
+
+// touch sets the modification time of both files, since a rewrite within the file system's timestamp resolution
+// might not change it.
+func touch(t *testing.T, files Files, modified time.Time) {
+	t.Helper()
+
+	for _, path := range []string{files.CertFile, files.KeyFile} {
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatalf("Error touching %v: %v", path, err)
+		}
+	}
+}
+
+func commonName(t *testing.T, certificate *tls.Certificate) string {
+	t.Helper()
+
+	if certificate == nil {
+		return ""
+	}
+
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+
+	if err != nil {
+		t.Fatalf("Error parsing certificate: %v", err)
+	}
+
+	return leaf.Subject.CommonName
+}
@@ -1,27 +1,196 @@
 package config
 
 import (
+	"bytes"
+	"errors"
 	"gopkg.in/yaml.v3"
+	"io"
 	"os"
+	"regexp"
 )
 
+// unknownFieldPattern matches the error yaml reports for a key that isn't part of the config.
+var unknownFieldPattern = regexp.MustCompile(`^(line \d+): field (\S+) not found in type \S+$`)
+
 type Config struct {
-	Apps []*ApplicationConfig `yaml:"apps"`
+	Admin     *AdminConfig         `yaml:"admin"`
+	AccessLog *AccessLogConfig     `yaml:"access_log"`
+	Tls       *TlsConfig           `yaml:"tls"`
+	Acme      *AcmeConfig          `yaml:"acme"`
+	Apps      []*ApplicationConfig `yaml:"apps"`
+}
+
+// AccessLogConfig configures the access log. Output is stdout (the default), stderr, off, or the path of a file that
+// is rotated once it reaches MaxSizeMb megabytes, keeping MaxBackups old files.
+type AccessLogConfig struct {
+	Format     string `yaml:"format"`
+	Output     string `yaml:"output"`
+	MaxSizeMb  int    `yaml:"max_size_mb"`
+	MaxBackups int    `yaml:"max_backups"`
+}
+
+// AdminConfig configures the listener for the report and instance management API. Address is host:port or
+// unix:/path/to/socket.
+type AdminConfig struct {
+	Address string `yaml:"address"`
+}
+
+// TlsConfig configures the HTTPS listener. Address is host:port, ":8443" by default. With RedirectHttp, requests on
+// the plain HTTP listener for a host that has a certificate are redirected to HTTPS instead of being proxied.
+type TlsConfig struct {
+	Address      string `yaml:"address"`
+	RedirectHttp bool   `yaml:"redirect_http"`
+}
+
+// AcmeConfig turns on certificates issued by an ACME CA for every app without a tls block of its own. The account
+// key and certificates are kept in CacheDir. AcceptTerms must be set to agree to the CA's terms of service.
+type AcmeConfig struct {
+	Email        string `yaml:"email"`
+	DirectoryUrl string `yaml:"directory_url"`
+	CacheDir     string `yaml:"cache_dir"`
+	RenewBefore  string `yaml:"renew_before"`
+	AcceptTerms  bool   `yaml:"accept_terms"`
 }
 
 type ApplicationConfig struct {
-	Host                string            `yaml:"host"`
-	Instances           []*InstanceConfig `yaml:"instances"`
-	HealthUri           string            `yaml:"health_uri"`
-	Timeout             string            `yaml:"timeout"`
-	HealthCheckCooldown string            `yaml:"health_check_cooldown"`
-	Strategy            string            `yaml:"strategy"`
+	Host                string                  `yaml:"host"`
+	Instances           []*InstanceConfig       `yaml:"instances"`
+	HealthUri           string                  `yaml:"health_uri"`
+	Timeout             string                  `yaml:"timeout"`
+	HealthCheckCooldown string                  `yaml:"health_check_cooldown"`
+	Strategy            string                  `yaml:"strategy"`
+	ConsistentHash      *ConsistentHashConfig   `yaml:"consistent_hash"`
+	StickySession       *StickySessionConfig    `yaml:"sticky_session"`
+	OutlierDetection    *OutlierDetectionConfig `yaml:"outlier_detection"`
+	CircuitBreaker      *CircuitBreakerConfig   `yaml:"circuit_breaker"`
+	HealthCheck         *HealthCheckConfig      `yaml:"health_check"`
+	Retry               *RetryConfig            `yaml:"retry"`
+	Tls                 *AppTlsConfig           `yaml:"tls"`
+	UpstreamTls         *UpstreamTlsConfig      `yaml:"upstream_tls"`
+	ClientAuth          *ClientAuthConfig       `yaml:"client_auth"`
+	Transport           *TransportConfig        `yaml:"transport"`
+	RequestTimeout      *RequestTimeoutConfig   `yaml:"request_timeout"`
+}
+
+// RequestTimeoutConfig limits how long a proxied request may take, retries included. Timeout applies to every path
+// of the app unless the route with the longest matching PathPrefix sets its own; a timeout of 0 means no limit. With
+// DeadlineHeader set, backends are told the time left in that header.
+type RequestTimeoutConfig struct {
+	Timeout        string                `yaml:"timeout"`
+	Routes         []*RouteTimeoutConfig `yaml:"routes"`
+	DeadlineHeader string                `yaml:"deadline_header"`
+}
+
+type RouteTimeoutConfig struct {
+	PathPrefix string `yaml:"path_prefix"`
+	Timeout    string `yaml:"timeout"`
+}
+
+// TransportConfig tunes the connections to an app's instances, which its proxied requests and health checks share.
+// Limits apply to each instance separately.
+type TransportConfig struct {
+	MaxIdleConnsPerHost   int    `yaml:"max_idle_conns_per_host"`
+	MaxConnsPerHost       int    `yaml:"max_conns_per_host"`
+	IdleConnTimeout       string `yaml:"idle_conn_timeout"`
+	DialTimeout           string `yaml:"dial_timeout"`
+	TlsHandshakeTimeout   string `yaml:"tls_handshake_timeout"`
+	ResponseHeaderTimeout string `yaml:"response_header_timeout"`
+}
+
+// UpstreamTlsConfig configures TLS to an app's https:// instances, for proxied requests and health checks alike.
+// CaFile replaces the system roots, and CertFile and KeyFile are presented when an instance asks for a client
+// certificate.
+type UpstreamTlsConfig struct {
+	CaFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	ServerName         string `yaml:"server_name"`
+	MinVersion         string `yaml:"min_version"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// AppTlsConfig names the PEM files of the certificate served for an app's host over HTTPS.
+type AppTlsConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// Client certificate modes of ClientAuthConfig.
+const (
+	ClientAuthRequire  = "require"
+	ClientAuthOptional = "optional"
+)
+
+// ClientAuthConfig asks clients of an app's host for a certificate issued by a CA in CaFile when they connect over
+// HTTPS. With Mode ClientAuthRequire, the default, connections without one are refused; with ClientAuthOptional they
+// are let through without the headers. A verified certificate's subject and SHA-256 fingerprint are forwarded to
+// backends in SubjectHeader and FingerprintHeader.
+type ClientAuthConfig struct {
+	CaFile            string `yaml:"ca_file"`
+	Mode              string `yaml:"mode"`
+	SubjectHeader     string `yaml:"subject_header"`
+	FingerprintHeader string `yaml:"fingerprint_header"`
+}
+
+// RetryConfig controls retrying requests on another backend when the transport fails before a response arrives.
+// Without it, idempotent requests are retried once.
+type RetryConfig struct {
+	MaxRetries   int      `yaml:"max_retries"`
+	Budget       string   `yaml:"budget"`
+	MaxBodyBytes int64    `yaml:"max_body_bytes"`
+	Methods      []string `yaml:"methods"`
+}
+
+type HealthCheckConfig struct {
+	Type               string            `yaml:"type"`
+	GrpcService        string            `yaml:"grpc_service"`
+	Method             string            `yaml:"method"`
+	Headers            map[string]string `yaml:"headers"`
+	ExpectedStatus     []string          `yaml:"expected_status"`
+	Timeout            string            `yaml:"timeout"`
+	BodyContains       string            `yaml:"body_contains"`
+	BodyRegex          string            `yaml:"body_regex"`
+	HealthyThreshold   int               `yaml:"healthy_threshold"`
+	UnhealthyThreshold int               `yaml:"unhealthy_threshold"`
+	InitialState       string            `yaml:"initial_state"`
+	Jitter             string            `yaml:"jitter"`
+}
+
+type ConsistentHashConfig struct {
+	Key          string `yaml:"key"`
+	Name         string `yaml:"name"`
+	Segment      int    `yaml:"segment"`
+	VirtualNodes int    `yaml:"virtual_nodes"`
+}
+
+type StickySessionConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	CookieName string `yaml:"cookie_name"`
+	Secret     string `yaml:"secret"`
+	MaxAge     string `yaml:"max_age"`
+}
+
+type OutlierDetectionConfig struct {
+	ConsecutiveFailures int    `yaml:"consecutive_failures"`
+	BaseEjectionTime    string `yaml:"base_ejection_time"`
+	MaxEjectionTime     string `yaml:"max_ejection_time"`
+}
+
+type CircuitBreakerConfig struct {
+	ErrorRate        float64 `yaml:"error_rate"`
+	MinRequests      int     `yaml:"min_requests"`
+	Window           string  `yaml:"window"`
+	CoolOff          string  `yaml:"cool_off"`
+	HalfOpenRequests int     `yaml:"half_open_requests"`
 }
 
 type InstanceConfig struct {
-	Url string `yaml:"url"`
+	Url    string `yaml:"url"`
+	Weight int    `yaml:"weight"`
 }
 
+// LoadConfig reads the config at path, expands environment variables in it and validates it. Unset variables and
+// unknown keys are reported along with everything Validate finds, in a single *ValidationError.
 func LoadConfig(path string) (*Config, error) {
 	config := &Config{}
 	file, err := os.ReadFile(path)
@@ -30,9 +199,24 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
-	err = yaml.Unmarshal(file, config)
+	file, problems := expandEnv(file)
+	decoder := yaml.NewDecoder(bytes.NewReader(file))
+	decoder.KnownFields(true)
 
-	if err != nil {
+	v := &validator{problems: problems}
+	var typeErr *yaml.TypeError
+
+	if err = decoder.Decode(config); errors.As(err, &typeErr) {
+		for _, problem := range typeErr.Errors {
+			v.problems = append(v.problems, errors.New(unknownFieldPattern.ReplaceAllString(problem, "$1: unknown field $2")))
+		}
+	} else if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	config.validate(v)
+
+	if err = v.err(); err != nil {
 		return nil, err
 	}
 
@@ -11,35 +11,134 @@ func TestLoadConfig(t *testing.T) {
 		errorReadingFile bool
 		errorReadingYaml bool
 		expectedConfig   *Config
+		contents         string
 	}{
-		{true, false, nil},
-		{false, true, nil},
+		{true, false, nil, ""},
+		{false, true, nil, ""},
 		{false, false, &Config{
 			Apps: []*ApplicationConfig{
 				{
-					"http://app1-host.com",
-					[]*InstanceConfig{
-						{"http://localhost:8080"},
-						{"http://localhost:8081"},
+					Host: "app1-host.com",
+					Instances: []*InstanceConfig{
+						{Url: "http://localhost:8080"},
+						{Url: "http://localhost:8081"},
 					},
-					"/health",
-					"10s",
-					"60s",
-					"least_connections",
+					HealthUri:           "/health",
+					Timeout:             "10s",
+					HealthCheckCooldown: "60s",
+					Strategy:            "least_connections",
 				},
 				{
-					"http://app2-host.com",
-					[]*InstanceConfig{
-						{"http://localhost:9090"},
-						{"http://localhost:9091"},
+					Host: "app2-host.com",
+					Instances: []*InstanceConfig{
+						{Url: "http://localhost:9090"},
+						{Url: "http://localhost:9091"},
 					},
-					"/api/v2/health",
-					"5s",
-					"45s",
-					"",
+					HealthUri:           "/api/v2/health",
+					Timeout:             "5s",
+					HealthCheckCooldown: "45s",
+					Strategy:            "",
 				},
 			},
-		}},
+		}, `
+apps:
+  - host: app1-host.com
+    health_uri: /health
+    timeout: 10s
+    health_check_cooldown: 60s
+    instances:
+      - url: http://localhost:8080
+      - url: http://localhost:8081
+    strategy: least_connections
+  - host: app2-host.com
+    health_uri: /api/v2/health
+    timeout: 5s
+    health_check_cooldown: 45s
+    instances:
+      - url: http://localhost:9090
+      - url: http://localhost:9091`},
+		{false, false, &Config{
+			Apps: []*ApplicationConfig{
+				{
+					Host: "app1-host.com",
+					Instances: []*InstanceConfig{
+						{Url: "http://localhost:8080", Weight: 3},
+						{Url: "http://localhost:8081"},
+					},
+					HealthUri:           "/health",
+					Timeout:             "10s",
+					HealthCheckCooldown: "60s",
+					Strategy:            "weighted_round_robin",
+					StickySession:       &StickySessionConfig{Enabled: true, CookieName: "app1_backend", Secret: "s3cret", MaxAge: "1h"},
+					HealthCheck: &HealthCheckConfig{
+						Method:             "HEAD",
+						Headers:            map[string]string{"Host": "app1.internal"},
+						ExpectedStatus:     []string{"200", "300-399"},
+						Timeout:            "2s",
+						BodyContains:       `"status":"ok"`,
+						HealthyThreshold:   2,
+						UnhealthyThreshold: 3,
+						InitialState:       "unhealthy",
+						Jitter:             "5s",
+					},
+				},
+				{
+					Host: "app2-host.com",
+					Instances: []*InstanceConfig{
+						{Url: "http://localhost:9090"},
+						{Url: "http://localhost:9091"},
+					},
+					HealthUri:           "/api/v2/health",
+					Timeout:             "5s",
+					HealthCheckCooldown: "45s",
+					Strategy:            "consistent_hash",
+					ConsistentHash:      &ConsistentHashConfig{Key: "header", Name: "X-User-Id", VirtualNodes: 200},
+					OutlierDetection:    &OutlierDetectionConfig{ConsecutiveFailures: 3, BaseEjectionTime: "15s", MaxEjectionTime: "2m"},
+				},
+			},
+		}, `
+apps:
+  - host: app1-host.com
+    health_uri: /health
+    timeout: 10s
+    health_check_cooldown: 60s
+    instances:
+      - url: http://localhost:8080
+        weight: 3
+      - url: http://localhost:8081
+    strategy: weighted_round_robin
+    sticky_session:
+      enabled: true
+      cookie_name: app1_backend
+      secret: s3cret
+      max_age: 1h
+    health_check:
+      method: HEAD
+      headers:
+        Host: app1.internal
+      expected_status: [200, "300-399"]
+      timeout: 2s
+      body_contains: '"status":"ok"'
+      healthy_threshold: 2
+      unhealthy_threshold: 3
+      initial_state: unhealthy
+      jitter: 5s
+  - host: app2-host.com
+    health_uri: /api/v2/health
+    timeout: 5s
+    health_check_cooldown: 45s
+    instances:
+      - url: http://localhost:9090
+      - url: http://localhost:9091
+    strategy: consistent_hash
+    consistent_hash:
+      key: header
+      name: X-User-Id
+      virtual_nodes: 200
+    outlier_detection:
+      consecutive_failures: 3
+      base_ejection_time: 15s
+      max_ejection_time: 2m`},
 	}
 
 	for _, scenario := range scenarios {
@@ -62,23 +161,7 @@ func TestLoadConfig(t *testing.T) {
 			if scenario.errorReadingYaml {
 				temp.WriteString("invalid yaml")
 			} else {
-				temp.WriteString(`
-apps:
-  - host: http://app1-host.com
-    health_uri: /health
-    timeout: 10s
-    health_check_cooldown: 60s
-    instances:
-      - url: http://localhost:8080
-      - url: http://localhost:8081
-    strategy: least_connections
-  - host: http://app2-host.com
-    health_uri: /api/v2/health
-    timeout: 5s
-    health_check_cooldown: 45s
-    instances:
-      - url: http://localhost:9090
-      - url: http://localhost:9091`)
+				temp.WriteString(scenario.contents)
 			}
 		}
 
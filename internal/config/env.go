@@ -0,0 +1,39 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// envVariablePattern matches ${NAME} and ${NAME:-default}, and $${ so a literal ${ can be written.
+var envVariablePattern = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv replaces ${NAME} in the config with the value of the NAME environment variable, or with the default in
+// ${NAME:-default} when NAME is unset or empty. Bare $NAME is left alone, since a dollar sign is common in secrets
+// and regexes. It returns a problem for every variable that is unset and has no default.
+func expandEnv(file []byte) ([]byte, []error) {
+	var problems []error
+
+	expanded := envVariablePattern.ReplaceAllFunc(file, func(match []byte) []byte {
+		if string(match) == "$${" {
+			return []byte("${")
+		}
+
+		groups := envVariablePattern.FindSubmatch(match)
+		name, hasDefault, fallback := string(groups[1]), len(groups[2]) > 0, groups[3]
+
+		value, set := os.LookupEnv(name)
+
+		switch {
+		case set && (value != "" || !hasDefault):
+			return []byte(value)
+		case !hasDefault:
+			problems = append(problems, fmt.Errorf("${%s}: environment variable is not set", name))
+		}
+
+		return fallback
+	})
+
+	return expanded, problems
+}
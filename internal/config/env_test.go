@@ -0,0 +1,43 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("LB_TEST_HOST", "api.example.com")
+	t.Setenv("LB_TEST_EMPTY", "")
+
+	scenarios := []struct {
+		name             string
+		raw              string
+		expected         string
+		expectedProblems int
+	}{
+		{"No Variables", "host: api.example.com", "host: api.example.com", 0},
+		{"Set Variable", "host: ${LB_TEST_HOST}", "host: api.example.com", 0},
+		{"Several Variables", "${LB_TEST_HOST}/${LB_TEST_HOST}", "api.example.com/api.example.com", 0},
+		{"Unset Variable", "host: ${LB_TEST_UNSET}", "host: ", 1},
+		{"Unset Variable With Default", "timeout: ${LB_TEST_UNSET:-5s}", "timeout: 5s", 0},
+		{"Set Variable With Default", "host: ${LB_TEST_HOST:-localhost}", "host: api.example.com", 0},
+		{"Empty Variable", "secret: '${LB_TEST_EMPTY}'", "secret: ''", 0},
+		{"Empty Variable With Default", "secret: ${LB_TEST_EMPTY:-s3cret}", "secret: s3cret", 0},
+		{"Empty Default", "secret: '${LB_TEST_UNSET:-}'", "secret: ''", 0},
+		{"Bare Dollar Sign", "secret: pa$LB_TEST_HOST", "secret: pa$LB_TEST_HOST", 0},
+		{"Escaped", "body_regex: '$${LB_TEST_HOST}'", "body_regex: '${LB_TEST_HOST}'", 0},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			expanded, problems := expandEnv([]byte(scenario.raw))
+
+			if string(expanded) != scenario.expected {
+				t.Errorf("expandEnv(%q) = %q, expected %q", scenario.raw, expanded, scenario.expected)
+			}
+
+			if len(problems) != scenario.expectedProblems {
+				t.Errorf("expandEnv(%q) reported %v problems, expected %v: %v", scenario.raw, len(problems), scenario.expectedProblems, problems)
+			}
+		})
+	}
+}
@@ -0,0 +1,507 @@
+package config
+
+import (
+	"fmt"
+	"load-balancer/internal/accesslog"
+	"load-balancer/internal/backend"
+	"load-balancer/internal/balancer"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// FieldError is a problem with one field of the config, such as apps[1].instances[0].url.
+type FieldError struct {
+	Path string
+	Err  error
+}
+
+func (fe *FieldError) Error() string {
+	return fe.Path + ": " + fe.Err.Error()
+}
+
+func (fe *FieldError) Unwrap() error {
+	return fe.Err
+}
+
+// ValidationError lists every problem found in a config. errors.Is and errors.As look through each of them.
+type ValidationError struct {
+	Problems []error
+}
+
+func (ve *ValidationError) Error() string {
+	messages := make([]string, len(ve.Problems))
+
+	for i, problem := range ve.Problems {
+		messages[i] = problem.Error()
+	}
+
+	return "invalid config:\n  " + strings.Join(messages, "\n  ")
+}
+
+func (ve *ValidationError) Unwrap() []error {
+	return ve.Problems
+}
+
+// validator collects problems so that a config with several mistakes reports all of them at once.
+type validator struct {
+	problems []error
+}
+
+func (v *validator) add(path string, err error) {
+	v.problems = append(v.problems, &FieldError{path, err})
+}
+
+func (v *validator) addf(path string, format string, args ...any) {
+	v.add(path, fmt.Errorf(format, args...))
+}
+
+func (v *validator) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+
+	return &ValidationError{v.problems}
+}
+
+// Validate checks the config for everything that would stop the load balancer from building it, or that it would
+// otherwise quietly ignore, returning a *ValidationError listing every problem found.
+func (config *Config) Validate() error {
+	v := &validator{}
+	config.validate(v)
+
+	return v.err()
+}
+
+func (config *Config) validate(v *validator) {
+	if config.Admin != nil {
+		config.Admin.validate(v, "admin")
+	}
+
+	if config.AccessLog != nil {
+		config.AccessLog.validate(v, "access_log")
+	}
+
+	if config.Tls != nil {
+		validateAddress(v, "tls.address", config.Tls.Address, false)
+	}
+
+	if config.Acme != nil {
+		config.Acme.validate(v, "acme")
+	}
+
+	hosts := map[string]int{}
+
+	for i, app := range config.Apps {
+		path := fmt.Sprintf("apps[%d]", i)
+
+		if app == nil {
+			v.addf(path, "empty app")
+			continue
+		}
+
+		if first, seen := hosts[app.Host]; seen && app.Host != "" {
+			v.addf(path+".host", "duplicate host %q, also used by apps[%d]", app.Host, first)
+		} else {
+			hosts[app.Host] = i
+		}
+
+		app.validate(v, path)
+
+		if app.ClientAuth != nil && app.Tls == nil && config.Acme == nil {
+			v.addf(path+".client_auth", "needs the app to be served over HTTPS, with a tls block or acme")
+		}
+	}
+}
+
+// validateAppHost checks that host is a bare host name. Requests are matched on their Host header with the port taken
+// off, so a host with a scheme, port or path would never be matched.
+func validateAppHost(v *validator, path string, host string) {
+	switch {
+	case host == "":
+		v.addf(path, "missing host")
+	case strings.Contains(host, "://"):
+		v.addf(path, "must be a host name without a scheme, got %q", host)
+	case strings.Contains(host, "/"):
+		v.addf(path, "must be a host name without a path, got %q", host)
+	default:
+		if _, _, err := net.SplitHostPort(host); err == nil {
+			v.addf(path, "must be a host name without a port, got %q", host)
+		}
+	}
+}
+
+func (admin *AdminConfig) validate(v *validator, path string) {
+	validateAddress(v, path+".address", admin.Address, true)
+}
+
+// validateAddress checks an optional listener address, which is host:port or, when allowUnix is set,
+// unix:/path/to/socket.
+func validateAddress(v *validator, path string, address string, allowUnix bool) {
+	if socketPath, isUnix := strings.CutPrefix(address, "unix:"); isUnix && allowUnix {
+		if socketPath == "" {
+			v.addf(path, "missing socket path")
+		}
+
+		return
+	}
+
+	if address == "" {
+		return
+	}
+
+	if _, _, err := net.SplitHostPort(address); err != nil && allowUnix {
+		v.addf(path, "must be host:port or unix:/path/to/socket, got %q", address)
+	} else if err != nil {
+		v.addf(path, "must be host:port, got %q", address)
+	}
+}
+
+func (acme *AcmeConfig) validate(v *validator, path string) {
+	if acme.CacheDir == "" {
+		v.addf(path+".cache_dir", "missing cache directory")
+	}
+
+	if !acme.AcceptTerms {
+		v.addf(path+".accept_terms", "must be true to agree to the CA's terms of service")
+	}
+
+	if acme.DirectoryUrl != "" {
+		if directoryUrl, err := url.Parse(acme.DirectoryUrl); err != nil || directoryUrl.Host == "" ||
+			directoryUrl.Scheme != "https" && directoryUrl.Scheme != "http" {
+			v.addf(path+".directory_url", "must be an http or https URL, got %q", acme.DirectoryUrl)
+		}
+	}
+
+	validateDuration(v, path+".renew_before", acme.RenewBefore, false)
+}
+
+func (accessLog *AccessLogConfig) validate(v *validator, path string) {
+	switch accessLog.Format {
+	case "", accesslog.FormatJson, accesslog.FormatLogfmt, accesslog.FormatCombined:
+	default:
+		v.addf(path+".format", "%w, got %q", accesslog.ErrInvalidFormat, accessLog.Format)
+	}
+
+	if accessLog.MaxSizeMb < 0 {
+		v.addf(path+".max_size_mb", "must not be negative")
+	}
+
+	if accessLog.MaxBackups < 0 {
+		v.addf(path+".max_backups", "must not be negative")
+	}
+}
+
+func (app *ApplicationConfig) validate(v *validator, path string) {
+	validateAppHost(v, path+".host", app.Host)
+
+	if len(app.Instances) == 0 {
+		v.addf(path+".instances", "no instances")
+	}
+
+	for i, instance := range app.Instances {
+		instance.validate(v, fmt.Sprintf("%s.instances[%d]", path, i))
+	}
+
+	healthCheckType := ""
+
+	if app.HealthCheck != nil {
+		healthCheckType = app.HealthCheck.Type
+	}
+
+	if app.HealthUri == "" && (healthCheckType == "" || healthCheckType == backend.HealthCheckHttp) {
+		v.add(path+".health_uri", backend.ErrMissingHealthUri)
+	}
+
+	validateDuration(v, path+".timeout", app.Timeout, true)
+
+	if cooldown, ok := validateDuration(v, path+".health_check_cooldown", app.HealthCheckCooldown, true); ok && cooldown == 0 {
+		v.addf(path+".health_check_cooldown", "must be greater than zero")
+	}
+
+	switch app.Strategy {
+	case "", balancer.RoundRobinStrategy, balancer.WeightedRoundRobinStrategy, balancer.LeastConnectionsStrategy,
+		balancer.ConsistentHashStrategy, balancer.PowerOfTwoChoicesStrategy, balancer.LeastLatencyStrategy:
+	default:
+		v.addf(path+".strategy", "unknown strategy %q", app.Strategy)
+	}
+
+	if app.ConsistentHash != nil {
+		app.ConsistentHash.validate(v, path+".consistent_hash")
+	}
+
+	if app.StickySession != nil {
+		validateDuration(v, path+".sticky_session.max_age", app.StickySession.MaxAge, false)
+	}
+
+	if app.OutlierDetection != nil {
+		app.OutlierDetection.validate(v, path+".outlier_detection")
+	}
+
+	if app.CircuitBreaker != nil {
+		app.CircuitBreaker.validate(v, path+".circuit_breaker")
+	}
+
+	if app.Transport != nil {
+		app.Transport.validate(v, path+".transport")
+	}
+
+	if app.RequestTimeout != nil {
+		app.RequestTimeout.validate(v, path+".request_timeout")
+	}
+
+	if app.HealthCheck != nil {
+		app.HealthCheck.validate(v, path+".health_check")
+	}
+
+	if app.Retry != nil {
+		app.Retry.validate(v, path+".retry")
+	}
+
+	if app.ClientAuth != nil {
+		app.ClientAuth.validate(v, path+".client_auth")
+	}
+
+	if app.UpstreamTls != nil {
+		app.UpstreamTls.validate(v, path+".upstream_tls")
+	}
+
+	if app.Tls != nil {
+		if app.Tls.CertFile == "" {
+			v.addf(path+".tls.cert_file", "missing certificate file")
+		}
+
+		if app.Tls.KeyFile == "" {
+			v.addf(path+".tls.key_file", "missing key file")
+		}
+	}
+}
+
+func (retry *RetryConfig) validate(v *validator, path string) {
+	if retry.MaxRetries < 0 {
+		v.addf(path+".max_retries", "must not be negative")
+	}
+
+	if retry.MaxBodyBytes < 0 {
+		v.addf(path+".max_body_bytes", "must not be negative")
+	}
+
+	validateDuration(v, path+".budget", retry.Budget, false)
+
+	for i, method := range retry.Methods {
+		if method == "" || strings.ToUpper(method) != method {
+			v.addf(fmt.Sprintf("%s.methods[%d]", path, i), "must be an upper-case HTTP method, got %q", method)
+		}
+	}
+}
+
+func (instance *InstanceConfig) validate(v *validator, path string) {
+	if instance == nil {
+		v.addf(path, "empty instance")
+		return
+	}
+
+	instanceUrl, err := url.Parse(instance.Url)
+
+	switch {
+	case instance.Url == "":
+		v.addf(path+".url", "missing url")
+	case err != nil:
+		v.add(path+".url", backend.UrlParseError)
+	case instanceUrl.Scheme != "http" && instanceUrl.Scheme != "https":
+		v.add(path+".url", backend.ErrInvalidScheme)
+	case instanceUrl.Host == "":
+		v.add(path+".url", backend.ErrMissingHost)
+	}
+
+	if instance.Weight < 0 {
+		v.add(path+".weight", backend.ErrInvalidWeight)
+	}
+}
+
+func (hashConfig *ConsistentHashConfig) validate(v *validator, path string) {
+	switch hashConfig.Key {
+	case "", balancer.HashKeyClientIp:
+	case balancer.HashKeyHeader, balancer.HashKeyCookie:
+		if hashConfig.Name == "" {
+			v.add(path+".name", balancer.ErrMissingHashKeyName)
+		}
+	case balancer.HashKeyPathSegment:
+		if hashConfig.Segment < 0 {
+			v.addf(path+".segment", "must not be negative")
+		}
+	default:
+		v.addf(path+".key", "%w %q", balancer.ErrInvalidHashKey, hashConfig.Key)
+	}
+
+	if hashConfig.VirtualNodes < 0 {
+		v.addf(path+".virtual_nodes", "must not be negative")
+	}
+}
+
+func (outlierDetection *OutlierDetectionConfig) validate(v *validator, path string) {
+	if outlierDetection.ConsecutiveFailures < 0 {
+		v.addf(path+".consecutive_failures", "must not be negative")
+	}
+
+	validateDuration(v, path+".base_ejection_time", outlierDetection.BaseEjectionTime, false)
+	validateDuration(v, path+".max_ejection_time", outlierDetection.MaxEjectionTime, false)
+}
+
+func (circuitBreaker *CircuitBreakerConfig) validate(v *validator, path string) {
+	if circuitBreaker.ErrorRate < 0 || circuitBreaker.ErrorRate > 1 {
+		v.addf(path+".error_rate", "must be between 0 and 1")
+	}
+
+	if circuitBreaker.MinRequests < 0 {
+		v.addf(path+".min_requests", "must not be negative")
+	}
+
+	if circuitBreaker.HalfOpenRequests < 0 {
+		v.addf(path+".half_open_requests", "must not be negative")
+	}
+
+	validateDuration(v, path+".window", circuitBreaker.Window, false)
+	validateDuration(v, path+".cool_off", circuitBreaker.CoolOff, false)
+}
+
+func (transport *TransportConfig) validate(v *validator, path string) {
+	if transport.MaxIdleConnsPerHost < 0 {
+		v.addf(path+".max_idle_conns_per_host", "must not be negative")
+	}
+
+	if transport.MaxConnsPerHost < 0 {
+		v.addf(path+".max_conns_per_host", "must not be negative")
+	}
+
+	validateDuration(v, path+".idle_conn_timeout", transport.IdleConnTimeout, false)
+	validateDuration(v, path+".dial_timeout", transport.DialTimeout, false)
+	validateDuration(v, path+".tls_handshake_timeout", transport.TlsHandshakeTimeout, false)
+	validateDuration(v, path+".response_header_timeout", transport.ResponseHeaderTimeout, false)
+}
+
+func (requestTimeout *RequestTimeoutConfig) validate(v *validator, path string) {
+	validateDuration(v, path+".timeout", requestTimeout.Timeout, false)
+
+	prefixes := map[string]int{}
+
+	for i, route := range requestTimeout.Routes {
+		routePath := fmt.Sprintf("%s.routes[%d]", path, i)
+
+		if route == nil {
+			v.addf(routePath, "empty route")
+			continue
+		}
+
+		if !strings.HasPrefix(route.PathPrefix, "/") {
+			v.addf(routePath+".path_prefix", "must start with /, got %q", route.PathPrefix)
+		} else if first, seen := prefixes[route.PathPrefix]; seen {
+			v.addf(routePath+".path_prefix", "duplicate path prefix %q, also used by routes[%d]", route.PathPrefix, first)
+		} else {
+			prefixes[route.PathPrefix] = i
+		}
+
+		validateDuration(v, routePath+".timeout", route.Timeout, true)
+	}
+}
+
+func (clientAuth *ClientAuthConfig) validate(v *validator, path string) {
+	if clientAuth.CaFile == "" {
+		v.addf(path+".ca_file", "missing CA file")
+	}
+
+	switch clientAuth.Mode {
+	case "", ClientAuthRequire, ClientAuthOptional:
+	default:
+		v.addf(path+".mode", "must be %s or %s, got %q", ClientAuthRequire, ClientAuthOptional, clientAuth.Mode)
+	}
+
+	if clientAuth.SubjectHeader != "" && strings.EqualFold(clientAuth.SubjectHeader, clientAuth.FingerprintHeader) {
+		v.addf(path+".fingerprint_header", "must differ from subject_header")
+	}
+}
+
+func (upstreamTls *UpstreamTlsConfig) validate(v *validator, path string) {
+	if upstreamTls.CertFile != "" && upstreamTls.KeyFile == "" {
+		v.addf(path+".key_file", "missing key file for cert_file")
+	}
+
+	if upstreamTls.KeyFile != "" && upstreamTls.CertFile == "" {
+		v.addf(path+".cert_file", "missing cert file for key_file")
+	}
+
+	switch upstreamTls.MinVersion {
+	case "", "1.0", "1.1", "1.2", "1.3":
+	default:
+		v.addf(path+".min_version", "must be 1.0, 1.1, 1.2 or 1.3, got %q", upstreamTls.MinVersion)
+	}
+
+	if upstreamTls.InsecureSkipVerify && upstreamTls.CaFile != "" {
+		v.addf(path+".insecure_skip_verify", "can't be combined with ca_file, which would never be used")
+	}
+}
+
+func (healthCheck *HealthCheckConfig) validate(v *validator, path string) {
+	switch healthCheck.Type {
+	case "", backend.HealthCheckHttp, backend.HealthCheckTcp, backend.HealthCheckGrpc:
+	default:
+		v.addf(path+".type", "%w %q", backend.ErrInvalidHealthCheckType, healthCheck.Type)
+	}
+
+	for i, rawStatus := range healthCheck.ExpectedStatus {
+		if _, err := backend.ParseStatusRange(rawStatus); err != nil {
+			v.addf(fmt.Sprintf("%s.expected_status[%d]", path, i), "%w %q", err, rawStatus)
+		}
+	}
+
+	if healthCheck.BodyRegex != "" {
+		if _, err := regexp.Compile(healthCheck.BodyRegex); err != nil {
+			v.add(path+".body_regex", err)
+		}
+	}
+
+	if healthCheck.HealthyThreshold < 0 {
+		v.addf(path+".healthy_threshold", "must not be negative")
+	}
+
+	if healthCheck.UnhealthyThreshold < 0 {
+		v.addf(path+".unhealthy_threshold", "must not be negative")
+	}
+
+	switch healthCheck.InitialState {
+	case "", "healthy", "unhealthy":
+	default:
+		v.addf(path+".initial_state", "must be healthy or unhealthy, got %q", healthCheck.InitialState)
+	}
+
+	validateDuration(v, path+".timeout", healthCheck.Timeout, false)
+	validateDuration(v, path+".jitter", healthCheck.Jitter, false)
+}
+
+// validateDuration reports raw if it isn't a valid, non-negative duration, or if it is missing and required. It
+// returns the parsed duration and whether raw was set and valid.
+func validateDuration(v *validator, path string, raw string, required bool) (time.Duration, bool) {
+	if raw == "" {
+		if required {
+			v.addf(path, "missing duration")
+		}
+
+		return 0, false
+	}
+
+	duration, err := time.ParseDuration(raw)
+
+	if err != nil {
+		v.addf(path, "invalid duration %q", raw)
+		return 0, false
+	}
+
+	if duration < 0 {
+		v.addf(path, "must not be negative")
+		return 0, false
+	}
+
+	return duration, true
+}
@@ -0,0 +1,255 @@
+package config
+
+import (
+	"errors"
+	"load-balancer/internal/backend"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func validApp(host string) *ApplicationConfig {
+	return &ApplicationConfig{
+		Host:                host,
+		Instances:           []*InstanceConfig{{Url: "http://localhost:8080"}},
+		HealthUri:           "/health",
+		Timeout:             "5s",
+		HealthCheckCooldown: "30s",
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	scenarios := []struct {
+		name             string
+		modify           func(config *Config)
+		expectedProblems []string
+	}{
+		{"Valid", func(config *Config) {}, nil},
+		{"Access Log", func(config *Config) {
+			config.AccessLog = &AccessLogConfig{Format: "json", Output: "/var/log/lb/access.log", MaxSizeMb: 100, MaxBackups: 5}
+		}, nil},
+		{"Invalid Access Log", func(config *Config) { config.AccessLog = &AccessLogConfig{Format: "xml", MaxBackups: -1} },
+			[]string{
+				`access_log.format: access log format must be json, logfmt or combined, got "xml"`,
+				"access_log.max_backups: must not be negative",
+			}},
+		{"Admin Address", func(config *Config) { config.Admin = &AdminConfig{Address: "127.0.0.1:9000"} }, nil},
+		{"Admin Socket", func(config *Config) { config.Admin = &AdminConfig{Address: "unix:/run/lb.sock"} }, nil},
+		{"Admin Socket Without Path", func(config *Config) { config.Admin = &AdminConfig{Address: "unix:"} },
+			[]string{"admin.address: missing socket path"}},
+		{"Admin Address Without Port", func(config *Config) { config.Admin = &AdminConfig{Address: "localhost"} },
+			[]string{`admin.address: must be host:port or unix:/path/to/socket, got "localhost"`}},
+		{"Missing Host", func(config *Config) { config.Apps[1].Host = "" }, []string{"apps[1].host: missing host"}},
+		{"Host With Scheme", func(config *Config) { config.Apps[1].Host = "http://app1.example.com" },
+			[]string{`apps[1].host: must be a host name without a scheme, got "http://app1.example.com"`}},
+		{"Host With Path", func(config *Config) { config.Apps[1].Host = "app1.example.com/api" },
+			[]string{`apps[1].host: must be a host name without a path, got "app1.example.com/api"`}},
+		{"Host With Port", func(config *Config) { config.Apps[1].Host = "app1.example.com:8080" },
+			[]string{`apps[1].host: must be a host name without a port, got "app1.example.com:8080"`}},
+		{"IPv6 Host", func(config *Config) { config.Apps[1].Host = "::1" }, nil},
+		{"Duplicate Host", func(config *Config) { config.Apps[1].Host = "app0.example.com" },
+			[]string{`apps[1].host: duplicate host "app0.example.com", also used by apps[0]`}},
+		{"No Instances", func(config *Config) { config.Apps[0].Instances = nil }, []string{"apps[0].instances: no instances"}},
+		{"Instance Without Scheme", func(config *Config) { config.Apps[1].Instances[0].Url = "localhost:8080" },
+			[]string{"apps[1].instances[0].url: missing or invalid scheme"}},
+		{"Instance Without Host", func(config *Config) { config.Apps[0].Instances[0].Url = "http://" },
+			[]string{"apps[0].instances[0].url: missing host"}},
+		{"Negative Weight", func(config *Config) { config.Apps[0].Instances[0].Weight = -1 },
+			[]string{"apps[0].instances[0].weight: weight must be positive"}},
+		{"Missing Health Uri", func(config *Config) { config.Apps[0].HealthUri = "" },
+			[]string{"apps[0].health_uri: missing health uri"}},
+		{"Tcp Check Without Health Uri", func(config *Config) {
+			config.Apps[0].HealthUri = ""
+			config.Apps[0].HealthCheck = &HealthCheckConfig{Type: "tcp"}
+		}, nil},
+		{"Missing Timeout", func(config *Config) { config.Apps[0].Timeout = "" }, []string{"apps[0].timeout: missing duration"}},
+		{"Invalid Cooldown", func(config *Config) { config.Apps[0].HealthCheckCooldown = "soon" },
+			[]string{`apps[0].health_check_cooldown: invalid duration "soon"`}},
+		{"Zero Cooldown", func(config *Config) { config.Apps[0].HealthCheckCooldown = "0s" },
+			[]string{"apps[0].health_check_cooldown: must be greater than zero"}},
+		{"Unknown Strategy", func(config *Config) { config.Apps[0].Strategy = "random" },
+			[]string{`apps[0].strategy: unknown strategy "random"`}},
+		{"Hash Key Without Name", func(config *Config) { config.Apps[0].ConsistentHash = &ConsistentHashConfig{Key: "header"} },
+			[]string{"apps[0].consistent_hash.name: hash key source requires a name"}},
+		{"Invalid Max Age", func(config *Config) { config.Apps[0].StickySession = &StickySessionConfig{MaxAge: "-1h"} },
+			[]string{"apps[0].sticky_session.max_age: must not be negative"}},
+		{"Invalid Ejection Time", func(config *Config) {
+			config.Apps[0].OutlierDetection = &OutlierDetectionConfig{BaseEjectionTime: "30"}
+		}, []string{`apps[0].outlier_detection.base_ejection_time: invalid duration "30"`}},
+		{"Invalid Tls Address", func(config *Config) { config.Tls = &TlsConfig{Address: "8443"} },
+			[]string{`tls.address: must be host:port, got "8443"`}},
+		{"Invalid Acme", func(config *Config) { config.Acme = &AcmeConfig{DirectoryUrl: "localhost:14000/dir"} }, []string{
+			"acme.cache_dir: missing cache directory",
+			"acme.accept_terms: must be true to agree to the CA's terms of service",
+			`acme.directory_url: must be an http or https URL, got "localhost:14000/dir"`,
+		}},
+		{"Invalid Upstream Tls", func(config *Config) {
+			config.Apps[0].UpstreamTls = &UpstreamTlsConfig{KeyFile: "client.key", MinVersion: "1.4", CaFile: "ca.pem", InsecureSkipVerify: true}
+		}, []string{
+			"apps[0].upstream_tls.cert_file: missing cert file for key_file",
+			`apps[0].upstream_tls.min_version: must be 1.0, 1.1, 1.2 or 1.3, got "1.4"`,
+			"apps[0].upstream_tls.insecure_skip_verify: can't be combined with ca_file, which would never be used",
+		}},
+		{"Invalid Transport", func(config *Config) {
+			config.Apps[0].Transport = &TransportConfig{MaxIdleConnsPerHost: -1, DialTimeout: "fast", ResponseHeaderTimeout: "10s"}
+		}, []string{
+			"apps[0].transport.max_idle_conns_per_host: must not be negative",
+			`apps[0].transport.dial_timeout: invalid duration "fast"`,
+		}},
+		{"Invalid Request Timeout", func(config *Config) {
+			config.Apps[0].RequestTimeout = &RequestTimeoutConfig{
+				Timeout: "-1s",
+				Routes: []*RouteTimeoutConfig{
+					{PathPrefix: "/reports", Timeout: "5m"},
+					{PathPrefix: "reports"},
+					{PathPrefix: "/reports", Timeout: "0s"},
+				},
+			}
+		}, []string{
+			"apps[0].request_timeout.timeout: must not be negative",
+			`apps[0].request_timeout.routes[1].path_prefix: must start with /, got "reports"`,
+			"apps[0].request_timeout.routes[1].timeout: missing duration",
+			`apps[0].request_timeout.routes[2].path_prefix: duplicate path prefix "/reports", also used by routes[0]`,
+		}},
+		{"Invalid Client Auth", func(config *Config) {
+			config.Apps[0].ClientAuth = &ClientAuthConfig{Mode: "always", SubjectHeader: "X-Client", FingerprintHeader: "x-client"}
+		}, []string{
+			"apps[0].client_auth.ca_file: missing CA file",
+			`apps[0].client_auth.mode: must be require or optional, got "always"`,
+			"apps[0].client_auth.fingerprint_header: must differ from subject_header",
+			"apps[0].client_auth: needs the app to be served over HTTPS, with a tls block or acme",
+		}},
+		{"Client Auth With Acme", func(config *Config) {
+			config.Acme = &AcmeConfig{CacheDir: "/var/lib/lb/acme", AcceptTerms: true}
+			config.Apps[0].ClientAuth = &ClientAuthConfig{CaFile: "partners.pem", Mode: ClientAuthOptional}
+		}, nil},
+		{"Tls Without Key", func(config *Config) { config.Apps[0].Tls = &AppTlsConfig{CertFile: "cert.pem"} },
+			[]string{"apps[0].tls.key_file: missing key file"}},
+		{"Invalid Circuit Breaker", func(config *Config) {
+			config.Apps[0].CircuitBreaker = &CircuitBreakerConfig{ErrorRate: 1.5, HalfOpenRequests: -1, CoolOff: "later"}
+		}, []string{
+			"apps[0].circuit_breaker.error_rate: must be between 0 and 1",
+			"apps[0].circuit_breaker.half_open_requests: must not be negative",
+			`apps[0].circuit_breaker.cool_off: invalid duration "later"`,
+		}},
+		{"Invalid Health Check", func(config *Config) {
+			config.Apps[1].HealthCheck = &HealthCheckConfig{
+				Type:           "icmp",
+				ExpectedStatus: []string{"200", "2xx"},
+				BodyRegex:      "(",
+				InitialState:   "maybe",
+				Jitter:         "a bit",
+			}
+		}, []string{
+			`apps[1].health_check.type: invalid health check type "icmp"`,
+			`apps[1].health_check.expected_status[1]: invalid status code or range "2xx"`,
+			"apps[1].health_check.body_regex: error parsing regexp",
+			`apps[1].health_check.initial_state: must be healthy or unhealthy, got "maybe"`,
+			`apps[1].health_check.jitter: invalid duration "a bit"`,
+		}},
+		{"Retry", func(config *Config) {
+			config.Apps[0].Retry = &RetryConfig{MaxRetries: 2, Budget: "1s", MaxBodyBytes: 1 << 20, Methods: []string{"PUT"}}
+		}, nil},
+		{"Invalid Retry", func(config *Config) {
+			config.Apps[0].Retry = &RetryConfig{MaxRetries: -1, Budget: "1", Methods: []string{"put"}}
+		}, []string{
+			"apps[0].retry.max_retries: must not be negative",
+			`apps[0].retry.budget: invalid duration "1"`,
+			`apps[0].retry.methods[0]: must be an upper-case HTTP method, got "put"`,
+		}},
+		{"Several Apps", func(config *Config) {
+			config.Apps[0].Instances[0].Url = "ftp://localhost"
+			config.Apps[1].Timeout = "forever"
+		}, []string{
+			"apps[0].instances[0].url: missing or invalid scheme",
+			`apps[1].timeout: invalid duration "forever"`,
+		}},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			config := &Config{Apps: []*ApplicationConfig{validApp("app0.example.com"), validApp("app1.example.com")}}
+			scenario.modify(config)
+
+			err := config.Validate()
+
+			if scenario.expectedProblems == nil {
+				if err != nil {
+					t.Fatalf("Validate() returned an unexpected error = %v", err)
+				}
+
+				return
+			}
+
+			var validationErr *ValidationError
+
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("Validate() error = %v, expected a *ValidationError", err)
+			}
+
+			if len(validationErr.Problems) != len(scenario.expectedProblems) {
+				t.Fatalf("Validate() found %v problems, expected %v: %v", len(validationErr.Problems), len(scenario.expectedProblems), err)
+			}
+
+			for i, expected := range scenario.expectedProblems {
+				if !strings.HasPrefix(validationErr.Problems[i].Error(), expected) {
+					t.Errorf("Problem %v = %q, expected %q", i, validationErr.Problems[i], expected)
+				}
+			}
+		})
+	}
+}
+
+func TestConfig_Validate_WrapsSentinelErrors(t *testing.T) {
+	config := &Config{Apps: []*ApplicationConfig{validApp("app0.example.com")}}
+	config.Apps[0].HealthCheck = &HealthCheckConfig{Type: "icmp"}
+
+	if err := config.Validate(); !errors.Is(err, backend.ErrInvalidHealthCheckType) {
+		t.Errorf("Validate() error = %v, expected it to wrap %v", err, backend.ErrInvalidHealthCheckType)
+	}
+}
+
+func TestLoadConfig_UnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	_ = os.WriteFile(path, []byte(`
+apps:
+  - host: app0.example.com
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 30s
+    stratgey: least_connections
+    instances:
+      - url: http://localhost:8080
+        wieght: 2
+  - host: app0.example.com
+    health_uri: /health
+    timeout: 5s
+    health_check_cooldown: 30s
+    instances: []`), 0o644)
+
+	_, err := LoadConfig(path)
+
+	var validationErr *ValidationError
+
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("LoadConfig() error = %v, expected a *ValidationError", err)
+	}
+
+	expected := []string{
+		"line 7: unknown field stratgey",
+		"line 10: unknown field wieght",
+		`apps[1].host: duplicate host "app0.example.com", also used by apps[0]`,
+		"apps[1].instances: no instances",
+	}
+
+	if len(validationErr.Problems) != len(expected) {
+		t.Fatalf("LoadConfig() found %v problems, expected %v: %v", len(validationErr.Problems), len(expected), err)
+	}
+
+	for i := range expected {
+		if validationErr.Problems[i].Error() != expected[i] {
+			t.Errorf("Problem %v = %q, expected %q", i, validationErr.Problems[i], expected[i])
+		}
+	}
+}
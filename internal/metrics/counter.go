@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"bufio"
+	"sync/atomic"
+)
+
+// CounterVec is a family of counters that only go up, one per set of label values L.
+type CounterVec[L LabelSet] struct {
+	name   string
+	help   string
+	vector vector[L, *atomic.Uint64]
+}
+
+// NewCounterVec registers a counter labelled with L.
+func NewCounterVec[L LabelSet](registry *Registry, name string, help string) *CounterVec[L] {
+	counter := &CounterVec[L]{name, help, newVector[L](func() *atomic.Uint64 { return &atomic.Uint64{} })}
+	registry.register(counter)
+
+	return counter
+}
+
+// Inc adds one to the counter with the given labels.
+func (counter *CounterVec[L]) Inc(labels L) {
+	counter.vector.with(labels).Add(1)
+}
+
+// Delete stops exporting the counters whose labels match, such as every status code of a backend that has been
+// removed.
+func (counter *CounterVec[L]) Delete(match func(labels L) bool) {
+	counter.vector.delete(match)
+}
+
+// Value is the current count for the given labels.
+func (counter *CounterVec[L]) Value(labels L) uint64 {
+	if c, ok := counter.vector.get(labels); ok {
+		return c.Load()
+	}
+
+	return 0
+}
+
+func (counter *CounterVec[L]) write(w *bufio.Writer) {
+	writeHeader(w, counter.name, counter.help, "counter")
+
+	for _, s := range counter.vector.sorted() {
+		writeSample(w, counter.name, s.labels, "", "", float64(s.value.Load()))
+	}
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestCounterVec_Inc(t *testing.T) {
+	counter := NewCounterVec[valueLabels](NewRegistry(), "lb_test_total", "Test.")
+	var wg sync.WaitGroup
+
+	for range 50 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for range 100 {
+				counter.Inc(valueLabels{"a"})
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if counter.Value(valueLabels{"a"}) != 5000 {
+		t.Errorf("Value(a) = %v, expected 5000", counter.Value(valueLabels{"a"}))
+	}
+
+	if counter.Value(valueLabels{"b"}) != 0 {
+		t.Errorf("Value(b) = %v, expected 0", counter.Value(valueLabels{"b"}))
+	}
+}
+
+func TestCounterVec_Delete(t *testing.T) {
+	scenarios := []struct {
+		name         string
+		match        func(backendLabels) bool
+		expectedKept []backendLabels
+	}{
+		{"Every Series Of A Backend", func(labels backendLabels) bool { return labels.app == "a" && labels.backend == "http://a1" },
+			[]backendLabels{{"a", "http://a2", "2xx"}, {"b", "http://a1", "2xx"}}},
+		{"Every Series Of An App", func(labels backendLabels) bool { return labels.app == "a" },
+			[]backendLabels{{"b", "http://a1", "2xx"}}},
+		{"One Series", func(labels backendLabels) bool { return labels == backendLabels{"a", "http://a1", "5xx"} },
+			[]backendLabels{{"a", "http://a1", "2xx"}, {"a", "http://a2", "2xx"}, {"b", "http://a1", "2xx"}}},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			counter := NewCounterVec[backendLabels](NewRegistry(), "lb_test_total", "Test.")
+			all := []backendLabels{{"a", "http://a1", "2xx"}, {"a", "http://a1", "5xx"}, {"a", "http://a2", "2xx"}, {"b", "http://a1", "2xx"}}
+
+			for _, labels := range all {
+				counter.Inc(labels)
+			}
+
+			counter.Delete(scenario.match)
+
+			var kept []backendLabels
+
+			for _, labels := range all {
+				if counter.Value(labels) > 0 {
+					kept = append(kept, labels)
+				}
+			}
+
+			if !slices.Equal(kept, scenario.expectedKept) {
+				t.Errorf("Expected %v to be kept, got %v", scenario.expectedKept, kept)
+			}
+
+			if len(counter.vector.sorted()) != len(scenario.expectedKept) {
+				t.Errorf("Expected %v series to be exported, got %v", len(scenario.expectedKept), len(counter.vector.sorted()))
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"bufio"
+	"math"
+	"slices"
+	"sync/atomic"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the buckets latency histograms are counted in.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// HistogramVec is a family of histograms, one per set of label values L.
+type HistogramVec[L LabelSet] struct {
+	name    string
+	help    string
+	buckets []float64
+	vector  vector[L, *histogram]
+}
+
+type histogram struct {
+	// counts holds the number of observations in each bucket (not cumulative), with one extra for +Inf.
+	counts  []atomic.Uint64
+	sumBits atomic.Uint64
+}
+
+// NewHistogramVec registers a histogram labelled with L, with the given bucket upper bounds. DefaultBuckets is used when
+// buckets is empty.
+func NewHistogramVec[L LabelSet](registry *Registry, name string, help string, buckets []float64) *HistogramVec[L] {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	buckets = slices.Sorted(slices.Values(buckets))
+	create := func() *histogram { return &histogram{counts: make([]atomic.Uint64, len(buckets)+1)} }
+	hist := &HistogramVec[L]{name, help, buckets, newVector[L](create)}
+	registry.register(hist)
+
+	return hist
+}
+
+// Observe records value in the histogram with the given labels.
+func (hist *HistogramVec[L]) Observe(value float64, labels L) {
+	h := hist.vector.with(labels)
+	bucket, _ := slices.BinarySearch(hist.buckets, value)
+
+	h.counts[bucket].Add(1)
+
+	for {
+		old := h.sumBits.Load()
+
+		if h.sumBits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+value)) {
+			break
+		}
+	}
+}
+
+// Delete stops exporting the histograms whose labels match.
+func (hist *HistogramVec[L]) Delete(match func(labels L) bool) {
+	hist.vector.delete(match)
+}
+
+// Count is the number of observations for the given labels.
+func (hist *HistogramVec[L]) Count(labels L) uint64 {
+	h, ok := hist.vector.get(labels)
+
+	if !ok {
+		return 0
+	}
+
+	var count uint64
+
+	for i := range h.counts {
+		count += h.counts[i].Load()
+	}
+
+	return count
+}
+
+func (hist *HistogramVec[L]) write(w *bufio.Writer) {
+	writeHeader(w, hist.name, hist.help, "histogram")
+
+	for _, s := range hist.vector.sorted() {
+		var cumulative uint64
+
+		for i, upperBound := range hist.buckets {
+			cumulative += s.value.counts[i].Load()
+			writeSample(w, hist.name+"_bucket", s.labels, "le", formatFloat(upperBound), float64(cumulative))
+		}
+
+		cumulative += s.value.counts[len(hist.buckets)].Load()
+		writeSample(w, hist.name+"_bucket", s.labels, "le", "+Inf", float64(cumulative))
+		writeSample(w, hist.name+"_sum", s.labels, "", "", math.Float64frombits(s.value.sumBits.Load()))
+		writeSample(w, hist.name+"_count", s.labels, "", "", float64(cumulative))
+	}
+}
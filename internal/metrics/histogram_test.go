@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHistogramVec_Observe(t *testing.T) {
+	registry := NewRegistry()
+	hist := NewHistogramVec[valueLabels](registry, "lb_test_seconds", "Test.", []float64{1, 0.1, 0.5})
+
+	for _, value := range []float64{0.05, 0.1, 0.3, 0.7, 2} {
+		hist.Observe(value, valueLabels{"a"})
+	}
+
+	var out strings.Builder
+	_, _ = registry.WriteTo(&out)
+
+	expected := `# HELP lb_test_seconds Test.
+# TYPE lb_test_seconds histogram
+lb_test_seconds_bucket{value="a",le="0.1"} 2
+lb_test_seconds_bucket{value="a",le="0.5"} 3
+lb_test_seconds_bucket{value="a",le="1"} 4
+lb_test_seconds_bucket{value="a",le="+Inf"} 5
+lb_test_seconds_sum{value="a"} 3.15
+lb_test_seconds_count{value="a"} 5
+`
+
+	if out.String() != expected {
+		t.Errorf("WriteTo() wrote:\n%v\nexpected:\n%v", out.String(), expected)
+	}
+
+	if hist.Count(valueLabels{"a"}) != 5 {
+		t.Errorf("Count(a) = %v, expected 5", hist.Count(valueLabels{"a"}))
+	}
+}
+
+func BenchmarkHistogramVec_Observe(b *testing.B) {
+	hist := NewHistogramVec[codeLabels](NewRegistry(), "lb_test_seconds", "Test.", nil)
+
+	for n := 0; n < b.N; n++ {
+		hist.Observe(0.042, codeLabels{"api.example.com", "2xx"})
+	}
+}
+
+func BenchmarkParallelHistogramVec_Observe(b *testing.B) {
+	hist := NewHistogramVec[codeLabels](NewRegistry(), "lb_test_seconds", "Test.", nil)
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			hist.Observe(0.042, codeLabels{"api.example.com", "2xx"})
+		}
+	})
+}
@@ -0,0 +1,288 @@
+// Package metrics is a small, dependency-free implementation of the parts of the Prometheus client the load balancer
+// needs: labelled counters, histograms and gauges read at scrape time, written in the Prometheus text format. A metric's
+// labels are a Go type implementing LabelSet, so recording a series with the wrong labels doesn't compile.
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Label is the name and value of one label of a series.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// LabelSet is implemented by the type holding the label values of a metric's series, usually a struct with a field per
+// label. The type fixes the metric's labels, so a series can't be recorded with too few or too many of them. Labels
+// must return the same names in the same order whatever the values.
+type LabelSet interface {
+	comparable
+	Labels() []Label
+}
+
+// NoLabels is the label set of a metric that has none.
+type NoLabels struct{}
+
+func (NoLabels) Labels() []Label {
+	return nil
+}
+
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds a set of metrics and writes them out in the order they were created.
+type Registry struct {
+	mutex      sync.Mutex
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (registry *Registry) register(c collector) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	registry.collectors = append(registry.collectors, c)
+}
+
+// WriteTo writes every metric in the Prometheus text format.
+func (registry *Registry) WriteTo(w io.Writer) (int64, error) {
+	registry.mutex.Lock()
+	collectors := slices.Clone(registry.collectors)
+	registry.mutex.Unlock()
+
+	counting := &countingWriter{w: w}
+	buffered := bufio.NewWriter(counting)
+
+	for _, c := range collectors {
+		c.write(buffered)
+	}
+
+	err := buffered.Flush()
+
+	return counting.n, err
+}
+
+// Handler serves the registry's metrics for Prometheus to scrape.
+func (registry *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		_, _ = registry.WriteTo(w)
+	})
+}
+
+// GaugeFunc is a gauge whose values are read when the metrics are scraped, for state that is already tracked
+// elsewhere such as connection counts.
+type GaugeFunc[L LabelSet] struct {
+	name    string
+	help    string
+	collect func(emit func(labels L, value float64))
+}
+
+// NewGaugeFunc registers a gauge whose series are produced by collect, which calls emit once per series on every
+// scrape.
+func NewGaugeFunc[L LabelSet](registry *Registry, name string, help string, collect func(emit func(labels L, value float64))) *GaugeFunc[L] {
+	gauge := &GaugeFunc[L]{name, help, collect}
+	registry.register(gauge)
+
+	return gauge
+}
+
+func (gauge *GaugeFunc[L]) write(w *bufio.Writer) {
+	type sample struct {
+		labels []Label
+		value  float64
+	}
+
+	var samples []sample
+
+	gauge.collect(func(labels L, value float64) {
+		samples = append(samples, sample{labels.Labels(), value})
+	})
+
+	slices.SortFunc(samples, func(a, b sample) int {
+		return compareLabels(a.labels, b.labels)
+	})
+
+	writeHeader(w, gauge.name, gauge.help, "gauge")
+
+	for _, s := range samples {
+		writeSample(w, gauge.name, s.labels, "", "", s.value)
+	}
+}
+
+// series is one set of label values of a vector metric.
+type series[T any] struct {
+	labels []Label
+	value  T
+}
+
+// vector holds the series of a labelled metric, keyed by their label set and created on first use.
+type vector[L LabelSet, T any] struct {
+	mutex  sync.RWMutex
+	series map[L]*series[T]
+	create func() T
+}
+
+func newVector[L LabelSet, T any](create func() T) vector[L, T] {
+	return vector[L, T]{series: map[L]*series[T]{}, create: create}
+}
+
+// with returns the series with the given labels, creating it if needed.
+func (v *vector[L, T]) with(labels L) T {
+	v.mutex.RLock()
+	existing, ok := v.series[labels]
+	v.mutex.RUnlock()
+
+	if ok {
+		return existing.value
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if existing, ok = v.series[labels]; !ok {
+		existing = &series[T]{labels.Labels(), v.create()}
+		v.series[labels] = existing
+	}
+
+	return existing.value
+}
+
+// delete removes every series whose labels match.
+func (v *vector[L, T]) delete(match func(labels L) bool) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	for labels := range v.series {
+		if match(labels) {
+			delete(v.series, labels)
+		}
+	}
+}
+
+// get returns the series with the given labels without creating it.
+func (v *vector[L, T]) get(labels L) (T, bool) {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+
+	existing, ok := v.series[labels]
+
+	if !ok {
+		var zero T
+		return zero, false
+	}
+
+	return existing.value, true
+}
+
+// sorted returns the series ordered by their label values, so the output is stable between scrapes.
+func (v *vector[L, T]) sorted() []*series[T] {
+	v.mutex.RLock()
+	all := make([]*series[T], 0, len(v.series))
+
+	for _, s := range v.series {
+		all = append(all, s)
+	}
+
+	v.mutex.RUnlock()
+
+	slices.SortFunc(all, func(a, b *series[T]) int {
+		return compareLabels(a.labels, b.labels)
+	})
+
+	return all
+}
+
+func compareLabels(a []Label, b []Label) int {
+	return slices.CompareFunc(a, b, func(a, b Label) int {
+		return strings.Compare(a.Value, b.Value)
+	})
+}
+
+func writeHeader(w *bufio.Writer, name string, help string, metricType string) {
+	w.WriteString("# HELP " + name + " " + escapeHelp(help) + "\n")
+	w.WriteString("# TYPE " + name + " " + metricType + "\n")
+}
+
+// writeSample writes one line of a metric. extraLabel and extraValue add a label that isn't part of the vector, such
+// as a histogram bucket's le.
+func writeSample(w *bufio.Writer, name string, labels []Label, extraLabel string, extraValue string, value float64) {
+	w.WriteString(name)
+
+	if len(labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+
+			w.WriteString(label.Name + `="` + escapeLabelValue(label.Value) + `"`)
+		}
+
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+
+			w.WriteString(extraLabel + `="` + extraValue + `"`)
+		}
+
+		w.WriteByte('}')
+	}
+
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+
+	return n, err
+}
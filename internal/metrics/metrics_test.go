@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	registry := NewRegistry()
+	requests := NewCounterVec[codeLabels](registry, "lb_requests_total", "Requests proxied.")
+	NewGaugeFunc(registry, "lb_backend_healthy", "Whether the backend is healthy.", func(emit func(valueLabels, float64)) {
+		emit(valueLabels{"http://b"}, 0)
+		emit(valueLabels{"http://a"}, 1)
+	})
+
+	requests.Inc(codeLabels{"b.example.com", "5xx"})
+	requests.Inc(codeLabels{"a.example.com", "2xx"})
+	requests.Inc(codeLabels{"a.example.com", "2xx"})
+
+	var out strings.Builder
+
+	if _, err := registry.WriteTo(&out); err != nil {
+		t.Fatalf("WriteTo() returned an unexpected error = %v", err)
+	}
+
+	expected := `# HELP lb_requests_total Requests proxied.
+# TYPE lb_requests_total counter
+lb_requests_total{app="a.example.com",code="2xx"} 2
+lb_requests_total{app="b.example.com",code="5xx"} 1
+# HELP lb_backend_healthy Whether the backend is healthy.
+# TYPE lb_backend_healthy gauge
+lb_backend_healthy{value="http://a"} 1
+lb_backend_healthy{value="http://b"} 0
+`
+
+	if out.String() != expected {
+		t.Errorf("WriteTo() wrote:\n%v\nexpected:\n%v", out.String(), expected)
+	}
+}
+
+func TestRegistry_EscapesLabelValues(t *testing.T) {
+	registry := NewRegistry()
+	NewCounterVec[valueLabels](registry, "lb_test_total", "Line one\nline two.").Inc(valueLabels{"quote \" backslash \\ newline \n"})
+
+	var out strings.Builder
+	_, _ = registry.WriteTo(&out)
+
+	scenarios := []string{
+		`# HELP lb_test_total Line one\nline two.`,
+		`lb_test_total{value="quote \" backslash \\ newline \n"} 1`,
+	}
+
+	for _, expected := range scenarios {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected output to contain %v, got:\n%v", expected, out.String())
+		}
+	}
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	registry := NewRegistry()
+	NewCounterVec[NoLabels](registry, "lb_test_total", "Test.").Inc(NoLabels{})
+	recorder := httptest.NewRecorder()
+
+	registry.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if recorder.Header().Get("Content-Type") != ContentType {
+		t.Errorf("Content-Type = %v, expected %v", recorder.Header().Get("Content-Type"), ContentType)
+	}
+
+	if !strings.Contains(recorder.Body.String(), "lb_test_total 1\n") {
+		t.Errorf("Expected an unlabelled sample, got:\n%v", recorder.Body.String())
+	}
+}
+
+// valueLabels label the test metrics with a single value.
+type valueLabels struct {
+	value string
+}
+
+func (labels valueLabels) Labels() []Label {
+	return []Label{{"value", labels.value}}
+}
+
+// codeLabels label the test metrics with an app and a status class.
+type codeLabels struct {
+	app  string
+	code string
+}
+
+func (labels codeLabels) Labels() []Label {
+	return []Label{{"app", labels.app}, {"code", labels.code}}
+}
+
+// backendLabels label the test metrics with an app, a backend and a status class.
+type backendLabels struct {
+	app     string
+	backend string
+	code    string
+}
+
+func (labels backendLabels) Labels() []Label {
+	return []Label{{"app", labels.app}, {"backend", labels.backend}, {"code", labels.code}}
+}